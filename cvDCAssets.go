@@ -0,0 +1,231 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//
+// Web assets
+//
+// Templates, CSS and JS are built into the binary, so the collector needs no
+// files next to it and no network access beyond the clients. The templates are
+// parsed once. For working on them set "asset_dir" in clients.json (or
+// -assets for simulate) to the checkout: then every request reads the files
+// from there again.
+//
+// Operators who only want their own pages set "template_dir" instead: a page
+// found there (same file name, e.g. cvDCollector_boinc.html) replaces the
+// built in one and is parsed again when the file changes. TEMPLATES.md lists
+// the data each page gets and the helper functions.
+//
+
+//go:embed html css js
+var embeddedAssets embed.FS
+
+// themes are the built in themes; all but light add css/cvDCollector_<theme>.css
+var themes = []string{"light", "dark", "wall"}
+
+// themeCookie remembers a theme picked with ?theme=, e.g. by the rack display
+const themeCookie = "cvdc_theme"
+
+// cachedTemplate is a parsed page and, for an override, the file it came from
+type cachedTemplate struct {
+	page    *template.Template
+	file    string
+	modTime time.Time
+}
+
+var (
+	templateMu    sync.Mutex
+	templateCache = make(map[string]cachedTemplate)
+)
+
+// templateFuncs
+//
+// Helpers for the templates. "theme", "user", "operator" and "csrf" are
+// replaced per request by renderPage
+var templateFuncs = template.FuncMap{
+	"duration":    formatDuration,
+	"bytes":       func(value interface{}) (string, error) { return withNumber(value, formatBytes) },
+	"percent":     func(value interface{}) (string, error) { return withNumber(value, formatPercent) },
+	"timestamp":   formatTimestamp,
+	"fpops":       formatFpops,
+	"statusLabel": statusLabel,
+	"statusClass": statusClass,
+	"theme":       func() string { return "" },
+	"user":        func() string { return "" },
+	"operator":    func() bool { return false },
+	"csrf":        func() string { return "" },
+}
+
+// formatDuration shows seconds (a number) or a time.Duration as "1d 2h:03m:04s"
+func formatDuration(value interface{}) (string, error) {
+	if duration, ok := value.(time.Duration); ok {
+		return formatDHMS(math.Round(duration.Seconds())), nil
+	}
+	return withNumber(value, formatDHMS)
+}
+
+// withNumber formats any number of a template with a format for float64
+func withNumber(value interface{}, format func(float64) string) (string, error) {
+	switch value := value.(type) {
+	case float64:
+		return format(value), nil
+	case int:
+		return format(float64(value)), nil
+	case int64:
+		return format(float64(value)), nil
+	}
+	return "", fmt.Errorf("number expected, not %T", value)
+}
+
+// statusLabel is the label of a BOINC task status, given as TaskStatus or key
+func statusLabel(value interface{}) (string, error) {
+	status, err := toTaskStatus(value)
+	return status.String(), err
+}
+
+// statusClass is the colour class of a BOINC task status, given as TaskStatus or key
+func statusClass(value interface{}) (string, error) {
+	status, err := toTaskStatus(value)
+	return status.Class(), err
+}
+
+func toTaskStatus(value interface{}) (TaskStatus, error) {
+	switch value := value.(type) {
+	case TaskStatus:
+		return value, nil
+	case string:
+		if status, ok := parseTaskStatus(value); ok {
+			return status, nil
+		}
+		return 0, fmt.Errorf("unknown task status %q", value)
+	}
+	return 0, fmt.Errorf("task status of %T", value)
+}
+
+// assets returns the file system the web assets are served from
+func assets() fs.FS {
+	if dcClients.AssetDir != "" {
+		return os.DirFS(dcClients.AssetDir)
+	}
+	return embeddedAssets
+}
+
+// parseTemplate parses one page with the helper functions
+func parseTemplate(fsys fs.FS, pattern string) (*template.Template, error) {
+	return template.New(filepath.Base(pattern)).Funcs(templateFuncs).ParseFS(fsys, pattern)
+}
+
+// pageTemplate
+//
+// The parsed template of a page, e.g. "cvDCollector_boinc.html": the
+// operator's one from template_dir if there is one, else the built in one;
+// parsed once unless the assets come from disk
+func pageTemplate(name string) (*template.Template, error) {
+	if dcClients.AssetDir != "" {
+		return parseTemplate(assets(), "html/"+name)
+	}
+
+	var override string
+	var modTime time.Time
+	if dcClients.TemplateDir != "" {
+		override = filepath.Join(dcClients.TemplateDir, name)
+		info, err := os.Stat(override)
+		if err == nil {
+			modTime = info.ModTime()
+		} else {
+			override = ""
+		}
+	}
+
+	templateMu.Lock()
+	defer templateMu.Unlock()
+	if cached, ok := templateCache[name]; ok && cached.file == override && cached.modTime.Equal(modTime) {
+		return cached.page, nil
+	}
+
+	var page *template.Template
+	var err error
+	if override != "" {
+		page, err = parseTemplate(os.DirFS(dcClients.TemplateDir), name)
+	} else {
+		page, err = parseTemplate(embeddedAssets, "html/"+name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	templateCache[name] = cachedTemplate{page: page, file: override, modTime: modTime}
+	return page, nil
+}
+
+// requestTheme
+//
+// The theme of a page: ?theme= (remembered in a cookie), the cookie, or the
+// "theme" of clients.json; light when none or unknown
+func requestTheme(w http.ResponseWriter, r *http.Request) string {
+	theme := dcClients.Theme
+	if cookie, err := r.Cookie(themeCookie); err == nil {
+		theme = cookie.Value
+	}
+	if query := r.URL.Query().Get("theme"); query != "" && knownTheme(query) {
+		theme = query
+		http.SetCookie(w, &http.Cookie{Name: themeCookie, Value: theme, Path: "/", MaxAge: 365 * 24 * 3600})
+	}
+	if !knownTheme(theme) {
+		return "light"
+	}
+	return theme
+}
+
+func knownTheme(theme string) bool {
+	for _, known := range themes {
+		if theme == known {
+			return true
+		}
+	}
+	return false
+}
+
+// renderPage writes a page from its template and data
+func renderPage(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	page, err := pageTemplate(name)
+	if err == nil {
+		// the cached template is shared, the theme belongs to this request
+		page, err = page.Clone()
+	}
+	if err != nil {
+		slog.Error("page template", "page", name, "error", err)
+		http.Error(w, "template "+name+" not available", http.StatusInternalServerError)
+		return
+	}
+
+	theme := requestTheme(w, r)
+	user := requestUser(r)
+	page.Funcs(template.FuncMap{
+		"theme":    func() string { return theme },
+		"user":     func() string { return user.Name },
+		"operator": func() bool { return user.Role >= RoleOperator },
+		"csrf":     func() string { return csrfToken(user) },
+	})
+
+	outputDefaultHeader(w)
+	if err := page.Execute(w, data); err != nil {
+		slog.Warn("rendering page", "page", name, "error", err)
+	}
+}
+
+// assetHandler serves the static files below /css/ and /js/
+func assetHandler(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(http.FS(assets())).ServeHTTP(w, r)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedTemplates(t *testing.T) {
+	pages, err := fs.Glob(embeddedAssets, "html/*.html")
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("no embedded templates: %v", err)
+	}
+
+	// the farm network may have no internet access
+	external := regexp.MustCompile(`(src|href)="(https?:)?//`)
+	for _, page := range pages {
+		name := strings.TrimPrefix(page, "html/")
+		if _, err := pageTemplate(name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		content, _ := fs.ReadFile(embeddedAssets, page)
+		if match := external.Find(content); match != nil {
+			t.Errorf("%s loads %s from outside", name, match)
+		}
+	}
+
+	first, _ := pageTemplate("cvDCollector_fah.html")
+	second, _ := pageTemplate("cvDCollector_fah.html")
+	if first != second {
+		t.Error("template parsed again")
+	}
+}
+
+func TestAssetHandler(t *testing.T) {
+	for _, path := range []string{"/css/cvDCollector.css", "/js/cvDCollector_live.js"} {
+		recorder := httptest.NewRecorder()
+		assetHandler(recorder, httptest.NewRequest("GET", path, nil))
+		if recorder.Code != 200 || recorder.Body.Len() == 0 {
+			t.Errorf("%s: status %d, %d bytes", path, recorder.Code, recorder.Body.Len())
+		}
+	}
+}
+
+func TestAssetDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "html"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(dir, "html", "cvDCollector_deadlines.html")
+	if err := os.WriteFile(page, []byte("first {{len .Tasks}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dcClients.AssetDir = dir
+	defer func() { dcClients.AssetDir = "" }()
+
+	recorder := httptest.NewRecorder()
+	deadlinesHandler(recorder, httptest.NewRequest("GET", "/boinc/deadlines", nil))
+	if body := recorder.Body.String(); body != "first 0" {
+		t.Errorf("page %q", body)
+	}
+
+	// edits show up without a restart
+	if err := os.WriteFile(page, []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	deadlinesHandler(recorder, httptest.NewRequest("GET", "/boinc/deadlines", nil))
+	if body := recorder.Body.String(); body != "second" {
+		t.Errorf("page %q after edit", body)
+	}
+}
+
+func TestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "cvDCollector_deadlines.html")
+	if err := os.WriteFile(page, []byte(`mine {{len .Tasks}} {{duration 90061}} {{bytes 1536}} {{percent 0.25}} {{statusLabel "running"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dcClients.TemplateDir = dir
+	defer func() { dcClients.TemplateDir = "" }()
+
+	recorder := httptest.NewRecorder()
+	deadlinesHandler(recorder, httptest.NewRequest("GET", "/boinc/deadlines", nil))
+	if body := recorder.Body.String(); body != "mine 0 1d 1h:1m:1s 1.5 KiB 25.0% Running" {
+		t.Errorf("page %q", body)
+	}
+
+	// pages not in the directory stay the built in ones
+	recorder = httptest.NewRecorder()
+	fahHandler(recorder, httptest.NewRequest("GET", "/fah/all", nil))
+	if !strings.Contains(recorder.Body.String(), "<!DOCTYPE html>") {
+		t.Errorf("fah page %q", recorder.Body.String())
+	}
+
+	// a changed file is parsed again
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(page, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(page, later, later); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	deadlinesHandler(recorder, httptest.NewRequest("GET", "/boinc/deadlines", nil))
+	if body := recorder.Body.String(); body != "changed" {
+		t.Errorf("page %q after edit", body)
+	}
+
+	// without it the built in page is back
+	if err := os.Remove(page); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	deadlinesHandler(recorder, httptest.NewRequest("GET", "/boinc/deadlines", nil))
+	if !strings.Contains(recorder.Body.String(), "<!DOCTYPE html>") {
+		t.Errorf("page %q after removal", recorder.Body.String())
+	}
+}
+
+func TestTheme(t *testing.T) {
+	for _, theme := range themes[1:] {
+		if _, err := fs.Stat(embeddedAssets, "css/cvDCollector_"+theme+".css"); err != nil {
+			t.Errorf("theme %s: %s", theme, err)
+		}
+	}
+
+	tests := []struct {
+		config string
+		cookie string
+		query  string
+		want   string
+	}{
+		{"", "", "", "light"},
+		{"dark", "", "", "dark"},
+		{"dark", "wall", "", "wall"},
+		{"dark", "wall", "light", "light"},
+		{"", "", "neon", "light"},
+		{"neon", "", "", "light"},
+	}
+	for _, test := range tests {
+		dcClients.Theme = test.config
+		request := httptest.NewRequest("GET", "/fah/all?theme="+test.query, nil)
+		if test.cookie != "" {
+			request.AddCookie(&http.Cookie{Name: themeCookie, Value: test.cookie})
+		}
+		recorder := httptest.NewRecorder()
+		fahHandler(recorder, request)
+
+		body := recorder.Body.String()
+		link := `href="/css/cvDCollector_` + test.want + `.css"`
+		if test.want == "light" && strings.Contains(body, "cvDCollector_dark.css") ||
+			test.want != "light" && !strings.Contains(body, link) {
+			t.Errorf("%+v: theme not %s", test, test.want)
+		}
+		remembered := strings.Contains(recorder.Header().Get("Set-Cookie"), themeCookie+"="+test.query)
+		if remembered != (test.query != "" && test.query != "neon") {
+			t.Errorf("%+v: cookie %q", test, recorder.Header().Get("Set-Cookie"))
+		}
+	}
+	dcClients.Theme = ""
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Attaching projects
+//
+// Adding a project to the farm without BOINC Manager on every host: the
+// projects the clients know of (get_all_projects_list), the account key
+// looked up once with email and password (lookup_account) and every selected
+// host attached with it (project_attach), all at the same time as each has to
+// wait for the project. Detaching works the same way (project_detach).
+//
+
+// FarmProject is a project and which hosts of the farm are attached to it
+type FarmProject struct {
+	Url      string
+	Name     string
+	Attached int
+	Hosts    []FarmProjectHost // in the order of the farm's hosts
+}
+
+// FarmProjectHost tells whether a host is attached to a project
+type FarmProjectHost struct {
+	Name     string
+	Attached bool
+}
+
+// sameProjectUrl compares project URLs as users type them: without scheme, case and trailing slash
+func sameProjectUrl(a string, b string) bool {
+	normalize := func(url string) string {
+		url = strings.ToLower(strings.TrimSpace(url))
+		url = strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+		return strings.TrimSuffix(url, "/")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// attachedProject returns the project of the host at url, nil if it is not attached
+func attachedProject(projects Projects, url string) *Project {
+	for idx := range projects {
+		if sameProjectUrl(projects[idx].MasterUrl, url) {
+			return &projects[idx]
+		}
+	}
+	return nil
+}
+
+// farmProjects
+//
+// The projects any host of the farm is attached to, by name
+func farmProjects(views []BoincClientView) []FarmProject {
+	var projects []FarmProject
+	for _, view := range views {
+		for _, project := range view.Projects {
+			known := false
+			for idx := range projects {
+				known = known || sameProjectUrl(projects[idx].Url, project.MasterUrl)
+			}
+			if !known {
+				projects = append(projects, FarmProject{Url: project.MasterUrl, Name: project.ProjectName})
+			}
+		}
+	}
+	for idx := range projects {
+		for _, view := range views {
+			attached := attachedProject(view.Projects, projects[idx].Url) != nil
+			if attached {
+				projects[idx].Attached++
+			}
+			projects[idx].Hosts = append(projects[idx].Hosts, FarmProjectHost{Name: view.Name, Attached: attached})
+		}
+	}
+	sort.SliceStable(projects, func(i, j int) bool {
+		return strings.ToLower(projects[i].Name) < strings.ToLower(projects[j].Name)
+	})
+	return projects
+}
+
+// projectsListTTL is how long the projects to choose from are kept; they seldom
+// change, and the client reads a large file for each get_all_projects_list
+const projectsListTTL = time.Hour
+
+// projectsListCache keeps the projects list of the last client which answered
+var projectsListCache struct {
+	sync.Mutex
+	list    []ProjectListEntry
+	fetched time.Time
+}
+
+// projectsList fetches the projects to choose from from the first client which answers, once per projectsListTTL
+func projectsList() ([]ProjectListEntry, error) {
+	projectsListCache.Lock()
+	defer projectsListCache.Unlock()
+	if projectsListCache.list != nil && time.Since(projectsListCache.fetched) < projectsListTTL {
+		return projectsListCache.list, nil
+	}
+
+	err := errors.New("no BOINC client connected")
+	for idx := range dcClients.BOINCConfig.Clients {
+		var list []ProjectListEntry
+		if list, err = dcClients.BOINCConfig.Clients[idx].allProjectsList(); err == nil {
+			sort.SliceStable(list, func(i, j int) bool {
+				return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+			})
+			projectsListCache.list, projectsListCache.fetched = list, time.Now()
+			return list, nil
+		}
+	}
+	return nil, err
+}
+
+// attachHandler shows the projects of the farm and the form to attach hosts
+func attachHandler(w http.ResponseWriter, r *http.Request) {
+	views := boincViews()
+	data := struct {
+		Hosts        []BoincClientView
+		FarmProjects []FarmProject
+		Projects     []ProjectListEntry
+		ListError    string
+	}{
+		Hosts:        views,
+		FarmProjects: farmProjects(views),
+	}
+	list, err := projectsList()
+	if err != nil {
+		data.ListError = err.Error()
+	}
+	data.Projects = list
+	renderPage(w, r, "cvDCollector_attach.html", data)
+}
+
+// attachAPIHandler returns the projects of the farm and which hosts are attached as JSON
+func attachAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	projects := farmProjects(boincViews())
+	if projects == nil {
+		projects = []FarmProject{}
+	}
+	outputJSON(w, projects)
+}
+
+// attachProjectHandler
+//
+// Attach the clients of the path ("pi", "pi,nas" or "all") to the project
+// "url" with the account key "authenticator", or the key looked up with
+// "email" and "password"; a job, as each host waits for the project. Hosts
+// attached already are left alone
+func attachProjectHandler(w http.ResponseWriter, r *http.Request) {
+	url := strings.TrimSpace(r.FormValue("url"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	key := strings.TrimSpace(r.FormValue("authenticator"))
+	email, password := strings.TrimSpace(r.FormValue("email")), r.FormValue("password")
+	if url == "" || (key == "" && (email == "" || password == "")) {
+		http.Error(w, "project URL and account key, or email and password needed", http.StatusBadRequest)
+		return
+	}
+	clients, err := findBoincClients(r.URL.Path[len("/attach-project/"):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var targets []*BoincClient
+	var messages []string
+	for _, client := range clients {
+		if attachedProject(client.view().Projects, url) != nil {
+			messages = append(messages, client.Name+": attached already")
+			continue
+		}
+		targets = append(targets, client)
+	}
+	if len(targets) == 0 {
+		writeNothingToDo(w, "attach-project", messages)
+		return
+	}
+
+	// the account key from the project, asked once through the first host which is connected
+	accountKey := func() (string, error) { return key, nil }
+	if key == "" {
+		lookupClient := targets[0]
+		for _, target := range targets {
+			if target.view().ConnectionError == "" {
+				lookupClient = target
+				break
+			}
+		}
+		actor := requestActor(r)
+		accountKey = sync.OnceValues(func() (string, error) {
+			key, err := lookupClient.lookupAccount(url, email, password)
+			actor.audit(lookupClient.Name, "lookup-account", "lookup_account "+url+" "+email, "", err)
+			if err != nil {
+				lookupClient.logger().Warn("lookup_account failed", "url", url, "error", err)
+				return "", fmt.Errorf("lookup_account: %w", err)
+			}
+			return key, nil
+		})
+	}
+
+	job := startJob(r, "attach-project", "project_attach "+url, targets, func(client *BoincClient, progress func(string)) (string, error) {
+		progress("waiting for the project")
+		key, err := accountKey()
+		if err != nil {
+			return "", err
+		}
+		if err := client.attachProject(url, name, key); err != nil {
+			return "", err
+		}
+		// show the new project right away
+		if err := client.refreshState(); err != nil {
+			client.logger().Warn("get_state failed", "error", err)
+		}
+		return "attached", nil
+	})
+	writeJobStarted(w, job, messages)
+}
+
+// detachProjectHandler removes the project "url" from the clients of the path as a job
+func detachProjectHandler(w http.ResponseWriter, r *http.Request) {
+	url := strings.TrimSpace(r.FormValue("url"))
+	if url == "" {
+		http.Error(w, "which project?", http.StatusBadRequest)
+		return
+	}
+	clients, err := findBoincClients(r.URL.Path[len("/detach-project/"):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var targets []*BoincClient
+	var messages []string
+	for _, client := range clients {
+		if attachedProject(client.view().Projects, url) == nil {
+			messages = append(messages, client.Name+": not attached")
+			continue
+		}
+		targets = append(targets, client)
+	}
+	if len(targets) == 0 {
+		writeNothingToDo(w, "detach-project", messages)
+		return
+	}
+
+	// the audit log gets the URL as the first host spells it
+	masterUrl := attachedProject(targets[0].view().Projects, url).MasterUrl
+	job := startJob(r, "detach-project", "project_detach "+masterUrl, targets, func(client *BoincClient, _ func(string)) (string, error) {
+		// the URL as this host spells it
+		project := attachedProject(client.view().Projects, url)
+		if project == nil {
+			return "not attached", nil
+		}
+		if err := client.detachProject(project.MasterUrl); err != nil {
+			return "", err
+		}
+		if err := client.refreshState(); err != nil {
+			client.logger().Warn("get_state failed", "error", err)
+		}
+		return "detached", nil
+	})
+	writeJobStarted(w, job, messages)
+}
+
+// writeNothingToDo answers an action which none of the clients needs, with why not
+func writeNothingToDo(w http.ResponseWriter, action string, messages []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "%s: nothing to do\n", action)
+	_, _ = fmt.Fprintln(w, strings.Join(messages, "\n"))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attachableBoinc is a fake BOINC client which attaches to any project and detaches again
+func attachableBoinc(t *testing.T) *fakeServer {
+	server := startFakeBoinc(t, "")
+	success := func(string) string { return boincReply("<success/>") }
+	server.setReply("lookup_account", success)
+	server.setReply("lookup_account_poll", func(string) string {
+		return boincReply("<account_out>\n<authenticator>1234_abcd</authenticator>\n</account_out>")
+	})
+	server.setReply("project_attach", success)
+	server.setReply("project_attach_poll", func(string) string {
+		return boincReply("<project_attach_reply>\n<error_num>0</error_num>\n</project_attach_reply>")
+	})
+	server.setReply("project_detach", success)
+	return server
+}
+
+func TestBoincAccountRPCs(t *testing.T) {
+	saved := attachPollInterval
+	defer func() { attachPollInterval = saved }()
+	attachPollInterval = time.Millisecond
+
+	server, client := polledTestBoinc(t)
+
+	list, err := client.allProjectsList()
+	if err != nil || len(list) != 2 || list[0].Name != "Einstein@Home" || len(list[0].Platforms) != 4 || list[1].GeneralArea != "Biology and Medicine" {
+		t.Fatalf("list %+v, %v", list, err)
+	}
+
+	// the project answers on the third poll
+	var lookup string
+	polls := 0
+	server.setReply("lookup_account", func(request string) string {
+		lookup = request
+		return boincReply("<success/>")
+	})
+	server.setReply("lookup_account_poll", func(string) string {
+		if polls++; polls < 3 {
+			return boincReply("<account_out>\n<error_num>-204</error_num>\n</account_out>")
+		}
+		return boincReply("<account_out>\n<authenticator>1234_abcd</authenticator>\n</account_out>")
+	})
+	key, err := client.lookupAccount("https://einsteinathome.org/", " Anna@Example.org", "secret")
+	hash := md5.Sum([]byte("secret" + "anna@example.org"))
+	if err != nil || key != "1234_abcd" || polls != 3 || !strings.Contains(lookup, hex.EncodeToString(hash[:])) || strings.Contains(lookup, "secret") {
+		t.Errorf("lookup %q, %v after %d polls, request %q", key, err, polls, lookup)
+	}
+
+	server.setReply("lookup_account_poll", func(string) string {
+		return boincReply("<account_out>\n<error_num>-206</error_num>\n<error_msg>Invalid password</error_msg>\n</account_out>")
+	})
+	if _, err := client.lookupAccount("https://einsteinathome.org/", "anna@example.org", "guess"); err == nil || !strings.Contains(err.Error(), "Invalid password") {
+		t.Errorf("wrong password: %v", err)
+	}
+
+	server.setReply("project_attach", func(string) string { return boincReply("<success/>") })
+	server.setReply("project_attach_poll", func(string) string {
+		return boincReply("<project_attach_reply>\n<error_num>-130</error_num>\n<message>Already attached to project</message>\n</project_attach_reply>")
+	})
+	if err := client.attachProject("https://einsteinathome.org/", "Einstein@Home", "1234_abcd"); err == nil || !strings.Contains(err.Error(), "Already attached") {
+		t.Errorf("attach: %v", err)
+	}
+	// the fake client does not know project_detach
+	if err := client.detachProject("https://einsteinathome.org/"); err == nil {
+		t.Errorf("detach of an unknown op succeeded")
+	}
+}
+
+func TestAttachProjects(t *testing.T) {
+	withAuth(t, AuthConfig{})
+	pi, nas := attachableBoinc(t), attachableBoinc(t)
+	projectsListCache.list = nil
+	defer func() { projectsListCache.list = nil }()
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	piIp, piPort := pi.Addr()
+	nasIp, nasPort := nas.Addr()
+	dcClients.BOINCConfig.Clients = []BoincClient{
+		{DCClient: DCClient{Name: "pi", Ip: piIp, Port: piPort}},
+		{DCClient: DCClient{Name: "nas", Ip: nasIp, Port: nasPort}},
+	}
+	for idx := range dcClients.BOINCConfig.Clients {
+		client := &dcClients.BOINCConfig.Clients[idx]
+		if err := client.connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer client.disconnect(nil)
+		if err := client.poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	post := func(path string, form url.Values) (int, string) {
+		form.Set("csrf", csrfToken(User{}))
+		request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = "127.0.0.1:4711"
+		recorder := httptest.NewRecorder()
+		handler := attachProjectHandler
+		if strings.HasPrefix(path, "/detach-project/") {
+			handler = detachProjectHandler
+		}
+		authorize(RoleOperator, handler)(recorder, request)
+		if recorder.Code == 202 {
+			id, err := strconv.Atoi(strings.TrimPrefix(recorder.Header().Get("Location"), "/jobs#job-"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := waitForJob(t, id)
+			return recorder.Code, fmt.Sprintf("%s %s, %d of %d through", recorder.Body.String(), job.State, job.Done, len(job.Steps))
+		}
+		return recorder.Code, recorder.Body.String()
+	}
+
+	einstein := url.Values{"url": {"https://einsteinathome.org/"}, "name": {"Einstein@Home"}, "email": {"anna@example.org"}, "password": {"secret"}}
+	if code, body := post("/attach-project/all", einstein); code != 202 || !strings.HasSuffix(body, "started on 2 clients\n Done, 2 of 2 through") {
+		t.Errorf("attach: %d %q", code, body)
+	}
+	if got := pi.received(); !strings.Contains(strings.Join(got, " "), "lookup_account lookup_account_poll project_attach") || strings.Contains(strings.Join(nas.received(), " "), "lookup_account") {
+		t.Errorf("pi %v, nas %v", got, nas.received())
+	}
+
+	// attached already, however the URL is written
+	code, body := post("/attach-project/pi", url.Values{"url": {"https://www.WorldCommunityGrid.org"}, "authenticator": {"1234_abcd"}})
+	if code != 200 || body != "attach-project: nothing to do\npi: attached already\n" {
+		t.Errorf("attached already: %d %q", code, body)
+	}
+	if code, _ := post("/attach-project/pi", url.Values{"url": {"https://einsteinathome.org/"}}); code != 400 {
+		t.Errorf("without account: %d", code)
+	}
+	if code, _ := post("/attach-project/pi,mac", einstein); code != 404 {
+		t.Errorf("unknown client: %d", code)
+	}
+
+	if code, body := post("/detach-project/pi,nas", url.Values{"url": {"www.worldcommunitygrid.org"}}); code != 202 || !strings.HasSuffix(body, "started on 2 clients\n Done, 2 of 2 through") {
+		t.Errorf("detach: %d %q", code, body)
+	}
+	if code, _ := post("/detach-project/pi", url.Values{}); code != 400 {
+		t.Errorf("detach without project: %d", code)
+	}
+
+	entries, err := readAudit(auditFile(), "pi", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, entry := range entries {
+		commands = append(commands, entry.Action+": "+entry.Command)
+	}
+	want := "detach-project: project_detach http://www.worldcommunitygrid.org/|attach-project: project_attach https://einsteinathome.org/|lookup-account: lookup_account https://einsteinathome.org/ anna@example.org"
+	if strings.Join(commands, "|") != want {
+		t.Errorf("audit %q", commands)
+	}
+
+	// the fake clients keep their recorded state
+	recorder := httptest.NewRecorder()
+	attachAPIHandler(recorder, httptest.NewRequest("GET", "/api/boinc/projects", nil))
+	var projects []FarmProject
+	if err := json.Unmarshal(recorder.Body.Bytes(), &projects); err != nil || len(projects) != 1 || projects[0].Attached != 2 || len(projects[0].Hosts) != 2 {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+	for range 2 {
+		recorder = httptest.NewRecorder()
+		attachHandler(recorder, httptest.NewRequest("GET", "/boinc/projects", nil))
+		if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "<td>2 of 2</td>") {
+			t.Errorf("page %d %s", recorder.Code, recorder.Body.String())
+		}
+	}
+	// the projects list is asked for once
+	if got := strings.Count(strings.Join(pi.received(), " "), "get_all_projects_list"); got != 1 {
+		t.Errorf("get_all_projects_list %d times", got)
+	}
+}
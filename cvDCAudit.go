@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Audit log
+//
+// Every action on the clients (project update, reconnect, ...) and every
+// refused attempt is appended as one JSON line to the file "audit_log" of
+// clients.json (default cvDC_audit.log): when, who from where, on which
+// client, what exactly and how it went. The collector never rewrites the
+// file; /audit and /api/audit show the latest entries.
+//
+
+// AuditEntry is one action on one client
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	IP      string    `json:"ip"`
+	Client  string    `json:"client"`
+	Action  string    `json:"action"`  // update, reload, ...
+	Command string    `json:"command"` // what was sent, passwords left out
+	Outcome string    `json:"outcome"` // ok, failed, denied or started
+	Error   string    `json:"error,omitempty"`
+}
+
+const (
+	AuditOK      = "ok"
+	AuditFailed  = "failed"
+	AuditDenied  = "denied"
+	AuditStarted = "started" // a background job, its outcome follows per client
+)
+
+const defaultAuditLog = "cvDC_audit.log"
+
+// auditLimit is how many entries /audit shows unless asked for more
+const auditLimit = 200
+
+// auditMaxLine is the longest line readAudit takes for an entry
+const auditMaxLine = 1 << 20
+
+var auditMu sync.Mutex
+
+// auditFile returns the path of the audit log
+func auditFile() string {
+	if dcClients.AuditLog != "" {
+		return dcClients.AuditLog
+	}
+	return defaultAuditLog
+}
+
+// requestIP is the address a request came from; behind a trusted proxy the one it names
+func requestIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && fromTrustedProxy(r) {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if ip := remoteIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// audit
+//
+// Append an action of the request's user on a client to the audit log; the
+// outcome follows from err unless given
+func audit(r *http.Request, client string, action string, command string, outcome string, err error) {
+	requestActor(r).audit(client, action, command, outcome, err)
+}
+
+// auditActor is who acts from where, taken from the request while it is there
+type auditActor struct {
+	user string
+	ip   string
+}
+
+// requestActor is the user of the request and the address it came from
+func requestActor(r *http.Request) auditActor {
+	return auditActor{user: requestUser(r).Name, ip: requestIP(r)}
+}
+
+// audit appends an action of the actor; unlike audit() also once the request is done, as jobs do
+func (actor auditActor) audit(client string, action string, command string, outcome string, err error) {
+	entry := AuditEntry{
+		Time:    time.Now(),
+		User:    actor.user,
+		IP:      actor.ip,
+		Client:  client,
+		Action:  action,
+		Command: command,
+		Outcome: outcome,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = AuditOK
+		if err != nil {
+			entry.Outcome = AuditFailed
+		}
+	}
+
+	if err := appendAudit(auditFile(), entry); err != nil {
+		// the action happened anyway, so at least keep it in the output
+		slog.Error("writing audit log", "file", auditFile(), "error", err, "entry", entry)
+	}
+}
+
+// appendAudit writes one entry to the end of the file
+func appendAudit(path string, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readAudit
+//
+// The newest entries of the file first, at most limit of them, only those
+// of client and user when given
+func readAudit(path string, client string, user string, limit int) ([]AuditEntry, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	reader := bufio.NewReaderSize(file, auditMaxLine)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// no entry of the collector is that long, so skip the rest of the line
+			for err == bufio.ErrBufferFull {
+				_, err = reader.ReadSlice('\n')
+			}
+			line = nil
+		}
+		// lines which are no entry, e.g. cut short by a crash, are skipped as well
+		var entry AuditEntry
+		if len(line) > 0 && json.Unmarshal(line, &entry) == nil {
+			if (client == "" || entry.Client == client) && (user == "" || entry.User == user) {
+				entries = append(entries, entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for left, right := 0, len(entries)-1; left < right; left, right = left+1, right-1 {
+		entries[left], entries[right] = entries[right], entries[left]
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// auditQuery reads the audit log for the parameters client, user and limit of a
+// request; the status tells a bad request from a log which cannot be read
+func auditQuery(r *http.Request) ([]AuditEntry, int, error) {
+	limit := auditLimit
+	if text := r.URL.Query().Get("limit"); text != "" {
+		value, err := strconv.Atoi(text)
+		if err != nil || value < 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("limit %q is no number", text)
+		}
+		limit = value
+	}
+	entries, err := readAudit(auditFile(), r.URL.Query().Get("client"), r.URL.Query().Get("user"), limit)
+	if err != nil {
+		slog.Error("reading audit log", "file", auditFile(), "error", err)
+		return nil, http.StatusInternalServerError, err
+	}
+	return entries, http.StatusOK, nil
+}
+
+// auditHandler shows the latest actions
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	entries, status, err := auditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	data := struct {
+		Client  string
+		User    string
+		Entries []AuditEntry
+	}{
+		Client:  r.URL.Query().Get("client"),
+		User:    r.URL.Query().Get("user"),
+		Entries: entries,
+	}
+	renderPage(w, r, "cvDCollector_audit.html", data)
+}
+
+// auditAPIHandler returns the latest actions as JSON
+func auditAPIHandler(w http.ResponseWriter, r *http.Request) {
+	entries, status, err := auditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	outputJSON(w, entries)
+}
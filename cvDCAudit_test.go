@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	withAuth(t, AuthConfig{})
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	dcClients.BOINCConfig.Clients = []BoincClient{{DCClient: DCClient{Name: "pi", Ip: "127.0.0.1", Pwd: "secret"}}}
+
+	post := func(path string, form url.Values, remote string) int {
+		request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = remote
+		recorder := httptest.NewRecorder()
+		authorize(RoleOperator, updateHandler)(recorder, request)
+		return recorder.Code
+	}
+
+	// boinccmd is not there (or finds no client): the update fails, is logged anyway
+	post("/update", url.Values{"client": {"pi"}, "csrf": {csrfToken(User{})}}, "127.0.0.1:4711")
+	// from another host without auth configured only viewer
+	post("/update", url.Values{"client": {"pi"}, "csrf": {csrfToken(User{})}}, "192.168.1.20:4711")
+
+	entries, err := readAudit(auditFile(), "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries: %+v", len(entries), entries)
+	}
+	denied, failed := entries[0], entries[1] // newest first
+	if failed.Client != "pi" || failed.Action != "update" || failed.Outcome != AuditFailed || failed.Error == "" || failed.IP != "127.0.0.1" {
+		t.Errorf("update %+v", failed)
+	}
+	if strings.Contains(failed.Command, "secret") || !strings.Contains(failed.Command, "--project") {
+		t.Errorf("command %q", failed.Command)
+	}
+	if denied.Client != "pi" || denied.Outcome != AuditDenied || denied.IP != "192.168.1.20" {
+		t.Errorf("denied %+v", denied)
+	}
+
+	// the log is only appended to
+	content, _ := os.ReadFile(auditFile())
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Errorf("%d lines", lines)
+	}
+
+	recorder := httptest.NewRecorder()
+	auditAPIHandler(recorder, httptest.NewRequest("GET", "/api/audit?client=pi&limit=1", nil))
+	var answer []AuditEntry
+	if err := json.Unmarshal(recorder.Body.Bytes(), &answer); err != nil || len(answer) != 1 || answer[0].Outcome != AuditDenied {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+
+	recorder = httptest.NewRecorder()
+	auditHandler(recorder, httptest.NewRequest("GET", "/audit?client=nas", nil))
+	if !strings.Contains(recorder.Body.String(), "no actions recorded") {
+		t.Errorf("page for another client %s", recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	auditHandler(recorder, httptest.NewRequest("GET", "/audit?limit=some", nil))
+	if recorder.Code != 400 {
+		t.Errorf("bad limit: status %d", recorder.Code)
+	}
+}
+
+func TestReadAuditSkipsBrokenLines(t *testing.T) {
+	path := t.TempDir() + "/audit.log"
+	if err := appendAudit(path, AuditEntry{Client: "pi", Action: "reload", Outcome: AuditOK}); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = file.WriteString(`{"client": "nas", "act`)
+	_ = file.Close()
+
+	entries, err := readAudit(path, "", "", 0)
+	if err != nil || len(entries) != 1 || entries[0].Client != "pi" {
+		t.Errorf("%+v, %v", entries, err)
+	}
+	if entries, err := readAudit(t.TempDir()+"/none.log", "", "", 0); err != nil || entries != nil {
+		t.Errorf("missing file: %+v, %v", entries, err)
+	}
+}
+
+func TestReadAuditLongLines(t *testing.T) {
+	path := t.TempDir() + "/audit.log"
+	long := strings.Repeat("x", 100000) // more than a bufio.Scanner takes
+	file, _ := os.Create(path)
+	_, _ = file.WriteString(strings.Repeat("garbage", auditMaxLine) + "\n")
+	_ = file.Close()
+	if err := appendAudit(path, AuditEntry{Client: "pi", Command: long, Outcome: AuditOK}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendAudit(path, AuditEntry{Client: "nas", Outcome: AuditOK}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readAudit(path, "", "", 0)
+	if err != nil || len(entries) != 2 || entries[0].Client != "nas" || entries[1].Command != long {
+		t.Errorf("%d entries, %v", len(entries), err)
+	}
+
+	// a log which cannot be read is no bad request
+	withAuth(t, AuthConfig{})
+	dcClients.AuditLog = t.TempDir()
+	recorder := httptest.NewRecorder()
+	auditAPIHandler(recorder, httptest.NewRequest("GET", "/api/audit", nil))
+	if recorder.Code != 500 {
+		t.Errorf("unreadable log: status %d", recorder.Code)
+	}
+}
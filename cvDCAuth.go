@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//
+// Authentication
+//
+// Who may see the pages and who may act on the clients. Local users log in
+// with HTTP basic auth against the bcrypt hashes in clients.json; behind a
+// reverse proxy doing the login the user (and role) can come from its
+// headers instead, accepted only from the proxy's addresses, and with client
+// certificates (see cvDCTLS.go) from their common name. Viewers see
+// everything, operators may also update projects and reconnect clients.
+// Without users or proxy everybody is a viewer and only this host is operator.
+//
+// The state changing endpoints take POST only, with the CSRF token of the
+// user (template function csrf, or /api/csrf for scripts) as form field
+// "csrf" or header X-CSRF-Token, so other sites can't make a logged in
+// browser post to them.
+//
+
+// Role is what a user may do
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+}
+
+func (role Role) String() string { return roleNames[role] }
+
+func (role Role) MarshalJSON() ([]byte, error) { return json.Marshal(role.String()) }
+
+func (role *Role) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	parsed, ok := parseRole(name)
+	if !ok {
+		return fmt.Errorf("unknown role %q", name)
+	}
+	*role = parsed
+	return nil
+}
+
+// parseRole reads a role name of the config or the proxy
+func parseRole(name string) (Role, bool) {
+	for role, roleName := range roleNames {
+		if role != RoleNone && strings.EqualFold(name, roleName) {
+			return role, true
+		}
+	}
+	return RoleNone, false
+}
+
+// AuthConfig is the "auth" part of clients.json
+type AuthConfig struct {
+	Users           []AuthUser `json:"users"`
+	ProxyHeader     string     `json:"proxy_header"`      // user name set by the reverse proxy, e.g. X-Forwarded-User
+	ProxyRoleHeader string     `json:"proxy_role_header"` // role set by the proxy; else the one of the user in users, else viewer
+	TrustedProxies  []string   `json:"trusted_proxies"`   // addresses or networks the proxy headers are accepted from
+}
+
+// AuthUser is a local user
+type AuthUser struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"password_hash"` // bcrypt, see "cvDC hash-password"
+	Role         Role   `json:"role"`          // viewer when not given
+}
+
+// User is who made a request
+type User struct {
+	Name string
+	Role Role
+}
+
+type userKey struct{}
+
+// csrfKey signs the CSRF tokens; new with every start
+var csrfKey = make([]byte, 32)
+
+// passwordCache remembers verified logins, bcrypt is slow on a Raspberry Pi
+var passwordCache = struct {
+	sync.Mutex
+	verified map[string][sha256.Size]byte
+}{verified: make(map[string][sha256.Size]byte)}
+
+func init() {
+	if _, err := rand.Read(csrfKey); err != nil {
+		panic(err)
+	}
+}
+
+// authEnabled tells if users, a proxy or client certificates are configured
+func authEnabled() bool {
+	return len(dcClients.Auth.Users) > 0 || dcClients.Auth.ProxyHeader != "" || clientCertsEnabled()
+}
+
+// checkAuthConfig
+//
+// Complete the auth part of the config and complain about what can't work
+func checkAuthConfig() error {
+	auth := &dcClients.Auth
+	for idx := range auth.Users {
+		user := &auth.Users[idx]
+		if user.Role == RoleNone {
+			user.Role = RoleViewer
+		}
+		if user.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+				return fmt.Errorf("user %s: password_hash: %s", user.Name, err)
+			}
+		}
+	}
+	if auth.ProxyHeader != "" && len(auth.TrustedProxies) == 0 {
+		return fmt.Errorf("proxy_header %s without trusted_proxies", auth.ProxyHeader)
+	}
+	for _, proxy := range auth.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trusted proxy %q is no address or network", proxy)
+		}
+	}
+	return nil
+}
+
+// findUser returns the local user of a name
+func findUser(name string) *AuthUser {
+	for idx := range dcClients.Auth.Users {
+		if dcClients.Auth.Users[idx].Name == name {
+			return &dcClients.Auth.Users[idx]
+		}
+	}
+	return nil
+}
+
+// checkPassword verifies the password of a local user
+func checkPassword(user *AuthUser, password string) bool {
+	if user.PasswordHash == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(user.PasswordHash + "\x00" + password))
+
+	passwordCache.Lock()
+	cached, ok := passwordCache.verified[user.Name]
+	passwordCache.Unlock()
+	if ok && subtle.ConstantTimeCompare(cached[:], sum[:]) == 1 {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return false
+	}
+	passwordCache.Lock()
+	passwordCache.verified[user.Name] = sum
+	passwordCache.Unlock()
+	return true
+}
+
+// fromTrustedProxy tells if a request comes from one of the trusted proxies
+func fromTrustedProxy(r *http.Request) bool {
+	ip := remoteIP(r)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range dcClients.Auth.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// authenticate
+//
+// The user of a request; ok is false when a login is needed (none or a
+// wrong one given)
+func authenticate(r *http.Request) (User, bool) {
+	if !authEnabled() {
+		if ip := remoteIP(r); ip != nil && ip.IsLoopback() {
+			return User{Role: RoleOperator}, true
+		}
+		return User{Role: RoleViewer}, true
+	}
+
+	auth := dcClients.Auth
+	if auth.ProxyHeader != "" && fromTrustedProxy(r) {
+		if name := r.Header.Get(auth.ProxyHeader); name != "" {
+			user := User{Name: name, Role: RoleViewer}
+			if local := findUser(name); local != nil {
+				user.Role = local.Role
+			}
+			if auth.ProxyRoleHeader != "" {
+				if role, ok := parseRole(r.Header.Get(auth.ProxyRoleHeader)); ok {
+					user.Role = role
+				}
+			}
+			return user, true
+		}
+	}
+
+	// a verified client certificate names the user
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		user := User{Name: name, Role: RoleViewer}
+		if local := findUser(name); local != nil {
+			user.Role = local.Role
+		}
+		return user, true
+	}
+
+	if name, password, ok := r.BasicAuth(); ok {
+		if local := findUser(name); local != nil && checkPassword(local, password) {
+			return User{Name: local.Name, Role: local.Role}, true
+		}
+	}
+	return User{}, false
+}
+
+// requestUser returns the user authorize put into the request
+func requestUser(r *http.Request) User {
+	user, _ := r.Context().Value(userKey{}).(User)
+	return user
+}
+
+// csrfToken is the token a user's posts must carry
+func csrfToken(user User) string {
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(user.Name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF verifies the token of a post
+func checkCSRF(r *http.Request, user User) bool {
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = r.PostFormValue("csrf")
+	}
+	return hmac.Equal([]byte(token), []byte(csrfToken(user)))
+}
+
+// authorize
+//
+// Wrap a handler so it only runs for users with at least the given role;
+// operator handlers in addition only for POSTs with the CSRF token
+func authorize(role Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cvDCollect", charset="UTF-8"`)
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		if user.Role < role {
+			deny(w, r, role, "not allowed for "+user.Role.String(), http.StatusForbidden)
+			return
+		}
+		if role >= RoleOperator {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				deny(w, r, role, "POST only", http.StatusMethodNotAllowed)
+				return
+			}
+			if !checkCSRF(r, user) {
+				deny(w, r, role, "missing or wrong CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// deny refuses a request; a refused action goes into the audit log
+func deny(w http.ResponseWriter, r *http.Request, role Role, message string, status int) {
+	if role >= RoleOperator {
+		// e.g. /reload/pi or /update with the client in the form
+		action, client, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		if client == "" {
+			client = r.FormValue("client")
+		}
+		audit(r, client, action, r.Method+" "+r.URL.Path, AuditDenied, errors.New(message))
+	}
+	http.Error(w, message, status)
+}
+
+// csrfAPIHandler tells scripts the CSRF token of their user
+func csrfAPIHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	outputJSON(w, struct {
+		User  string `json:"user"`
+		Role  Role   `json:"role"`
+		Token string `json:"token"`
+	}{user.Name, user.Role, csrfToken(user)})
+}
+
+// hashPassword
+//
+// "cvDC hash-password": read a password from stdin and print its bcrypt hash
+// for clients.json
+func hashPassword() {
+	_, _ = fmt.Fprint(os.Stderr, "password: ")
+	password, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "no password given")
+		os.Exit(-1)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(-1)
+	}
+	fmt.Println(string(hash))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// withAuth sets the auth config for a test, with an audit log of its own
+func withAuth(t *testing.T, auth AuthConfig) {
+	dcClients.Auth = auth
+	dcClients.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	if err := checkAuthConfig(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dcClients.Auth, dcClients.AuditLog = AuthConfig{}, "" })
+}
+
+func testUsers(t *testing.T) []AuthUser {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []AuthUser{
+		{Name: "anna", PasswordHash: string(hash), Role: RoleOperator},
+		{Name: "ben", PasswordHash: string(hash)},
+	}
+}
+
+func TestAuthRoles(t *testing.T) {
+	withAuth(t, AuthConfig{Users: testUsers(t)})
+
+	ok := func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(requestUser(r).Name)) }
+	viewer := authorize(RoleViewer, ok)
+	operator := authorize(RoleOperator, ok)
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		handler  http.HandlerFunc
+		method   string
+		csrf     bool
+		want     int
+	}{
+		{"no login", "", "", viewer, "GET", false, http.StatusUnauthorized},
+		{"wrong password", "anna", "guess", viewer, "GET", false, http.StatusUnauthorized},
+		{"unknown user", "carl", "secret", viewer, "GET", false, http.StatusUnauthorized},
+		{"viewer looks", "ben", "secret", viewer, "GET", false, http.StatusOK},
+		{"viewer acts", "ben", "secret", operator, "POST", true, http.StatusForbidden},
+		{"operator looks", "anna", "secret", viewer, "GET", false, http.StatusOK},
+		{"operator acts", "anna", "secret", operator, "POST", true, http.StatusOK},
+		{"operator acts again", "anna", "secret", operator, "POST", true, http.StatusOK},
+		{"operator acts by GET", "anna", "secret", operator, "GET", true, http.StatusMethodNotAllowed},
+		{"operator without token", "anna", "secret", operator, "POST", false, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		form := url.Values{}
+		if test.csrf {
+			form.Set("csrf", csrfToken(User{Name: test.user}))
+		}
+		request := httptest.NewRequest(test.method, "/update", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.user != "" {
+			request.SetBasicAuth(test.user, test.password)
+		}
+		recorder := httptest.NewRecorder()
+		test.handler(recorder, request)
+		if recorder.Code != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, recorder.Code, test.want)
+		}
+		if test.want == http.StatusOK && recorder.Body.String() != test.user {
+			t.Errorf("%s: user %q", test.name, recorder.Body.String())
+		}
+		if test.want == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no login asked for", test.name)
+		}
+	}
+
+	// the token of one user is no good for another
+	request := httptest.NewRequest("POST", "/update", nil)
+	request.SetBasicAuth("anna", "secret")
+	request.Header.Set("X-CSRF-Token", csrfToken(User{Name: "ben"}))
+	recorder := httptest.NewRecorder()
+	operator(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("token of another user: status %d", recorder.Code)
+	}
+}
+
+func TestAuthProxy(t *testing.T) {
+	withAuth(t, AuthConfig{
+		Users:           testUsers(t),
+		ProxyHeader:     "X-Forwarded-User",
+		ProxyRoleHeader: "X-Forwarded-Role",
+		TrustedProxies:  []string{"10.0.0.1", "192.168.1.0/24"},
+	})
+
+	tests := []struct {
+		remote string
+		user   string
+		role   string
+		want   Role
+		ok     bool
+	}{
+		{"10.0.0.1:4711", "dora", "", RoleViewer, true},
+		{"192.168.1.20:4711", "dora", "operator", RoleOperator, true},
+		{"10.0.0.1:4711", "anna", "", RoleOperator, true}, // role of the local user
+		{"10.0.0.1:4711", "anna", "viewer", RoleViewer, true},
+		{"10.0.0.2:4711", "anna", "operator", RoleNone, false}, // not from the proxy
+		{"10.0.0.1:4711", "", "", RoleNone, false},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = test.remote
+		request.Header.Set("X-Forwarded-User", test.user)
+		request.Header.Set("X-Forwarded-Role", test.role)
+		user, ok := authenticate(request)
+		if ok != test.ok || user.Role != test.want || ok && user.Name != test.user {
+			t.Errorf("%+v: got %+v, %v", test, user, ok)
+		}
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	withAuth(t, AuthConfig{})
+
+	request := httptest.NewRequest("POST", "/reload/pi", nil)
+	request.RemoteAddr = "127.0.0.1:4711"
+	if user, ok := authenticate(request); !ok || user.Role != RoleOperator {
+		t.Errorf("local: %+v, %v", user, ok)
+	}
+	request.RemoteAddr = "192.168.1.20:4711"
+	if user, ok := authenticate(request); !ok || user.Role != RoleViewer {
+		t.Errorf("remote: %+v, %v", user, ok)
+	}
+}
+
+func TestAuthConfig(t *testing.T) {
+	var config DCClients
+	err := json.Unmarshal([]byte(`{"auth": {"users": [{"name": "anna", "role": "Operator"}, {"name": "ben"}]}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Auth.Users[0].Role != RoleOperator {
+		t.Errorf("role %s", config.Auth.Users[0].Role)
+	}
+	if err := json.Unmarshal([]byte(`{"auth": {"users": [{"name": "anna", "role": "admin"}]}}`), &config); err == nil {
+		t.Error("unknown role accepted")
+	}
+
+	for _, auth := range []AuthConfig{
+		{Users: []AuthUser{{Name: "anna", PasswordHash: "secret"}}},
+		{ProxyHeader: "X-Forwarded-User"},
+		{ProxyHeader: "X-Forwarded-User", TrustedProxies: []string{"proxy"}},
+	} {
+		dcClients.Auth = auth
+		if err := checkAuthConfig(); err == nil {
+			t.Errorf("%+v accepted", auth)
+		}
+	}
+	dcClients.Auth = AuthConfig{}
+}
+
+func TestOperatorPage(t *testing.T) {
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	dcClients.BOINCConfig.Clients = []BoincClient{{DCClient: DCClient{Name: "pi"}}}
+	withAuth(t, AuthConfig{Users: testUsers(t)})
+
+	for _, test := range []struct {
+		user    string
+		buttons bool
+	}{{"anna", true}, {"ben", false}} {
+		request := httptest.NewRequest("GET", "/boinc/pi", nil)
+		request.SetBasicAuth(test.user, "secret")
+		recorder := httptest.NewRecorder()
+		authorize(RoleViewer, boincHandler)(recorder, request)
+
+		body := recorder.Body.String()
+		if !strings.Contains(body, csrfToken(User{Name: test.user})) {
+			t.Errorf("%s: page without token", test.user)
+		}
+		if strings.Contains(body, "<button onclick") != test.buttons {
+			t.Errorf("%s: buttons shown %v", test.user, !test.buttons)
+		}
+	}
+}
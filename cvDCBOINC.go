@@ -1,14 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"math"
 	"net"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -41,6 +43,13 @@ type auth2 struct {
 	NonceHash string   `xml:"auth2>nonce_hash"`
 }
 
+// response from second part of authorization process
+type authReply struct {
+	XMLName      xml.Name  `xml:"boinc_gui_rpc_reply"`
+	Authorized   *struct{} `xml:"authorized"`   // is nil when the password was rejected
+	Unauthorized *struct{} `xml:"unauthorized"` // not nil when the password was rejected
+}
+
 //
 // Project Status Structure for BOINC client
 //
@@ -48,7 +57,7 @@ type auth2 struct {
 //
 type Projects []Project
 type Project struct {
-	XMLName     xml.Name `xml:"project"`
+	XMLName     xml.Name `xml:"project" json:"-"`
 	MasterUrl   string   `xml:"master_url"`
 	ProjectName string   `xml:"project_name"`
 	UserName    string   `xml:"user_name"`
@@ -66,73 +75,98 @@ type Project struct {
 	NJobsSuccess    int     `xml:"njobs_success"`
 	NJobsError      int     `xml:"njobs_error"`
 	ElapsedTime     float64 `xml:"elapsed_time"`
-	// <gui_urls>
-	//   <gui_url>
-	//     <name>
-	//     <description>
-	//     <url>
+
 	SchedPriority              float64 `xml:"sched_priority"`
 	ProjectFilesDownloadedTime float64 `xml:"project_files_downloaded_time"`
 	Venue                      string  `xml:"venue"`
 	ProjectDir                 string  `xml:"project_dir"`
+
+	Rec                 float64   `xml:"rec"` // recent estimated credit, what the scheduler balances the shares by
+	ResourceShare       float64   `xml:"resource_share"`
+	NoRscPref           []string  `xml:"no_rsc_pref"`            // resources the user excluded for this project, e.g. NVIDIA
+	SuspendedViaGui     *struct{} `xml:"suspended_via_gui"`      // is nil when not suspended
+	DontRequestMoreWork *struct{} `xml:"dont_request_more_work"` // is nil when new work is fetched
+	GuiUrls             []GuiUrl  `xml:"gui_urls>gui_url"`
+}
+
+//
+// Link of a project for the manager, e.g. to the project's forum or the user's account
+//
+type GuiUrl struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Url         string `xml:"url"`
 }
 
 type Results []Result
 type Result struct {
-	XMLName                xml.Name   `xml:"result"`
-	Name                   string     `xml:"name"`
-	WUName                 string     `xml:"wu_name"`
-	Platform               string     `xml:"platform"`
-	VersionNum             string     `xml:"version_num"`
-	ProjectUrl             string     `xml:"project_url"`
-	FinalCPUTime           float64    `xml:"final_cpu_time"`
-	FinalElapsedTime       float64    `xml:"final_elapsed_time"`
-	ExitStatus             string     `xml:"exit_status"`
-	State                  int        `xml:"state"`
-	ReportDeadline         float64    `xml:"report_deadline"`
-	ReceivedTime           float64    `xml:"received_time"`
-	EstimatedTimeRemaining float64    `xml:"estimated_cpu_time_remaining"`
-	Activetask             ActiveTask `xml:"active_task"`
-	ReadyToReport          *struct{}  `xml:"ready_to_report"` // is nil when not ready, not nil when ready
+	XMLName                xml.Name    `xml:"result" json:"-"`
+	Name                   string      `xml:"name"`
+	WUName                 string      `xml:"wu_name"`
+	Platform               string      `xml:"platform"`
+	VersionNum             string      `xml:"version_num"`
+	PlanClass              string      `xml:"plan_class"`
+	ProjectUrl             string      `xml:"project_url"`
+	FinalCPUTime           float64     `xml:"final_cpu_time"`
+	FinalElapsedTime       float64     `xml:"final_elapsed_time"`
+	ExitStatus             string      `xml:"exit_status"`
+	State                  ResultState `xml:"state"`
+	ReportDeadline         float64     `xml:"report_deadline"`
+	ReceivedTime           float64     `xml:"received_time"`
+	EstimatedTimeRemaining float64     `xml:"estimated_cpu_time_remaining"`
+	Activetask             ActiveTask  `xml:"active_task"`
+	ReadyToReport          *struct{}   `xml:"ready_to_report"` // is nil when not ready, not nil when ready
+	SuspendedViaGui        *struct{}   `xml:"suspended_via_gui"`
+	ProjectSuspendedViaGui *struct{}   `xml:"project_suspended_via_gui"`
 
 	//
 	// own attributed computed when loaded (e.g. convert timestamps to text)
 	//
-	IsFinished                     bool
-	EstimatedTimeRemainingAsString string
-	FractionDoneAsString           string
+	IsFinished                     bool   `xml:"-"`
+	EstimatedTimeRemainingAsString string `xml:"-"`
+	FractionDoneAsString           string `xml:"-"`
 }
 
 type ActiveTask struct {
-	XMLName           xml.Name `xml:"active_task"`
-	TaskState         int      `xml:"active_task_state"`
-	CheckpointCPUTime float64  `xml:"checkpoint_cpu_time"`
-	FractionDone      float64  `xml:"fraction_done"`
-	CurrentCPUTime    float64  `xml:"current_cpu_time"`
-	ElapsedTime       float64  `xml:"elapsed_time"`
-	WorkingSetSize    float64  `xml:"working_set_size"`
-	ProgressRate      float64  `xml:"progress_rate"`
+	XMLName           xml.Name       `xml:"active_task" json:"-"`
+	TaskState         TaskState      `xml:"active_task_state"`
+	SchedulerState    SchedulerState `xml:"scheduler_state"`
+	CheckpointCPUTime float64        `xml:"checkpoint_cpu_time"`
+	FractionDone      float64        `xml:"fraction_done"`
+	CurrentCPUTime    float64        `xml:"current_cpu_time"`
+	ElapsedTime       float64        `xml:"elapsed_time"`
+	WorkingSetSize    float64        `xml:"working_set_size"`
+	ProgressRate      float64        `xml:"progress_rate"`
 }
 
 type App struct {
-	XMLName          xml.Name `xml:"app"`
+	XMLName          xml.Name `xml:"app" json:"-"`
 	Name             string   `xml:"name"`
 	UserFriendlyName string   `xml:"user_friendly_name"`
 	NonCpuIntensive  int      `xml:"non_cpu_intensive"`
 }
 
 type AppVersion struct {
-	XMLName    xml.Name `xml:"app_version"`
-	AppName    string   `xml:"app_name"`
-	VersionNum int      `xml:"version_num"`
-	Platform   string   `xml:"platform"`
-	AvgNcpus   float64  `xml:"avg_ncpus"`
-	Flops      float64  `xml:"flops"`
-	APIVersion string   `xml:"api_version"`
+	XMLName    xml.Name           `xml:"app_version" json:"-"`
+	AppName    string             `xml:"app_name"`
+	VersionNum int                `xml:"version_num"`
+	Platform   string             `xml:"platform"`
+	PlanClass  string             `xml:"plan_class"`
+	AvgNcpus   float64            `xml:"avg_ncpus"`
+	Flops      float64            `xml:"flops"`
+	APIVersion string             `xml:"api_version"`
+	Coprocs    []AppVersionCoproc `xml:"coproc"`
+	GpuRam     float64            `xml:"gpu_ram"`
+}
+
+// coprocessor (GPU) usage of an app version
+type AppVersionCoproc struct {
+	Type  string  `xml:"type"` // e.g. NVIDIA, ATI, intel_gpu
+	Count float64 `xml:"count"`
 }
 
 type WorkUnit struct {
-	XMLName        xml.Name `xml:"workunit"`
+	XMLName        xml.Name `xml:"workunit" json:"-"`
 	Name           string   `xml:"name"`
 	AppName        string   `xml:"app_name"`
 	RscFpopsEst    float64  `xml:"rsc_fpops_est"`
@@ -142,7 +176,7 @@ type WorkUnit struct {
 }
 
 type HostInfo struct {
-	XMLName        xml.Name `xml:"host_info"`
+	XMLName        xml.Name `xml:"host_info" json:"-"`
 	Timezone       string   `xml:"timezone"`
 	DomainName     string   `xml:"domain_name"`
 	IPAddr         string   `xml:"ip_addr"`
@@ -165,11 +199,59 @@ type HostInfo struct {
 	OSVersion      string   `xml:"os_version"`
 	NUsableCoprocs int8     `xml:"n_usable_coprocs"`
 	WslAvailable   int8     `xml:"wsl_available"`
-	// coprocs
+	Coprocs        Coprocs  `xml:"coprocs"`
+}
+
+//
+// Coprocessors (GPUs) of a host
+//
+// One entry per vendor as the client groups them, with the number of devices
+// and the description of the best one; Other has further OpenCL devices
+// (e.g. Apple GPUs) which name their type themselves
+//
+type Coprocs struct {
+	Cuda     []Coproc `xml:"coproc_cuda"`
+	Ati      []Coproc `xml:"coproc_ati"`
+	IntelGpu []Coproc `xml:"coproc_intel_gpu"`
+	Other    []Coproc `xml:"coproc"`
+}
+
+type Coproc struct {
+	Type          string  `xml:"type"` // only set for Other
+	Count         int     `xml:"count"`
+	Name          string  `xml:"name"`
+	AvailableRam  float64 `xml:"available_ram"`
+	PeakFlops     float64 `xml:"peak_flops"`
+	HaveCuda      int     `xml:"have_cuda"`
+	HaveCal       int     `xml:"have_cal"`
+	HaveOpenCL    int     `xml:"have_opencl"`
+	CudaVersion   int     `xml:"cudaVersion"` // e.g. 11040 for 11.4
+	DriverVersion int     `xml:"drvVersion"`  // NVIDIA, e.g. 47086 for 470.86
+	CALVersion    string  `xml:"CALVersion"`  // ATI
+	Version       string  `xml:"version"`     // Intel
+	DeviceNums    string  `xml:"device_nums"`
+
+	// the OpenCL view of the devices, under a tag of the vendor
+	NvidiaOpenCL []OpenCLDevice `xml:"nvidia_opencl"`
+	AtiOpenCL    []OpenCLDevice `xml:"ati_opencl"`
+	IntelOpenCL  []OpenCLDevice `xml:"intel_gpu_opencl"`
+	OtherOpenCL  []OpenCLDevice `xml:"coproc_opencl"`
+}
+
+type OpenCLDevice struct {
+	Name              string  `xml:"name"`
+	Vendor            string  `xml:"vendor"`
+	DeviceNum         int     `xml:"device_num"`
+	GlobalMemSize     float64 `xml:"global_mem_size"`
+	MaxComputeUnits   int     `xml:"max_compute_units"`
+	MaxClockFrequency int     `xml:"max_clock_frequency"` // MHz
+	PlatformVersion   string  `xml:"opencl_platform_version"`
+	DeviceVersion     string  `xml:"opencl_device_version"`
+	DriverVersion     string  `xml:"opencl_driver_version"`
 }
 
 type NetStats struct {
-	XMLName     xml.Name `xml:"net_stats"`
+	XMLName     xml.Name `xml:"net_stats" json:"-"`
 	BWUp        float64  `xml:"bwup"`
 	AvgUp       float64  `xml:"avg_up"`
 	AvgTimeUp   float64  `xml:"avg_time_up"`
@@ -179,7 +261,7 @@ type NetStats struct {
 }
 
 type TimeStats struct {
-	XMLName                  xml.Name `xml:"time_stats"`
+	XMLName                  xml.Name `xml:"time_stats" json:"-"`
 	OnFrac                   float64  `xml:"on_frac"`
 	ConnectedFrac            float64  `xml:"connected_frac"`
 	CpuNetworkAvailableFrac  float64  `xml:"cpu_and_network_available_frac"`
@@ -200,7 +282,8 @@ type TimeStats struct {
 // Contain reduced state of a client (projects and results)
 //
 type simpleGuiInfo struct {
-	XMLName xml.Name `xml:"get_simple_gui_info"`
+	XMLName       xml.Name `xml:"boinc_gui_rpc_request"`
+	SimpleGuiInfo struct{} `xml:"get_simple_gui_info"`
 }
 
 type simpleGuiInfoReply struct {
@@ -215,7 +298,8 @@ type simpleGuiInfoReply struct {
 // Contain the entire state of a client
 //
 type GetState struct {
-	XMLName xml.Name `xml:"get_state"`
+	XMLName  xml.Name `xml:"boinc_gui_rpc_request"`
+	GetState struct{} `xml:"get_state"`
 }
 
 type ClientStateReply struct {
@@ -224,15 +308,410 @@ type ClientStateReply struct {
 		HostInfo  HostInfo  `xml:"host_info"`
 		NetStats  NetStats  `xml:"net_stats"`
 		TimeStats TimeStats `xml:"time_stats"`
-		// Coprocs
-		Projects    []Project    `xml:"project"`
+
+		Projects    Projects     `xml:"project"`
 		Apps        []App        `xml:"app"`
 		AppVersions []AppVersion `xml:"app_version"`
 		WorkUnits   []WorkUnit   `xml:"workunit"`
 		Results     Results      `xml:"result"`
+
+		PlatformName           string   `xml:"platform_name"`
+		Platforms              []string `xml:"platform"` // all the client can run apps for, the primary one first
+		CoreClientMajorVersion int      `xml:"core_client_major_version"`
+		CoreClientMinorVersion int      `xml:"core_client_minor_version"`
+		CoreClientRelease      int      `xml:"core_client_release"`
 	} `xml:"client_state"`
 }
 
+//
+// Results only, optionally restricted to those with an active task
+//
+type getResults struct {
+	XMLName    xml.Name `xml:"boinc_gui_rpc_request"`
+	ActiveOnly int      `xml:"get_results>active_only"`
+}
+
+type resultsReply struct {
+	XMLName xml.Name `xml:"boinc_gui_rpc_reply"`
+	Results Results  `xml:"results>result"`
+}
+
+//
+// Run modes and suspend reasons of a client
+//
+type getCCStatus struct {
+	XMLName     xml.Name `xml:"boinc_gui_rpc_request"`
+	GetCCStatus struct{} `xml:"get_cc_status"`
+}
+
+type CCStatus struct {
+	XMLName              xml.Name      `xml:"cc_status" json:"-"`
+	NetworkStatus        int           `xml:"network_status"`
+	AmsPasswordError     int           `xml:"ams_password_error"`
+	TaskSuspendReason    SuspendReason `xml:"task_suspend_reason"`
+	TaskMode             int           `xml:"task_mode"`
+	TaskModePerm         int           `xml:"task_mode_perm"`
+	TaskModeDelay        float64       `xml:"task_mode_delay"`
+	GpuSuspendReason     SuspendReason `xml:"gpu_suspend_reason"`
+	GpuMode              int           `xml:"gpu_mode"`
+	GpuModePerm          int           `xml:"gpu_mode_perm"`
+	GpuModeDelay         float64       `xml:"gpu_mode_delay"`
+	NetworkSuspendReason SuspendReason `xml:"network_suspend_reason"`
+	NetworkMode          int           `xml:"network_mode"`
+	NetworkModePerm      int           `xml:"network_mode_perm"`
+	NetworkModeDelay     float64       `xml:"network_mode_delay"`
+	DisallowAttach       int           `xml:"disallow_attach"`
+	SimpleGuiOnly        int           `xml:"simple_gui_only"`
+	MaxEventLogLines     int           `xml:"max_event_log_lines"`
+}
+
+type ccStatusReply struct {
+	XMLName  xml.Name `xml:"boinc_gui_rpc_reply"`
+	CCStatus CCStatus `xml:"cc_status"`
+}
+
+//
+// Disk usage of the projects, and how much BOINC may use
+//
+type getDiskUsage struct {
+	XMLName      xml.Name `xml:"boinc_gui_rpc_request"`
+	GetDiskUsage struct{} `xml:"get_disk_usage"`
+}
+
+type DiskUsage struct {
+	XMLName  xml.Name           `xml:"disk_usage_summary" json:"-"`
+	Projects []ProjectDiskUsage `xml:"project"`
+	DTotal   float64            `xml:"d_total"`
+	DFree    float64            `xml:"d_free"`
+	DBoinc   float64            `xml:"d_boinc"`   // BOINC's own files, without the projects
+	DAllowed float64            `xml:"d_allowed"` // what BOINC may use in all after the disk preferences
+}
+
+type ProjectDiskUsage struct {
+	MasterUrl string  `xml:"master_url"`
+	DiskUsage float64 `xml:"disk_usage"`
+}
+
+type diskUsageReply struct {
+	XMLName   xml.Name  `xml:"boinc_gui_rpc_reply"`
+	DiskUsage DiskUsage `xml:"disk_usage_summary"`
+	Error     string    `xml:"error"`
+}
+
+//
+// File transfers (uploads and downloads) waiting or in progress
+//
+type getFileTransfers struct {
+	XMLName          xml.Name `xml:"boinc_gui_rpc_request"`
+	GetFileTransfers struct{} `xml:"get_file_transfers"`
+}
+
+type FileTransfer struct {
+	XMLName            xml.Name           `xml:"file_transfer" json:"-"`
+	ProjectUrl         string             `xml:"project_url"`
+	ProjectName        string             `xml:"project_name"`
+	Name               string             `xml:"name"`
+	NBytes             float64            `xml:"nbytes"`
+	MaxNBytes          float64            `xml:"max_nbytes"`
+	Status             int                `xml:"status"` // negative: error code
+	PersistentFileXfer PersistentFileXfer `xml:"persistent_file_xfer"`
+	FileXfer           *FileXfer          `xml:"file_xfer"`       // is nil unless transferring right now
+	ProjectBackoff     float64            `xml:"project_backoff"` // seconds the project holds back all transfers
+}
+
+// PersistentFileXfer is the transfer across its retries
+type PersistentFileXfer struct {
+	NumRetries       int     `xml:"num_retries"`
+	FirstRequestTime float64 `xml:"first_request_time"`
+	NextRequestTime  float64 `xml:"next_request_time"`
+	TimeSoFar        float64 `xml:"time_so_far"`
+	LastBytesXferred float64 `xml:"last_bytes_xferred"`
+	IsUpload         int     `xml:"is_upload"`
+}
+
+// FileXfer is the attempt running right now
+type FileXfer struct {
+	BytesXferred float64 `xml:"bytes_xferred"`
+	FileOffset   float64 `xml:"file_offset"`
+	XferSpeed    float64 `xml:"xfer_speed"`
+	Url          string  `xml:"url"`
+}
+
+type fileTransfersReply struct {
+	XMLName       xml.Name       `xml:"boinc_gui_rpc_reply"`
+	FileTransfers []FileTransfer `xml:"file_transfers>file_transfer"`
+	Error         string         `xml:"error"`
+}
+
+type retryFileTransfer struct {
+	XMLName    xml.Name `xml:"boinc_gui_rpc_request"`
+	ProjectUrl string   `xml:"retry_file_transfer>project_url"`
+	Filename   string   `xml:"retry_file_transfer>filename"`
+}
+
+type abortFileTransfer struct {
+	XMLName    xml.Name `xml:"boinc_gui_rpc_request"`
+	ProjectUrl string   `xml:"abort_file_transfer>project_url"`
+	Filename   string   `xml:"abort_file_transfer>filename"`
+}
+
+//
+// Computing preferences: the working ones (web preferences and the override
+// merged) and the local override of the host
+//
+type getGlobalPrefsWorking struct {
+	XMLName               xml.Name `xml:"boinc_gui_rpc_request"`
+	GetGlobalPrefsWorking struct{} `xml:"get_global_prefs_working"`
+}
+
+type getGlobalPrefsOverride struct {
+	XMLName                xml.Name `xml:"boinc_gui_rpc_request"`
+	GetGlobalPrefsOverride struct{} `xml:"get_global_prefs_override"`
+}
+
+type setGlobalPrefsOverride struct {
+	XMLName xml.Name      `xml:"boinc_gui_rpc_request"`
+	Prefs   PrefsOverride `xml:"set_global_prefs_override>global_preferences"`
+}
+
+// clearGlobalPrefsOverride is set_global_prefs_override without preferences, which removes the override file
+type clearGlobalPrefsOverride struct {
+	XMLName                xml.Name `xml:"boinc_gui_rpc_request"`
+	SetGlobalPrefsOverride struct{} `xml:"set_global_prefs_override"`
+}
+
+type readGlobalPrefsOverride struct {
+	XMLName                 xml.Name `xml:"boinc_gui_rpc_request"`
+	ReadGlobalPrefsOverride struct{} `xml:"read_global_prefs_override"`
+}
+
+type GlobalPrefs struct {
+	XMLName                    xml.Name   `xml:"global_preferences" json:"-"`
+	SourceProject              string     `xml:"source_project,omitempty"`
+	ModTime                    float64    `xml:"mod_time,omitempty"`
+	RunOnBatteries             int        `xml:"run_on_batteries"`
+	RunIfUserActive            int        `xml:"run_if_user_active"`
+	RunGpuIfUserActive         int        `xml:"run_gpu_if_user_active"`
+	IdleTimeToRun              float64    `xml:"idle_time_to_run"`  // minutes
+	SuspendCpuUsage            float64    `xml:"suspend_cpu_usage"` // percent of non-BOINC CPU usage
+	StartHour                  float64    `xml:"start_hour"`        // computing allowed from, equal to EndHour: always
+	EndHour                    float64    `xml:"end_hour"`
+	NetStartHour               float64    `xml:"net_start_hour"` // network allowed from, equal to NetEndHour: always
+	NetEndHour                 float64    `xml:"net_end_hour"`
+	LeaveAppsInMemory          int        `xml:"leave_apps_in_memory"`
+	WorkBufMinDays             float64    `xml:"work_buf_min_days"`
+	WorkBufAdditionalDays      float64    `xml:"work_buf_additional_days"`
+	MaxNCpusPct                float64    `xml:"max_ncpus_pct"` // percent of the CPUs to use
+	CpuSchedulingPeriodMinutes float64    `xml:"cpu_scheduling_period_minutes"`
+	DiskInterval               float64    `xml:"disk_interval"`
+	DiskMaxUsedGB              float64    `xml:"disk_max_used_gb"`  // 0: no limit
+	DiskMaxUsedPct             float64    `xml:"disk_max_used_pct"` // of the disk
+	DiskMinFreeGB              float64    `xml:"disk_min_free_gb"`
+	VmMaxUsedPct               float64    `xml:"vm_max_used_pct"`
+	RamMaxUsedBusyPct          float64    `xml:"ram_max_used_busy_pct"` // while the computer is in use
+	RamMaxUsedIdlePct          float64    `xml:"ram_max_used_idle_pct"` // while it is not
+	MaxBytesSecUp              float64    `xml:"max_bytes_sec_up"`      // 0: no limit
+	MaxBytesSecDown            float64    `xml:"max_bytes_sec_down"`
+	CpuUsageLimit              float64    `xml:"cpu_usage_limit"` // percent of the CPU time
+	DailyXferLimitMB           float64    `xml:"daily_xfer_limit_mb"`
+	DailyXferPeriodDays        int        `xml:"daily_xfer_period_days"`
+	DayPrefs                   []DayPrefs `xml:"day_prefs"`
+}
+
+// DayPrefs are the hours of one day of the week which differ from the general ones
+type DayPrefs struct {
+	DayOfWeek    int     `xml:"day_of_week"` // 0: Sunday
+	StartHour    float64 `xml:"start_hour"`
+	EndHour      float64 `xml:"end_hour"`
+	NetStartHour float64 `xml:"net_start_hour"`
+	NetEndHour   float64 `xml:"net_end_hour"`
+}
+
+// PrefsOverride
+//
+// The override file of a host element by element, as it sets only some of
+// the preferences: the others still come from the web preferences
+type PrefsOverride struct {
+	XMLName  xml.Name       `xml:"global_preferences"`
+	Elements []PrefsElement `xml:",any"`
+}
+
+// PrefsElement is one preference of the override, e.g. <cpu_usage_limit>80</cpu_usage_limit>
+type PrefsElement struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// set replaces the preference name of the override, or adds it
+func (override *PrefsOverride) set(name string, value string) {
+	for idx := range override.Elements {
+		if override.Elements[idx].XMLName.Local == name {
+			override.Elements[idx].Inner = value
+			return
+		}
+	}
+	override.Elements = append(override.Elements, PrefsElement{XMLName: xml.Name{Local: name}, Inner: value})
+}
+
+// apply sets the preferences of the override on prefs; its days replace those of prefs
+func (override PrefsOverride) apply(prefs *GlobalPrefs) error {
+	text, err := xml.Marshal(override)
+	if err != nil {
+		return err
+	}
+	for _, element := range override.Elements {
+		if element.XMLName.Local == "day_prefs" {
+			prefs.DayPrefs = nil
+			break
+		}
+	}
+	return xml.Unmarshal(text, prefs)
+}
+
+type prefsOverrideReply struct {
+	XMLName xml.Name       `xml:"boinc_gui_rpc_reply"`
+	Prefs   *PrefsOverride `xml:"global_preferences"`
+	Error   string         `xml:"error,omitempty"`
+}
+
+type globalPrefsReply struct {
+	XMLName xml.Name     `xml:"boinc_gui_rpc_reply"`
+	Prefs   *GlobalPrefs `xml:"global_preferences"`
+	Error   string       `xml:"error,omitempty"`
+}
+
+//
+// Projects a host can attach to, from all_projects_list.xml of the client
+//
+type getAllProjectsList struct {
+	XMLName            xml.Name `xml:"boinc_gui_rpc_request"`
+	GetAllProjectsList struct{} `xml:"get_all_projects_list"`
+}
+
+type ProjectListEntry struct {
+	Name         string   `xml:"name"`
+	Url          string   `xml:"url"`
+	GeneralArea  string   `xml:"general_area"`
+	SpecificArea string   `xml:"specific_area"`
+	Description  string   `xml:"description"`
+	Home         string   `xml:"home"`
+	Platforms    []string `xml:"platforms>name"`
+	Image        string   `xml:"image"`
+	Summary      string   `xml:"summary"`
+}
+
+type allProjectsListReply struct {
+	XMLName  xml.Name           `xml:"boinc_gui_rpc_reply"`
+	Projects []ProjectListEntry `xml:"projects>project"`
+	Error    string             `xml:"error"`
+}
+
+//
+// Accounts and attaching: lookup_account and project_attach only start the
+// work, the client reports the outcome on lookup_account_poll and
+// project_attach_poll once the project answered
+//
+type lookupAccount struct {
+	XMLName    xml.Name `xml:"boinc_gui_rpc_request"`
+	Url        string   `xml:"lookup_account>url"`
+	EmailAddr  string   `xml:"lookup_account>email_addr"`
+	PasswdHash string   `xml:"lookup_account>passwd_hash"`
+	LdapAuth   int      `xml:"lookup_account>ldap_auth"`
+}
+
+type lookupAccountPoll struct {
+	XMLName           xml.Name `xml:"boinc_gui_rpc_request"`
+	LookupAccountPoll struct{} `xml:"lookup_account_poll"`
+}
+
+type accountOutReply struct {
+	XMLName       xml.Name `xml:"boinc_gui_rpc_reply"`
+	ErrorNum      int      `xml:"account_out>error_num"`
+	ErrorMsg      string   `xml:"account_out>error_msg"`
+	Authenticator string   `xml:"account_out>authenticator"`
+	Error         string   `xml:"error"`
+}
+
+type projectAttach struct {
+	XMLName       xml.Name `xml:"boinc_gui_rpc_request"`
+	ProjectUrl    string   `xml:"project_attach>project_url"`
+	Authenticator string   `xml:"project_attach>authenticator"`
+	ProjectName   string   `xml:"project_attach>project_name"`
+}
+
+type projectAttachPoll struct {
+	XMLName           xml.Name `xml:"boinc_gui_rpc_request"`
+	ProjectAttachPoll struct{} `xml:"project_attach_poll"`
+}
+
+type projectAttachReply struct {
+	XMLName  xml.Name `xml:"boinc_gui_rpc_reply"`
+	ErrorNum int      `xml:"project_attach_reply>error_num"`
+	Messages []string `xml:"project_attach_reply>message"`
+	Error    string   `xml:"error"`
+}
+
+type projectDetach struct {
+	XMLName    xml.Name `xml:"boinc_gui_rpc_request"`
+	ProjectUrl string   `xml:"project_detach>project_url"`
+}
+
+//
+// Maintenance of the client: benchmarks, network, configuration and updates
+//
+type runBenchmarks struct {
+	XMLName       xml.Name `xml:"boinc_gui_rpc_request"`
+	RunBenchmarks struct{} `xml:"run_benchmarks"`
+}
+
+type networkAvailable struct {
+	XMLName          xml.Name `xml:"boinc_gui_rpc_request"`
+	NetworkAvailable struct{} `xml:"network_available"`
+}
+
+type readCCConfig struct {
+	XMLName      xml.Name `xml:"boinc_gui_rpc_request"`
+	ReadCCConfig struct{} `xml:"read_cc_config"`
+}
+
+type quit struct {
+	XMLName xml.Name `xml:"boinc_gui_rpc_request"`
+	Quit    struct{} `xml:"quit"`
+}
+
+type getNewerVersion struct {
+	XMLName         xml.Name `xml:"boinc_gui_rpc_request"`
+	GetNewerVersion struct{} `xml:"get_newer_version"`
+}
+
+type newerVersionReply struct {
+	XMLName      xml.Name `xml:"boinc_gui_rpc_reply"`
+	NewerVersion string   `xml:"newer_version"` // empty when up to date
+	DownloadUrl  string   `xml:"download_url"`
+	Error        string   `xml:"error"`
+}
+
+type getHostInfo struct {
+	XMLName     xml.Name `xml:"boinc_gui_rpc_request"`
+	GetHostInfo struct{} `xml:"get_host_info"`
+}
+
+type hostInfoReply struct {
+	XMLName  xml.Name `xml:"boinc_gui_rpc_reply"`
+	HostInfo HostInfo `xml:"host_info"`
+	Error    string   `xml:"error"`
+}
+
+//
+// Reply to the requests which change something on the client
+//
+type actionReply struct {
+	XMLName      xml.Name  `xml:"boinc_gui_rpc_reply"`
+	Success      *struct{} `xml:"success"`
+	Error        string    `xml:"error"`
+	Unauthorized *struct{} `xml:"unauthorized"`
+}
+
 //
 //
 //
@@ -243,7 +722,13 @@ func (r Results) Swap(i, j int) {
 	r[i], r[j] = r[j], r[i]
 }
 func (r Results) Less(i, j int) bool {
-	return (r[i].EstimatedTimeRemaining < r[j].EstimatedTimeRemaining) && (r[i].WUName < r[j].WUName)
+	if r[i].EstimatedTimeRemaining != r[j].EstimatedTimeRemaining {
+		return r[i].EstimatedTimeRemaining < r[j].EstimatedTimeRemaining
+	}
+	if r[i].WUName != r[j].WUName {
+		return r[i].WUName < r[j].WUName
+	}
+	return r[i].Name < r[j].Name
 }
 
 //
@@ -255,12 +740,12 @@ const secMin = uint64(60)
 //
 // convertToDHMS
 //
-func convertToDHMS(secFloat float64) (day uint8, hour uint8, min uint8, sec uint8) {
+func convertToDHMS(secFloat float64) (day int, hour int, min int, sec int) {
 	remSec := uint64(math.Round(secFloat))
-	day = uint8(remSec / secDay)
-	hour = uint8((remSec % secDay) / secHour)
-	min = uint8((remSec % secHour) / secMin)
-	sec = uint8(remSec % secMin)
+	day = int(remSec / secDay)
+	hour = int((remSec % secDay) / secHour)
+	min = int((remSec % secHour) / secMin)
+	sec = int(remSec % secMin)
 
 	return day, hour, min, sec
 }
@@ -269,20 +754,31 @@ func convertToDHMS(secFloat float64) (day uint8, hour uint8, min uint8, sec uint
 // convertResultToDHMS
 //
 func convertResultToDHMS(result *Result) {
-	days, hours, mins, secs := convertToDHMS(result.EstimatedTimeRemaining)
+	result.EstimatedTimeRemainingAsString = formatDHMS(result.EstimatedTimeRemaining)
+}
+
+//
+// formatDHMS
+//
+// seconds as text, e.g. "1d 2h:3m:4s"; negative durations get a leading "-"
+//
+func formatDHMS(secFloat float64) string {
+	sign := ""
+	if secFloat < 0 {
+		sign = "-"
+		secFloat = -secFloat
+	}
+	days, hours, mins, secs := convertToDHMS(secFloat)
 	if days == 0 {
 		if hours == 0 {
 			if mins == 0 {
-				result.EstimatedTimeRemainingAsString = fmt.Sprintf("%ds", secs)
-			} else {
-				result.EstimatedTimeRemainingAsString = fmt.Sprintf("%dm:%ds", mins, secs)
+				return fmt.Sprintf("%s%ds", sign, secs)
 			}
-		} else {
-			result.EstimatedTimeRemainingAsString = fmt.Sprintf("%dh:%dm:%ds", hours, mins, secs)
+			return fmt.Sprintf("%s%dm:%ds", sign, mins, secs)
 		}
-	} else {
-		result.EstimatedTimeRemainingAsString = fmt.Sprintf("%dd %dh:%dm:%ds", days, hours, mins, secs)
+		return fmt.Sprintf("%s%dh:%dm:%ds", sign, hours, mins, secs)
 	}
+	return fmt.Sprintf("%s%dd %dh:%dm:%ds", sign, days, hours, mins, secs)
 }
 
 //
@@ -299,51 +795,90 @@ func (client *BoincClient) flavor() string {
 //
 
 func (client *BoincClient) connect() error {
+	client.rpc.Lock()
+	defer client.rpc.Unlock()
+	return client.open()
+}
+
+//
+// method reconnect
+//
+// Drop the connection and open a new one, between two exchanges of the
+// poller; the poller goes on with the new connection
+//
+func (client *BoincClient) reconnect() error {
+	client.rpc.Lock()
+	defer client.rpc.Unlock()
+	_ = client.disconnect(nil)
+	return client.open()
+}
+
+// open connects and authorizes unless connected already; the caller holds rpc
+func (client *BoincClient) open() error {
 	var err error = nil
 
 	if client.Ip == "" || client.Port < 1024 {
-		return fmt.Errorf("invalid parameter for #{client.style()}")
+		client.stats.recordConnect(false)
+		return fmt.Errorf("invalid parameter for %s client %s", client.flavor(), client.Name)
 	}
 
-	adr := fmt.Sprintf("%s:%d", client.Ip, client.Port)
+	adr := net.JoinHostPort(client.Ip, strconv.Itoa(client.Port))
 
 	// if we have a connection, then jump back and leave it unchanged
-	if client.connection != nil {
+	if client.isConnected() {
 		return nil
 	}
 
-	client.ConnectionError = fmt.Errorf("connecting")
+	client.setConnectionError(fmt.Errorf("connecting"))
+	defer func() { client.stats.recordConnect(client.isConnected()) }()
 
 	if client.Refresh < 1 {
 		client.Refresh = 10
 	}
-	client.connection, err = net.DialTimeout("tcp", adr, 5*time.Second)
+	if client.SimpleRefresh < 1 {
+		client.SimpleRefresh = 60
+	}
+	if client.StateRefresh < 1 {
+		client.StateRefresh = 600
+	}
+	if client.DiskRefresh < 1 {
+		client.DiskRefresh = 600
+	}
+	// a new connection always starts with the full state, the poller sees to it
+	client.renewed.Store(true)
+	conn, err := net.DialTimeout("tcp", adr, 5*time.Second)
 
 	if err != nil {
-		client.ConnectionError = err
+		client.setConnectionError(err)
 		return err
 	}
+	client.setConnection(conn)
 
 	passkey := client.Pwd
 	authMsg := &auth1{}
 	if err := client.send(authMsg); err != nil {
-		err = client.disconnect(err)
-		return err
+		return client.disconnect(err)
 	}
 
 	nonceMsg := &nonce{}
-	_ = client.receive(nonceMsg)
+	if err := client.receive(nonceMsg); err != nil {
+		return client.disconnect(err)
+	}
 	password := nonceMsg.Nonce + passkey
 	calculated := md5.Sum([]byte(password))
 	var calculated2 = calculated[:]
 	if err := client.send(&auth2{NonceHash: hex.EncodeToString(calculated2)}); err != nil {
 		return client.disconnect(err)
 	}
-	if err := client.receive(nil); err != nil {
+	authMsg2 := &authReply{}
+	if err := client.receive(authMsg2); err != nil {
 		return client.disconnect(err)
 	}
+	if authMsg2.Authorized == nil {
+		return client.disconnect(fmt.Errorf("authorization failed for %s", adr))
+	}
 
-	client.ConnectionError = nil
+	client.setConnectionError(nil)
 
 	return err
 }
@@ -352,18 +887,17 @@ func (client *BoincClient) getConnection() *net.Conn {
 	return &client.connection
 }
 
-func (client *BoincClient) isConnected() bool {
-	return client.connection != nil
-}
-
 func (client *BoincClient) disconnect(errIn error) error {
-	client.ConnectionError = errIn
+	client.setConnectionError(errIn)
 
-	if client.connection == nil {
-		return nil
+	conn := client.setConnection(nil)
+	if conn == nil {
+		return errIn
+	}
+	err := conn.Close()
+	if errIn != nil {
+		return errIn
 	}
-	err := client.connection.Close()
-	client.connection = nil
 	return err
 }
 
@@ -374,71 +908,638 @@ func (client *BoincClient) disconnect(errIn error) error {
 //
 
 func (client *BoincClient) send(object interface{}) error {
+	conn, _ := client.conn()
+	if conn == nil {
+		return errNotConnected
+	}
 	enc, err := xml.MarshalIndent(object, "> ", "  ")
 	if err != nil {
-		_ = fmt.Errorf("Error marshaling: %v\n", err)
-		return err
-	} else {
-		// append the delimiter at the end as asked by the BOINC definition
-		enc2 := append(enc, 0x03)
-		_, err := fmt.Fprintf(client.connection, "%s", enc2)
-		if err != nil {
-			_ = fmt.Errorf("Error writing data to client: %v\n", err)
-		}
+		return fmt.Errorf("marshaling request: %w", err)
 	}
-	return err
+	client.logger().Debug("send", "data", string(enc))
+
+	// every request/reply exchange has to finish in time, otherwise the client is considered gone
+	_ = conn.SetDeadline(time.Now().Add(rpcTimeout))
+
+	// append the delimiter at the end as asked by the BOINC definition
+	enc2 := append(enc, 0x03)
+	if _, err = fmt.Fprintf(conn, "%s", enc2); err != nil {
+		return fmt.Errorf("writing to client: %w", err)
+	}
+	return nil
 }
 
 //
 // method receive
 // Parameter:	object  data object will be received
-// Result:		none
+// Result:		error 	read or unmarshal error, nil in case of success
 //
 func (client *BoincClient) receive(object interface{}) error {
-	message, _ := bufio.NewReader(client.connection).ReadString(0x03)
-	var err error = nil
+	_, reader := client.conn()
+	if reader == nil {
+		return errNotConnected
+	}
+	message, err := reader.ReadString(0x03)
+	if err != nil {
+		return err
+	}
 	if object != nil {
-		if client.Debug == true {
-			_, _ = fmt.Printf("%s\n", message)
-		}
+		client.logger().Debug("receive", "data", message)
 		err = xml.Unmarshal([]byte(message), object)
 		if err != nil {
-			err = fmt.Errorf("Error unmarshaling: %v\n", err)
+			err = fmt.Errorf("unmarshaling reply: %w", err)
 		}
 	}
+	client.stats.recordReceived(len(message), err)
 
 	return err
 }
 
+//
+// method call
+// Parameter:	request	what data object will be send
+//
+//	reply	data object will be received
+//
+// Result:		error 	error information or nil in case of success
+//
+func (client *BoincClient) call(request interface{}, reply interface{}) error {
+	client.rpc.Lock()
+	defer client.rpc.Unlock()
+
+	if err := client.send(request); err != nil {
+		return err
+	}
+	return client.receive(reply)
+}
+
+//
+// method action
+//
+// Send a request which changes something on the client; the client answers
+// with success or an error message
+//
+func (client *BoincClient) action(request interface{}) error {
+	reply := actionReply{}
+	if err := client.call(request, &reply); err != nil {
+		return err
+	}
+	switch {
+	case reply.Error != "":
+		return errors.New(reply.Error)
+	case reply.Unauthorized != nil:
+		return fmt.Errorf("not authorized")
+	case reply.Success == nil:
+		return fmt.Errorf("no success reported")
+	}
+	return nil
+}
+
+//
+// method poll
+//
+// Tiered polling: the full get_state on connect and every StateRefresh seconds,
+// get_simple_gui_info every SimpleRefresh seconds and in between only
+// get_cc_status and the active results; the cheaper replies are merged into
+// the cached ClientStateReply. The file transfers along with the simple gui
+// info, the computing preferences along with the full state, the disk usage
+// on connect and every DiskRefresh seconds, as the client has to walk its
+// directories for it
+//
+func (client *BoincClient) poll() error {
+	now := time.Now()
+
+	if client.renewed.Swap(false) {
+		client.lastState = time.Time{}
+		client.lastTransfers = time.Time{}
+		client.lastPrefs = time.Time{}
+		client.lastDisk = time.Time{}
+	}
+
+	if err := client.pollTasks(now); err != nil {
+		return err
+	}
+	if now.Sub(client.lastTransfers) >= time.Duration(client.SimpleRefresh)*time.Second {
+		if err := client.auxiliaryPoll("get_file_transfers", client.pollFileTransfers); err != nil {
+			return err
+		}
+		client.lastTransfers = now
+	}
+	if now.Sub(client.lastPrefs) >= time.Duration(client.StateRefresh)*time.Second {
+		if err := client.auxiliaryPoll("get_global_prefs_working", client.pollPrefs); err != nil {
+			return err
+		}
+		client.lastPrefs = now
+	}
+	if now.Sub(client.lastDisk) >= time.Duration(client.DiskRefresh)*time.Second {
+		if err := client.auxiliaryPoll("get_disk_usage", client.pollDiskUsage); err != nil {
+			return err
+		}
+		client.lastDisk = now
+	}
+	return nil
+}
+
+//
+// method auxiliaryPoll
+//
+// Run a poll the dashboard does without, like the disk usage: when it fails
+// the error is logged and the last value kept, only a broken connection fails
+// the whole poll
+//
+func (client *BoincClient) auxiliaryPoll(what string, poll func() error) error {
+	err := poll()
+	if err == nil || isConnectionError(err) {
+		return err
+	}
+	client.logger().Warn(what+" failed, keeping the last value", "error", err)
+	return nil
+}
+
+// pollTasks runs the tier of the state polls which is due
+func (client *BoincClient) pollTasks(now time.Time) error {
+	if now.Sub(client.lastState) >= time.Duration(client.StateRefresh)*time.Second {
+		return client.pollState(now)
+	}
+
+	if err := client.pollCCStatus(); err != nil {
+		return err
+	}
+
+	if now.Sub(client.lastSimple) >= time.Duration(client.SimpleRefresh)*time.Second {
+		return client.pollSimpleGuiInfo(now)
+	}
+	return client.pollActiveResults()
+}
+
+// pollState fetches the entire client state
+func (client *BoincClient) pollState(now time.Time) error {
+	if err := client.refreshState(); err != nil {
+		return err
+	}
+	client.lastState = now
+	client.lastSimple = now
+	return nil
+}
+
+// refreshState fetches the entire client state, also outside of the poller
+func (client *BoincClient) refreshState() error {
+	reply := ClientStateReply{}
+	if err := client.call(&GetState{}, &reply); err != nil {
+		return err
+	}
+	prepareResults(reply.ClientState.Results)
+
+	client.mu.Lock()
+	client.ClientStateReply = reply
+	client.mu.Unlock()
+	return nil
+}
+
+// pollDiskUsage fetches the disk usage of the projects and what BOINC may use
+func (client *BoincClient) pollDiskUsage() error {
+	reply := diskUsageReply{}
+	if err := client.call(&getDiskUsage{}, &reply); err != nil {
+		return err
+	}
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+
+	client.mu.Lock()
+	client.DiskUsage = reply.DiskUsage
+	client.mu.Unlock()
+	return nil
+}
+
+// pollFileTransfers fetches the uploads and downloads waiting or in progress
+func (client *BoincClient) pollFileTransfers() error {
+	reply := fileTransfersReply{}
+	if err := client.call(&getFileTransfers{}, &reply); err != nil {
+		return err
+	}
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+
+	client.mu.Lock()
+	client.FileTransfers = reply.FileTransfers
+	client.mu.Unlock()
+	return nil
+}
+
+// retryFileTransfer starts a waiting transfer right away
+func (client *BoincClient) retryFileTransfer(projectUrl string, filename string) error {
+	return client.action(&retryFileTransfer{ProjectUrl: projectUrl, Filename: filename})
+}
+
+// abortFileTransfer gives up a transfer; the task it belongs to fails
+func (client *BoincClient) abortFileTransfer(projectUrl string, filename string) error {
+	return client.action(&abortFileTransfer{ProjectUrl: projectUrl, Filename: filename})
+}
+
+// pollPrefs fetches the working computing preferences and the override of the host
+func (client *BoincClient) pollPrefs() error {
+	working := globalPrefsReply{}
+	if err := client.call(&getGlobalPrefsWorking{}, &working); err != nil {
+		return err
+	}
+	if working.Prefs == nil {
+		return fmt.Errorf("get_global_prefs_working: %s", working.Error)
+	}
+	// without an override file the client answers with an error
+	override := prefsOverrideReply{}
+	if err := client.call(&getGlobalPrefsOverride{}, &override); err != nil {
+		return err
+	}
+	var overridden *GlobalPrefs
+	if override.Prefs != nil {
+		overridden = &GlobalPrefs{}
+		if err := override.Prefs.apply(overridden); err != nil {
+			return fmt.Errorf("get_global_prefs_override: %w", err)
+		}
+	}
+
+	client.mu.Lock()
+	client.GlobalPrefs = *working.Prefs
+	client.PrefsOverride = overridden
+	client.overrideFile = override.Prefs
+	client.mu.Unlock()
+	return nil
+}
+
+// prefsOverride returns a copy of the override file of the host, an empty one without
+func (client *BoincClient) prefsOverride() PrefsOverride {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	if client.overrideFile == nil {
+		return PrefsOverride{}
+	}
+	return PrefsOverride{Elements: append([]PrefsElement(nil), client.overrideFile.Elements...)}
+}
+
+// setPrefsOverride writes the override file of the host and makes the client read it
+func (client *BoincClient) setPrefsOverride(override PrefsOverride) error {
+	if err := client.action(&setGlobalPrefsOverride{Prefs: override}); err != nil {
+		return err
+	}
+	return client.action(&readGlobalPrefsOverride{})
+}
+
+// clearPrefsOverride removes the override file; the web preferences apply again
+func (client *BoincClient) clearPrefsOverride() error {
+	if err := client.action(&clearGlobalPrefsOverride{}); err != nil {
+		return err
+	}
+	return client.action(&readGlobalPrefsOverride{})
+}
+
+// errInProgress is ERR_IN_PROGRESS of the client: the project did not answer yet
+const errInProgress = -204
+
+// attachPollInterval is the pause between two polls for the outcome of lookup_account or project_attach
+var attachPollInterval = time.Second
+
+// attachTimeout limits how long the project may take to answer
+const attachTimeout = 2 * time.Minute
+
+// allProjectsList fetches the projects the client knows of
+func (client *BoincClient) allProjectsList() ([]ProjectListEntry, error) {
+	reply := allProjectsListReply{}
+	if err := client.call(&getAllProjectsList{}, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	return reply.Projects, nil
+}
+
+//
+// method lookupAccount
+//
+// Ask the project at url for the account key (authenticator) of the account
+// with email and password; the client sends only the hash of both
+//
+func (client *BoincClient) lookupAccount(url string, email string, password string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	hash := md5.Sum([]byte(password + email))
+	if err := client.action(&lookupAccount{Url: url, EmailAddr: email, PasswdHash: hex.EncodeToString(hash[:])}); err != nil {
+		return "", err
+	}
+
+	for deadline := time.Now().Add(attachTimeout); ; {
+		reply := accountOutReply{}
+		if err := client.call(&lookupAccountPoll{}, &reply); err != nil {
+			return "", err
+		}
+		switch {
+		case reply.Error != "":
+			return "", errors.New(reply.Error)
+		case reply.ErrorNum == errInProgress:
+			if time.Now().After(deadline) {
+				return "", fmt.Errorf("no answer from the project")
+			}
+			time.Sleep(attachPollInterval)
+		case reply.ErrorNum != 0:
+			return "", fmt.Errorf("error %d %s", reply.ErrorNum, reply.ErrorMsg)
+		case reply.Authenticator == "":
+			return "", fmt.Errorf("no account key in the answer")
+		default:
+			return reply.Authenticator, nil
+		}
+	}
+}
+
+//
+// method attachProject
+//
+// Attach the client to the project at url with the account key and wait
+// until the project answered
+//
+func (client *BoincClient) attachProject(url string, name string, authenticator string) error {
+	if err := client.action(&projectAttach{ProjectUrl: url, Authenticator: authenticator, ProjectName: name}); err != nil {
+		return err
+	}
+
+	for deadline := time.Now().Add(attachTimeout); ; {
+		reply := projectAttachReply{}
+		if err := client.call(&projectAttachPoll{}, &reply); err != nil {
+			return err
+		}
+		switch {
+		case reply.Error != "":
+			return errors.New(reply.Error)
+		case reply.ErrorNum == errInProgress:
+			if time.Now().After(deadline) {
+				return fmt.Errorf("no answer from the project")
+			}
+			time.Sleep(attachPollInterval)
+		case reply.ErrorNum != 0:
+			return fmt.Errorf("error %d %s", reply.ErrorNum, strings.Join(reply.Messages, " "))
+		default:
+			return nil
+		}
+	}
+}
+
+// detachProject removes the project from the client, with all its tasks
+func (client *BoincClient) detachProject(url string) error {
+	return client.action(&projectDetach{ProjectUrl: url})
+}
+
+// benchmarkPollInterval is the pause between two looks whether the benchmarks finished
+var benchmarkPollInterval = 5 * time.Second
+
+// benchmarkTimeout limits how long the benchmarks may take; on a Pi about a minute
+const benchmarkTimeout = 10 * time.Minute
+
+// hostInfo fetches the host info alone and keeps it, e.g. for new benchmark results
+func (client *BoincClient) hostInfo() (HostInfo, error) {
+	reply := hostInfoReply{}
+	if err := client.call(&getHostInfo{}, &reply); err != nil {
+		return HostInfo{}, err
+	}
+	if reply.Error != "" {
+		return HostInfo{}, errors.New(reply.Error)
+	}
+
+	client.mu.Lock()
+	// get_host_info knows no coprocessors
+	reply.HostInfo.Coprocs = client.ClientStateReply.ClientState.HostInfo.Coprocs
+	client.ClientStateReply.ClientState.HostInfo = reply.HostInfo
+	client.mu.Unlock()
+	return reply.HostInfo, nil
+}
+
+//
+// method runBenchmarks
+//
+// Run the CPU benchmarks and wait until they are done, that is until the
+// client has new benchmark results (p_calculated); progress is told the
+// seconds waited so far
+//
+func (client *BoincClient) runBenchmarks(progress func(string)) (HostInfo, error) {
+	before, err := client.hostInfo()
+	if err != nil {
+		return HostInfo{}, err
+	}
+	if err := client.action(&runBenchmarks{}); err != nil {
+		return HostInfo{}, err
+	}
+
+	start := time.Now()
+	for time.Since(start) < benchmarkTimeout {
+		time.Sleep(benchmarkPollInterval)
+		info, err := client.hostInfo()
+		if err != nil {
+			return HostInfo{}, err
+		}
+		if info.PCalculated > before.PCalculated {
+			return info, nil
+		}
+		progress(fmt.Sprintf("benchmarking for %s", formatDHMS(math.Round(time.Since(start).Seconds()))))
+	}
+	return HostInfo{}, fmt.Errorf("no benchmark results after %s", benchmarkTimeout)
+}
+
+// networkAvailable makes the client retry its transfers and scheduler requests now
+func (client *BoincClient) networkAvailable() error {
+	return client.action(&networkAvailable{})
+}
+
+// readCCConfig makes the client read cc_config.xml again
+func (client *BoincClient) readCCConfig() error {
+	return client.action(&readCCConfig{})
+}
+
+// quit stops the client; it does not come back until started on the host
+func (client *BoincClient) quit() error {
+	return client.action(&quit{})
+}
+
+// newerVersion asks the client whether a newer BOINC is out; empty when up to date
+func (client *BoincClient) newerVersion() (string, string, error) {
+	reply := newerVersionReply{}
+	if err := client.call(&getNewerVersion{}, &reply); err != nil {
+		return "", "", err
+	}
+	if reply.Error != "" {
+		return "", "", errors.New(reply.Error)
+	}
+	return reply.NewerVersion, reply.DownloadUrl, nil
+}
+
+// pollCCStatus fetches run modes and suspend reasons
+func (client *BoincClient) pollCCStatus() error {
+	reply := ccStatusReply{}
+	if err := client.call(&getCCStatus{}, &reply); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	client.CCStatus = reply.CCStatus
+	client.mu.Unlock()
+	return nil
+}
+
+// pollSimpleGuiInfo replaces projects and results of the cached state
+func (client *BoincClient) pollSimpleGuiInfo(now time.Time) error {
+	reply := simpleGuiInfoReply{}
+	if err := client.call(&simpleGuiInfo{}, &reply); err != nil {
+		return err
+	}
+	prepareResults(reply.SimpleGuiInfo.Results)
+
+	client.mu.Lock()
+	state := client.ClientStateReply
+	// simple_gui_info carries the credits but not every project attribute
+	projects := make(Projects, len(state.ClientState.Projects))
+	copy(projects, state.ClientState.Projects)
+	for _, update := range reply.SimpleGuiInfo.Projects {
+		if idx := projects.index(update.MasterUrl); idx >= 0 {
+			projects[idx].UserTotalCredit = update.UserTotalCredit
+			projects[idx].UserAvgCredit = update.UserAvgCredit
+			projects[idx].HostTotalCredit = update.HostTotalCredit
+			projects[idx].HostAvgCredit = update.HostAvgCredit
+			projects[idx].NJobsSuccess = update.NJobsSuccess
+			projects[idx].NJobsError = update.NJobsError
+			projects[idx].ElapsedTime = update.ElapsedTime
+			projects[idx].SchedPriority = update.SchedPriority
+			projects[idx].Rec = update.Rec
+			projects[idx].ResourceShare = update.ResourceShare
+			projects[idx].SuspendedViaGui = update.SuspendedViaGui
+			projects[idx].DontRequestMoreWork = update.DontRequestMoreWork
+		} else {
+			projects = append(projects, update)
+			client.lastState = time.Time{}
+		}
+	}
+	state.ClientState.Projects = projects
+	state.ClientState.Results = reply.SimpleGuiInfo.Results
+	client.ClientStateReply = state
+	client.mu.Unlock()
+
+	client.lastSimple = now
+	client.requestStateForUnknownWorkUnits()
+	return nil
+}
+
+// pollActiveResults updates the results with an active task in the cached state
+func (client *BoincClient) pollActiveResults() error {
+	reply := resultsReply{}
+	if err := client.call(&getResults{ActiveOnly: 1}, &reply); err != nil {
+		return err
+	}
+	prepareResults(reply.Results)
+
+	client.mu.Lock()
+	state := client.ClientStateReply
+	results := make(Results, len(state.ClientState.Results))
+	copy(results, state.ClientState.Results)
+
+	active := make(map[string]bool, len(reply.Results))
+	for _, update := range reply.Results {
+		active[update.Name] = true
+		if idx := results.index(update.Name); idx >= 0 {
+			results[idx] = update
+		} else {
+			// a task started we have not seen yet
+			results = append(results, update)
+			client.lastSimple = time.Time{}
+		}
+	}
+	for _, result := range results {
+		if result.Activetask.TaskState != 0 && !active[result.Name] {
+			// a task stopped running (finished, aborted, suspended), fetch all results next time
+			client.lastSimple = time.Time{}
+		}
+	}
+	sort.Sort(results)
+	state.ClientState.Results = results
+	client.ClientStateReply = state
+	client.mu.Unlock()
+
+	client.requestStateForUnknownWorkUnits()
+	return nil
+}
+
+// requestStateForUnknownWorkUnits schedules a full get_state when a result refers to a
+// workunit only get_state can tell about
+func (client *BoincClient) requestStateForUnknownWorkUnits() {
+	client.mu.RLock()
+	state := client.ClientStateReply.ClientState
+	client.mu.RUnlock()
+
+	known := make(map[string]bool, len(state.WorkUnits))
+	for _, workUnit := range state.WorkUnits {
+		known[workUnit.Name] = true
+	}
+	for _, result := range state.Results {
+		if !known[result.WUName] {
+			client.lastState = time.Time{}
+			return
+		}
+	}
+}
+
+// prepareResults sorts freshly received results and fills the computed attributes
+func prepareResults(results Results) {
+	sort.Sort(results)
+
+	for idx := range results {
+		var result = &results[idx]
+		// do some conversions once loaded
+		convertResultToDHMS(result)
+		result.FractionDoneAsString = fmt.Sprintf("%3.1f%%", 100*result.Activetask.FractionDone)
+		result.IsFinished = result.EstimatedTimeRemaining == 0
+	}
+}
+
+func (r Results) index(name string) int {
+	for idx := range r {
+		if r[idx].Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (p Projects) index(masterUrl string) int {
+	for idx := range p {
+		if p[idx].MasterUrl == masterUrl {
+			return idx
+		}
+	}
+	return -1
+}
+
 //
 // loadBoincStatusForClient
 //
-// loop for one BOINC client to load the actual state and fill internal structure
+// loop for one BOINC client to load the actual state and fill internal structure;
+// returns after a failed poll so the client gets connected again
 //
 func (client *BoincClient) loadState() {
 	for true {
-		if client.connection == nil {
+		// a reconnect from the web page holds rpc until the new connection is there
+		client.rpc.Lock()
+		connected := client.isConnected()
+		client.rpc.Unlock()
+		if !connected {
 			return
 		}
 
-		state := GetState{}
-		client.ClientStateReply = ClientStateReply{}
-		err := client.send(&state)
-		if err == nil {
-			err = client.receive(&client.ClientStateReply)
-			if err != nil {
-				fmt.Printf("%s\n", err)
-			}
-			sort.Sort(client.ClientStateReply.ClientState.Results)
-
-			for idx := range client.ClientStateReply.ClientState.Results {
-				var result = &client.ClientStateReply.ClientState.Results[idx]
-				// do some conversions once loaded
-				convertResultToDHMS(result)
-				result.FractionDoneAsString = fmt.Sprintf("%3.1f%%", 100*result.Activetask.FractionDone)
-				result.IsFinished = result.EstimatedTimeRemaining == 0
-			}
+		start := time.Now()
+		err := client.poll()
+		client.stats.recordPoll(start, err)
+		if err != nil {
+			client.logger().Warn("poll failed", "error", err)
+			_ = client.disconnect(err)
+			publishBoinc(client)
+			return
 		}
+		publishBoinc(client)
 
 		time.Sleep(time.Duration(client.Refresh) * time.Second)
 	}
@@ -453,6 +1554,7 @@ func loadBoincStats() {
 
 	// loop forever (in background) and fetch disconnected clients for reconnect
 	for true {
+		boincSweep.Store(time.Now().UnixNano())
 		// go over the list of clients
 		for idx := range dcClients.BOINCConfig.Clients {
 			// get the reference
@@ -463,21 +1565,20 @@ func loadBoincStats() {
 					// then open the connection
 					err := client.connect()
 					if err != nil {
-						fmt.Printf("connect %s client %s (%s), error %s\n", client.flavor(), client.Name, client.Ip, err)
+						client.logger().Warn("connect failed", "error", err)
 					}
-
-					// and if successful start loading the data in background
-					if client.isConnected() == true {
-						go func() {
-							client.loadState()
-						}()
-					} else {
+					if client.isConnected() == false {
 						_ = client.disconnect(err)
 					}
 				}
+
+				// and if connected make sure the data is loaded in background
+				if client.isConnected() == true {
+					client.startPolling(client.loadState)
+				}
 			}()
 		}
 		// wait a period of time and try the client list again to connect those not yet connected
-		time.Sleep(20 * time.Second)
+		time.Sleep(sweepInterval)
 	}
 }
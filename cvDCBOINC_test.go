@@ -0,0 +1,296 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoincConnectAndPoll(t *testing.T) {
+	server := startFakeBoinc(t, "remote")
+	client := newTestBoincClient(server, "remote")
+
+	if err := client.connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.disconnect(nil)
+	if client.ConnectionError != nil {
+		t.Fatalf("ConnectionError = %v", client.ConnectionError)
+	}
+
+	if err := client.poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	state := client.ClientStateReply.ClientState
+	if state.HostInfo.DomainName != "raspberrypiXX" || state.HostInfo.PnCPUs != 4 {
+		t.Errorf("host info = %+v", state.HostInfo)
+	}
+	if len(state.Projects) != 1 || state.Projects[0].ProjectName != "World Community Grid" {
+		t.Errorf("projects = %+v", state.Projects)
+	}
+	if len(state.Apps) != 2 || len(state.AppVersions) != 2 || len(state.WorkUnits) != 3 {
+		t.Errorf("apps/app versions/workunits = %d/%d/%d", len(state.Apps), len(state.AppVersions), len(state.WorkUnits))
+	}
+	if len(state.Results) != 3 {
+		t.Fatalf("results = %d, want 3", len(state.Results))
+	}
+
+	finished := 0
+	for _, result := range state.Results {
+		if result.IsFinished {
+			finished++
+			if result.ReadyToReport == nil {
+				t.Errorf("%s finished but not ready to report", result.Name)
+			}
+		}
+		if result.Name == "OPN1_0018725_04451_0" {
+			if result.FractionDoneAsString != "58.1%" || result.EstimatedTimeRemainingAsString != "1h:53m:37s" {
+				t.Errorf("converted %s = %q / %q", result.Name, result.FractionDoneAsString, result.EstimatedTimeRemainingAsString)
+			}
+		}
+	}
+	if finished != 1 {
+		t.Errorf("finished results = %d, want 1", finished)
+	}
+}
+
+func TestBoincWrongPassword(t *testing.T) {
+	server := startFakeBoinc(t, "remote")
+	client := newTestBoincClient(server, "wrong")
+
+	if err := client.connect(); err == nil {
+		t.Fatal("connect with wrong password succeeded")
+	}
+	if client.isConnected() {
+		t.Error("client still connected after failed authorization")
+	}
+	if client.ConnectionError == nil {
+		t.Error("ConnectionError not set after failed authorization")
+	}
+}
+
+func TestBoincUnreachable(t *testing.T) {
+	server := startFakeBoinc(t, "")
+	client := newTestBoincClient(server, "")
+	_ = server.Close()
+
+	if err := client.connect(); err == nil {
+		t.Fatal("connect to closed server succeeded")
+	}
+	if client.isConnected() {
+		t.Error("client connected to closed server")
+	}
+}
+
+func TestBoincReconnect(t *testing.T) {
+	server := startFakeBoinc(t, "remote")
+	client := newTestBoincClient(server, "remote")
+
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client restarts its RPC server: the next poll fails and loadState gives up the connection
+	server.dropConnections()
+	client.loadState()
+	if client.isConnected() {
+		t.Fatal("client still connected after the server dropped the connection")
+	}
+	if client.ConnectionError == nil {
+		t.Error("ConnectionError not set after a failed poll")
+	}
+	// the last good state stays visible until the next successful poll
+	if len(client.ClientStateReply.ClientState.Results) != 3 {
+		t.Error("cached state lost after a failed poll")
+	}
+
+	if err := client.connect(); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	defer client.disconnect(nil)
+	if err := client.poll(); err != nil {
+		t.Fatalf("poll after reconnect: %v", err)
+	}
+}
+
+// views are taken while the client connects and disconnects; meant for go test -race
+func TestBoincConnectWhileViewed(t *testing.T) {
+	server := startFakeBoinc(t, "")
+	client := newTestBoincClient(server, "")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for idx := 0; idx < 100; idx++ {
+			_ = client.view()
+			_ = client.isConnected()
+		}
+	}()
+	for idx := 0; idx < 5; idx++ {
+		if err := client.connect(); err != nil {
+			t.Fatal(err)
+		}
+		_ = client.disconnect(nil)
+	}
+	<-done
+	if client.isConnected() || client.view().ConnectionError != "" {
+		t.Errorf("connected %v, error %q", client.isConnected(), client.view().ConnectionError)
+	}
+}
+
+// a reconnect from the web page waits for the exchange of the poller, which goes on with the new connection
+func TestBoincReconnectWhilePolling(t *testing.T) {
+	server := startFakeBoinc(t, "remote")
+	client := newTestBoincClient(server, "remote")
+	client.Refresh = 1
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	client.startPolling(client.loadState)
+	// the sweep does not start a second poller
+	client.startPolling(func() { t.Error("second poller") })
+
+	for idx := 0; idx < 3; idx++ {
+		if err := client.reconnect(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for start := time.Now(); client.stats.snapshot().Polls < 2 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := client.stats.snapshot(); stats.Polls < 2 || stats.Failures != 0 || stats.Reconnects != 3 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	_ = client.disconnect(nil)
+	for start := time.Now(); client.polling.Load() && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.polling.Load() {
+		t.Error("poller still running without a connection")
+	}
+}
+
+func TestBoincTieredPolling(t *testing.T) {
+	// connect: full state, then only the cheap requests
+	server, client := polledTestBoinc(t)
+	for idx := 0; idx < 2; idx++ {
+		if err := client.poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// simple gui info is due
+	client.lastSimple = time.Time{}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+	// and the full state again
+	client.lastState = time.Time{}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"auth1", "auth2",
+		"get_state", "get_file_transfers", "get_global_prefs_working", "get_global_prefs_override", "get_disk_usage",
+		"get_cc_status", "get_results",
+		"get_cc_status", "get_results",
+		"get_cc_status", "get_simple_gui_info",
+		"get_state"}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestBoincMergeActiveResults(t *testing.T) {
+	_, client := polledTestBoinc(t)
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.CCStatus.NetworkStatus != 2 || client.CCStatus.TaskMode != 2 {
+		t.Errorf("cc status = %+v", client.CCStatus)
+	}
+	state := client.ClientStateReply.ClientState
+	if len(state.Results) != 3 || len(state.WorkUnits) != 3 || state.HostInfo.PnCPUs != 4 {
+		t.Fatalf("merged state lost data: %d results, %d workunits", len(state.Results), len(state.WorkUnits))
+	}
+	result := state.Results[state.Results.index("OPN1_0018725_04451_0")]
+	if result.Activetask.FractionDone != 0.588933 || result.FractionDoneAsString != "58.9%" {
+		t.Errorf("active result not updated: %+v", result.Activetask)
+	}
+	if client.lastState.IsZero() || client.lastSimple.IsZero() {
+		t.Error("merge of known results requested another full poll")
+	}
+}
+
+func TestBoincUnknownWorkUnitRequestsState(t *testing.T) {
+	server, client := polledTestBoinc(t)
+	// a result of a new workunit shows up, only get_state can tell about the workunit
+	server.setRecordedReply("get_results", strings.Replace(fixture(t, "boinc/get_results.xml"), "OPN1_0018725_04451", "OPN1_0099999_00001", -1))
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if !client.lastState.IsZero() {
+		t.Error("unknown workunit did not schedule a full get_state")
+	}
+	if len(client.ClientStateReply.ClientState.Results) != 4 {
+		t.Errorf("new result not merged, %d results", len(client.ClientStateReply.ClientState.Results))
+	}
+}
+
+func TestBoincStateCoprocsAndProjects(t *testing.T) {
+	// the host got GPUs since
+	server, client := polledTestBoinc(t)
+	server.setRecordedReply("get_state", fixture(t, "boinc/get_state_gpu.xml"))
+	client.lastState = time.Time{}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	state := client.ClientStateReply.ClientState
+	coprocs := state.HostInfo.Coprocs
+	if len(coprocs.Cuda) != 1 || len(coprocs.IntelGpu) != 1 || len(coprocs.Ati) != 0 || len(coprocs.Other) != 0 {
+		t.Fatalf("coprocs %+v", coprocs)
+	}
+	cuda := coprocs.Cuda[0]
+	if cuda.Count != 1 || cuda.Name != "NVIDIA GeForce RTX 3070" || cuda.CudaVersion != 11040 || cuda.DriverVersion != 47086 {
+		t.Errorf("cuda %+v", cuda)
+	}
+	if len(cuda.NvidiaOpenCL) != 1 || cuda.NvidiaOpenCL[0].MaxComputeUnits != 46 || cuda.NvidiaOpenCL[0].GlobalMemSize != 8366915584 {
+		t.Errorf("cuda opencl %+v", cuda.NvidiaOpenCL)
+	}
+	if intel := coprocs.IntelGpu[0]; intel.Version != "21.38.21026" || len(intel.IntelOpenCL) != 1 {
+		t.Errorf("intel %+v", intel)
+	}
+
+	if len(state.Projects) != 2 {
+		t.Fatalf("projects %+v", state.Projects)
+	}
+	einstein, wcg := state.Projects[0], state.Projects[1]
+	if einstein.DontRequestMoreWork == nil || einstein.SuspendedViaGui != nil || einstein.ResourceShare != 300 || einstein.Rec != 131580.221037 {
+		t.Errorf("einstein %+v", einstein)
+	}
+	if !reflect.DeepEqual(einstein.NoRscPref, []string{"intel_gpu"}) {
+		t.Errorf("no_rsc_pref %v", einstein.NoRscPref)
+	}
+	if len(einstein.GuiUrls) != 2 || einstein.GuiUrls[1].Name != "Forums" || einstein.GuiUrls[1].Url != "https://einsteinathome.org/community/forum" {
+		t.Errorf("gui urls %+v", einstein.GuiUrls)
+	}
+	if wcg.SuspendedViaGui == nil || wcg.DontRequestMoreWork != nil || len(wcg.GuiUrls) != 0 {
+		t.Errorf("wcg %+v", wcg)
+	}
+
+	// the platforms of the results and app versions stay with them
+	if state.PlatformName != "x86_64-pc-linux-gnu" || !reflect.DeepEqual(state.Platforms, []string{"x86_64-pc-linux-gnu", "i686-pc-linux-gnu"}) {
+		t.Errorf("platforms %q %v", state.PlatformName, state.Platforms)
+	}
+	if state.CoreClientMajorVersion != 7 || state.CoreClientMinorVersion != 18 || state.CoreClientRelease != 1 {
+		t.Errorf("version %d.%d.%d", state.CoreClientMajorVersion, state.CoreClientMinorVersion, state.CoreClientRelease)
+	}
+}
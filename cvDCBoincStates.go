@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+//
+// BOINC states
+//
+// The raw integers of the GUI RPC (see common_defs.h in the BOINC sources)
+// as typed values with a label for display, a key for URLs and the API and
+// a colour class for the HTML pages (table-<class>, bg-<class>).
+//
+
+// ResultState is the state of a result (RESULT_*)
+type ResultState int
+
+const (
+	ResultNew              ResultState = 0
+	ResultFilesDownloading ResultState = 1
+	ResultFilesDownloaded  ResultState = 2
+	ResultComputeError     ResultState = 3
+	ResultFilesUploading   ResultState = 4
+	ResultFilesUploaded    ResultState = 5
+	ResultAborted          ResultState = 6
+	ResultUploadFailed     ResultState = 7
+)
+
+// TaskState is the state of the process of an active task (PROCESS_*)
+type TaskState int
+
+const (
+	TaskUninitialized TaskState = 0
+	TaskExecuting     TaskState = 1
+	TaskExited        TaskState = 2
+	TaskWasSignaled   TaskState = 3
+	TaskExitUnknown   TaskState = 4
+	TaskAbortPending  TaskState = 5
+	TaskAborted       TaskState = 6
+	TaskCouldntStart  TaskState = 7
+	TaskQuitPending   TaskState = 8
+	TaskSuspended     TaskState = 9
+	TaskCopyPending   TaskState = 10
+)
+
+// SchedulerState tells whether the client scheduler wants an active task to run (CPU_SCHED_*)
+type SchedulerState int
+
+const (
+	SchedulerUninitialized SchedulerState = 0
+	SchedulerPreempted     SchedulerState = 1
+	SchedulerScheduled     SchedulerState = 2
+)
+
+// SuspendReason is why the client suspended computing, GPU or network (SUSPEND_REASON_*)
+type SuspendReason int
+
+const (
+	SuspendNone                SuspendReason = 0
+	SuspendBatteries           SuspendReason = 1
+	SuspendUserActive          SuspendReason = 2
+	SuspendUserRequest         SuspendReason = 4
+	SuspendTimeOfDay           SuspendReason = 8
+	SuspendBenchmarks          SuspendReason = 16
+	SuspendDiskSize            SuspendReason = 32
+	SuspendCPUThrottle         SuspendReason = 64
+	SuspendNoRecentInput       SuspendReason = 128
+	SuspendInitialDelay        SuspendReason = 256
+	SuspendExclusiveAppRunning SuspendReason = 512
+	SuspendCPUUsage            SuspendReason = 1024
+	SuspendNetworkQuota        SuspendReason = 2048
+	SuspendOS                  SuspendReason = 4096
+	SuspendWifiState           SuspendReason = 4097
+	SuspendBatteryCharging     SuspendReason = 4098
+	SuspendBatteryOverheated   SuspendReason = 4099
+	SuspendNoGuiKeepalive      SuspendReason = 4100
+)
+
+// TaskStatus is the status of a task as a whole, the way BOINC Manager shows it
+type TaskStatus int
+
+const (
+	StatusReadyToStart TaskStatus = iota
+	StatusRunning
+	StatusWaiting
+	StatusSuspended
+	StatusDownloading
+	StatusUploading
+	StatusReadyToReport
+	StatusError
+	StatusAborted
+	StatusUploadFailed
+)
+
+// stateInfo holds label, key and colour class of one state value
+type stateInfo struct {
+	label string
+	key   string
+	class string
+}
+
+var resultStates = map[ResultState]stateInfo{
+	ResultNew:              {"New", "new", "secondary"},
+	ResultFilesDownloading: {"Downloading", "downloading", "info"},
+	ResultFilesDownloaded:  {"Downloaded", "downloaded", "light"},
+	ResultComputeError:     {"Computation error", "compute_error", "danger"},
+	ResultFilesUploading:   {"Uploading", "uploading", "info"},
+	ResultFilesUploaded:    {"Uploaded", "uploaded", "success"},
+	ResultAborted:          {"Aborted", "aborted", "danger"},
+	ResultUploadFailed:     {"Upload failed", "upload_failed", "danger"},
+}
+
+var taskStates = map[TaskState]stateInfo{
+	TaskUninitialized: {"Uninitialized", "uninitialized", "light"},
+	TaskExecuting:     {"Executing", "executing", "primary"},
+	TaskExited:        {"Exited", "exited", "secondary"},
+	TaskWasSignaled:   {"Was signaled", "signaled", "danger"},
+	TaskExitUnknown:   {"Exit unknown", "exit_unknown", "danger"},
+	TaskAbortPending:  {"Abort pending", "abort_pending", "warning"},
+	TaskAborted:       {"Aborted", "aborted", "danger"},
+	TaskCouldntStart:  {"Couldn't start", "couldnt_start", "danger"},
+	TaskQuitPending:   {"Quit pending", "quit_pending", "warning"},
+	TaskSuspended:     {"Suspended", "suspended", "warning"},
+	TaskCopyPending:   {"Copy pending", "copy_pending", "info"},
+}
+
+var suspendReasons = map[SuspendReason]stateInfo{
+	SuspendNone:                {"", "none", "light"},
+	SuspendBatteries:           {"on batteries", "batteries", "warning"},
+	SuspendUserActive:          {"computer is in use", "user_active", "warning"},
+	SuspendUserRequest:         {"by user", "user_request", "warning"},
+	SuspendTimeOfDay:           {"time of day", "time_of_day", "warning"},
+	SuspendBenchmarks:          {"CPU benchmarks in progress", "benchmarks", "info"},
+	SuspendDiskSize:            {"need disk space", "disk_size", "danger"},
+	SuspendCPUThrottle:         {"CPU throttled", "cpu_throttle", "light"},
+	SuspendNoRecentInput:       {"no recent input", "no_recent_input", "warning"},
+	SuspendInitialDelay:        {"initial delay", "initial_delay", "info"},
+	SuspendExclusiveAppRunning: {"an exclusive app is running", "exclusive_app_running", "warning"},
+	SuspendCPUUsage:            {"CPU is busy", "cpu_usage", "warning"},
+	SuspendNetworkQuota:        {"network transfer limit exceeded", "network_quota", "warning"},
+	SuspendOS:                  {"requested by operating system", "os", "warning"},
+	SuspendWifiState:           {"not connected to WiFi network", "wifi_state", "warning"},
+	SuspendBatteryCharging:     {"battery low", "battery_charging", "warning"},
+	SuspendBatteryOverheated:   {"battery thermal protection", "battery_overheated", "danger"},
+	SuspendNoGuiKeepalive:      {"GUI not active", "no_gui_keepalive", "warning"},
+}
+
+var taskStatuses = map[TaskStatus]stateInfo{
+	StatusReadyToStart:  {"Ready to start", "ready", "light"},
+	StatusRunning:       {"Running", "running", "primary"},
+	StatusWaiting:       {"Waiting to run", "waiting", "secondary"},
+	StatusSuspended:     {"Suspended", "suspended", "warning"},
+	StatusDownloading:   {"Downloading", "downloading", "info"},
+	StatusUploading:     {"Uploading", "uploading", "info"},
+	StatusReadyToReport: {"Ready to report", "report", "success"},
+	StatusError:         {"Computation error", "error", "danger"},
+	StatusAborted:       {"Aborted", "aborted", "danger"},
+	StatusUploadFailed:  {"Upload failed", "upload_failed", "danger"},
+}
+
+// unknownState describes values the tables above do not know (newer clients)
+func unknownState(value int) stateInfo {
+	return stateInfo{"Unknown (" + strconv.Itoa(value) + ")", strconv.Itoa(value), "secondary"}
+}
+
+// lookupState returns the info of a value from its table, unknownState if the table lacks it
+func lookupState[T ~int](infos map[T]stateInfo, value T) stateInfo {
+	if info, ok := infos[value]; ok {
+		return info
+	}
+	return unknownState(int(value))
+}
+
+func (state ResultState) info() stateInfo { return lookupState(resultStates, state) }
+
+func (state ResultState) String() string { return state.info().label }
+func (state ResultState) Key() string    { return state.info().key }
+func (state ResultState) Class() string  { return state.info().class }
+
+func (state ResultState) MarshalJSON() ([]byte, error) { return json.Marshal(state.Key()) }
+
+func (state TaskState) info() stateInfo { return lookupState(taskStates, state) }
+
+func (state TaskState) String() string { return state.info().label }
+func (state TaskState) Key() string    { return state.info().key }
+func (state TaskState) Class() string  { return state.info().class }
+
+func (state TaskState) MarshalJSON() ([]byte, error) { return json.Marshal(state.Key()) }
+
+func (reason SuspendReason) info() stateInfo {
+	if info, ok := suspendReasons[reason]; ok {
+		return info
+	}
+	// older clients combine several reasons as bits
+	var labels, keys []string
+	for bit := SuspendBatteries; bit <= SuspendNetworkQuota; bit <<= 1 {
+		if reason&bit != 0 {
+			labels = append(labels, suspendReasons[bit].label)
+			keys = append(keys, suspendReasons[bit].key)
+		}
+	}
+	if len(labels) == 0 {
+		return unknownState(int(reason))
+	}
+	return stateInfo{strings.Join(labels, ", "), strings.Join(keys, ","), "warning"}
+}
+
+func (reason SuspendReason) String() string { return reason.info().label }
+func (reason SuspendReason) Key() string    { return reason.info().key }
+func (reason SuspendReason) Class() string  { return reason.info().class }
+
+func (reason SuspendReason) MarshalJSON() ([]byte, error) { return json.Marshal(reason.Key()) }
+
+func (status TaskStatus) info() stateInfo { return lookupState(taskStatuses, status) }
+
+func (status TaskStatus) String() string { return status.info().label }
+func (status TaskStatus) Key() string    { return status.info().key }
+func (status TaskStatus) Class() string  { return status.info().class }
+
+func (status TaskStatus) MarshalJSON() ([]byte, error) { return json.Marshal(status.Key()) }
+
+// parseTaskStatus returns the status for a key as used in URLs
+func parseTaskStatus(key string) (TaskStatus, bool) {
+	for status, info := range taskStatuses {
+		if info.key == key {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// taskStatusOrder returns all task statuses in their natural order
+func taskStatusOrder() []TaskStatus {
+	statuses := make([]TaskStatus, 0, len(taskStatuses))
+	for status := StatusReadyToStart; status <= StatusUploadFailed; status++ {
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// taskStatus
+//
+// Combine result state, active task and the client's suspend reason into the
+// status of a task, following the logic of BOINC Manager
+func taskStatus(result Result, ccStatus CCStatus) (TaskStatus, SuspendReason) {
+	task := result.Activetask
+
+	switch result.State {
+	case ResultNew, ResultFilesDownloading:
+		return StatusDownloading, SuspendNone
+	case ResultComputeError:
+		return StatusError, SuspendNone
+	case ResultFilesUploading:
+		return StatusUploading, SuspendNone
+	case ResultFilesUploaded:
+		return StatusReadyToReport, SuspendNone
+	case ResultAborted:
+		return StatusAborted, SuspendNone
+	case ResultUploadFailed:
+		return StatusUploadFailed, SuspendNone
+	}
+	if result.ReadyToReport != nil {
+		return StatusReadyToReport, SuspendNone
+	}
+
+	// downloaded: runnable, running or suspended
+	switch {
+	case result.SuspendedViaGui != nil || result.ProjectSuspendedViaGui != nil:
+		return StatusSuspended, SuspendUserRequest
+	case ccStatus.TaskSuspendReason != SuspendNone && ccStatus.TaskSuspendReason != SuspendCPUThrottle:
+		return StatusSuspended, ccStatus.TaskSuspendReason
+	case task.TaskState == TaskExecuting || task.TaskState == TaskAbortPending ||
+		task.TaskState == TaskQuitPending || task.TaskState == TaskCopyPending:
+		return StatusRunning, SuspendNone
+	case task.TaskState == TaskSuspended && task.SchedulerState == SchedulerPreempted:
+		return StatusWaiting, SuspendNone
+	case task.TaskState == TaskSuspended:
+		return StatusSuspended, ccStatus.TaskSuspendReason
+	case task.FractionDone > 0:
+		return StatusWaiting, SuspendNone
+	}
+	return StatusReadyToStart, SuspendNone
+}
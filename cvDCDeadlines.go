@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+//
+// Deadline risk
+//
+// Estimates per BOINC host when each unfinished task will be done, given the
+// remaining run time, how much of the time BOINC gets to compute on the host
+// (TimeStats.OnFrac * ActiveFrac) and the tasks queued ahead of it on the
+// host's cores, and compares that with the report deadline.
+//
+
+// DeadlineRisk tells whether a task will make its report deadline
+type DeadlineRisk int
+
+const (
+	DeadlineMet     DeadlineRisk = iota // finished in time
+	DeadlineOnTrack                     // projected to finish in time
+	DeadlineAtRisk                      // projected to finish late or with too little margin
+	DeadlineMissed                      // deadline passed, not reported
+)
+
+var deadlineRisks = map[DeadlineRisk]stateInfo{
+	DeadlineMet:     {"Met", "met", "success"},
+	DeadlineOnTrack: {"On track", "on_track", "light"},
+	DeadlineAtRisk:  {"At risk", "at_risk", "warning"},
+	DeadlineMissed:  {"Missed", "missed", "danger"},
+}
+
+func (risk DeadlineRisk) info() stateInfo { return lookupState(deadlineRisks, risk) }
+
+func (risk DeadlineRisk) String() string { return risk.info().label }
+func (risk DeadlineRisk) Key() string    { return risk.info().key }
+func (risk DeadlineRisk) Class() string  { return risk.info().class }
+
+func (risk DeadlineRisk) MarshalJSON() ([]byte, error) { return json.Marshal(risk.Key()) }
+
+// deadlineMargin is the share of the time left until the deadline a task should
+// be projected to finish early by; less than that is flagged at risk
+const deadlineMargin = 0.1
+
+// minDeadlineMargin is the least margin expected regardless of how close the deadline is
+const minDeadlineMargin = time.Hour
+
+// assessDeadlines
+//
+// Fill projected finish, slack and risk of the tasks of one host. Tasks are
+// placed earliest deadline first, the ones running already ahead of the queued
+// ones: CPU tasks on as many of the host's cores as they use, GPU tasks on the
+// GPUs of their type. Their remaining run time is stretched by the fraction of
+// time BOINC actually computes.
+func assessDeadlines(tasks []BoincTask, ncpus int, gpus []GPU, timeStats TimeStats, now time.Time) {
+	if ncpus < 1 {
+		ncpus = 1
+	}
+	availability := timeStats.OnFrac * timeStats.ActiveFrac
+	if availability <= 0 || availability > 1 {
+		availability = 1
+	}
+
+	var pending []*BoincTask
+	for idx := range tasks {
+		task := &tasks[idx]
+		task.Deadline = time.Unix(int64(task.ReportDeadline), 0)
+
+		switch task.Status {
+		case StatusReadyToReport, StatusUploading, StatusError, StatusAborted, StatusUploadFailed:
+			// computing is done, only the report may be late
+			task.ProjectedFinish = now
+			if now.After(task.Deadline) {
+				task.Risk = DeadlineMissed
+			} else {
+				task.Risk = DeadlineMet
+			}
+		default:
+			pending = append(pending, task)
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		runningI := pending[i].Status == StatusRunning
+		runningJ := pending[j].Status == StatusRunning
+		if runningI != runningJ {
+			return runningI
+		}
+		return pending[i].ReportDeadline < pending[j].ReportDeadline
+	})
+
+	// cores and GPUs become free at these offsets from now
+	cores := make([]time.Duration, ncpus)
+	devices := map[string][]time.Duration{}
+	for _, gpu := range gpus {
+		devices[gpu.Type] = make([]time.Duration, max(gpu.Count, 1))
+	}
+	for _, task := range pending {
+		wall := time.Duration(task.EstimatedTimeRemaining / availability * float64(time.Second))
+		if len(task.Coprocs) > 0 {
+			// the CPU share of a GPU task is left out, BOINC keeps no core for it
+			coproc := task.Coprocs[0]
+			if devices[coproc.Type] == nil {
+				devices[coproc.Type] = make([]time.Duration, 1)
+			}
+			task.ProjectedFinish = now.Add(placeTask(devices[coproc.Type], int(math.Ceil(coproc.Count)), wall))
+		} else {
+			task.ProjectedFinish = now.Add(placeTask(cores, int(math.Ceil(task.Ncpus)), wall))
+		}
+
+		margin := time.Duration(deadlineMargin * float64(task.Deadline.Sub(now)))
+		if margin < minDeadlineMargin {
+			margin = minDeadlineMargin
+		}
+		switch {
+		case now.After(task.Deadline):
+			task.Risk = DeadlineMissed
+		case task.ProjectedFinish.Add(margin).After(task.Deadline):
+			task.Risk = DeadlineAtRisk
+		default:
+			task.Risk = DeadlineOnTrack
+		}
+	}
+
+	for idx := range tasks {
+		task := &tasks[idx]
+		task.Slack = task.Deadline.Sub(task.ProjectedFinish)
+		task.DeadlineAsString = task.Deadline.Format("2006-01-02 15:04")
+		task.SlackAsString = formatDHMS(math.Round(task.Slack.Seconds()))
+	}
+}
+
+// placeTask
+//
+// Put a task needing n of the units (cores or GPUs) on the ones free first: it
+// starts once the n-th of them is free and keeps all n until it finishes after
+// wall. Returns when that is; free is updated
+func placeTask(free []time.Duration, n int, wall time.Duration) time.Duration {
+	n = min(max(n, 1), len(free))
+	sort.Slice(free, func(i, j int) bool { return free[i] < free[j] })
+	finish := free[n-1] + wall
+	for idx := 0; idx < n; idx++ {
+		free[idx] = finish
+	}
+	return finish
+}
+
+// deadlineTasks
+//
+// All tasks of the farm which are not done with their deadline, most urgent first
+func deadlineTasks(views []BoincClientView) []BoincTask {
+	var tasks []BoincTask
+	for _, view := range views {
+		for _, task := range view.Tasks {
+			if task.Risk != DeadlineMet {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].Risk != tasks[j].Risk {
+			return tasks[i].Risk > tasks[j].Risk
+		}
+		return tasks[i].Slack < tasks[j].Slack
+	})
+	return tasks
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssessDeadlines(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	at := func(offset time.Duration) float64 { return float64(now.Add(offset).Unix()) }
+	task := func(name string, status TaskStatus, remaining time.Duration, deadline time.Duration) BoincTask {
+		return BoincTask{
+			Result: Result{Name: name, EstimatedTimeRemaining: remaining.Seconds(), ReportDeadline: at(deadline)},
+			Status: status,
+		}
+	}
+
+	tasks := []BoincTask{
+		task("running", StatusRunning, 2*time.Hour, 48*time.Hour),
+		task("queued late", StatusReadyToStart, 10*time.Hour, 11*time.Hour),
+		task("queued early", StatusReadyToStart, 4*time.Hour, 10*time.Hour),
+		task("overdue", StatusWaiting, time.Hour, -time.Hour),
+		task("reported late", StatusReadyToReport, 0, -time.Minute),
+		task("reported", StatusReadyToReport, 0, time.Hour),
+	}
+	// one core, computing only half of the time
+	assessDeadlines(tasks, 1, nil, TimeStats{OnFrac: 1, ActiveFrac: 0.5}, now)
+
+	want := map[string]struct {
+		risk   DeadlineRisk
+		finish time.Duration
+	}{
+		// running first: 2h at half speed; then earliest deadline first
+		"running":       {DeadlineOnTrack, 4 * time.Hour},
+		"overdue":       {DeadlineMissed, 6 * time.Hour},
+		"queued early":  {DeadlineAtRisk, 14 * time.Hour},
+		"queued late":   {DeadlineAtRisk, 34 * time.Hour},
+		"reported late": {DeadlineMissed, 0},
+		"reported":      {DeadlineMet, 0},
+	}
+	for _, task := range tasks {
+		expected := want[task.Name]
+		if task.Risk != expected.risk {
+			t.Errorf("%s: risk %s, want %s", task.Name, task.Risk, expected.risk)
+		}
+		if finish := task.ProjectedFinish.Sub(now); finish != expected.finish {
+			t.Errorf("%s: projected finish after %s, want %s", task.Name, finish, expected.finish)
+		}
+	}
+
+	urgent := deadlineTasks([]BoincClientView{{Tasks: tasks}})
+	order := []string{"overdue", "reported late", "queued late", "queued early", "running"}
+	if len(urgent) != len(order) {
+		t.Fatalf("%d urgent tasks, want %d", len(urgent), len(order))
+	}
+	for idx, name := range order {
+		if urgent[idx].Name != name {
+			t.Errorf("urgent[%d] = %s, want %s", idx, urgent[idx].Name, name)
+		}
+	}
+}
+
+func TestAssessDeadlinesResources(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	task := func(name string, status TaskStatus, remaining time.Duration, ncpus float64, coprocs ...AppVersionCoproc) BoincTask {
+		return BoincTask{
+			Result:  Result{Name: name, EstimatedTimeRemaining: remaining.Seconds(), ReportDeadline: float64(now.Add(48 * time.Hour).Unix())},
+			Status:  status,
+			Ncpus:   ncpus,
+			Coprocs: coprocs,
+		}
+	}
+	gpu := AppVersionCoproc{Type: "NVIDIA", Count: 1}
+
+	tasks := []BoincTask{
+		task("multi-threaded", StatusRunning, 2*time.Hour, 4),
+		task("gpu", StatusRunning, 3*time.Hour, 0.2, gpu),
+		task("single", StatusReadyToStart, time.Hour, 1),
+		task("gpu queued", StatusReadyToStart, time.Hour, 0.2, gpu),
+	}
+	// four cores and one GPU
+	assessDeadlines(tasks, 4, []GPU{{Type: "NVIDIA", Count: 1}}, TimeStats{OnFrac: 1, ActiveFrac: 1}, now)
+
+	// the single core task waits for the multi-threaded one, the GPU tasks for the GPU only
+	want := map[string]time.Duration{"multi-threaded": 2 * time.Hour, "gpu": 3 * time.Hour, "single": 3 * time.Hour, "gpu queued": 4 * time.Hour}
+	for _, task := range tasks {
+		if finish := task.ProjectedFinish.Sub(now); finish != want[task.Name] {
+			t.Errorf("%s: projected finish after %s, want %s", task.Name, finish, want[task.Name])
+		}
+	}
+}
+
+func TestFormatDHMS(t *testing.T) {
+	if got := formatDHMS(-3661); got != "-1h:1m:1s" {
+		t.Errorf("formatDHMS(-3661) = %q", got)
+	}
+	if got := formatDHMS(90061); got != "1d 1h:1m:1s" {
+		t.Errorf("formatDHMS(90061) = %q", got)
+	}
+	// more days than fit into a byte, e.g. a client up for a year
+	if got := formatDHMS(400*86400 + 1); got != "400d 0h:0m:1s" {
+		t.Errorf("formatDHMS(400 days) = %q", got)
+	}
+}
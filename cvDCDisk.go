@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+//
+// Disk usage
+//
+// What the projects of a BOINC host keep on its disk, measured against what
+// BOINC may use after the disk preferences (d_allowed of get_disk_usage) and
+// the space left on the disk. A host which reaches its limit fetches no more
+// work; on the SD cards of small hosts that happens quietly, so hosts close to
+// it are flagged.
+//
+
+// DiskLevel tells how close a host is to its disk limit
+type DiskLevel int
+
+const (
+	DiskOK   DiskLevel = iota
+	DiskLow            // close to the limit or to a full disk
+	DiskFull           // at the limit, BOINC fetches no more work
+)
+
+var diskLevels = map[DiskLevel]stateInfo{
+	DiskOK:   {"OK", "ok", "light"},
+	DiskLow:  {"Low", "low", "warning"},
+	DiskFull: {"Full", "full", "danger"},
+}
+
+func (level DiskLevel) info() stateInfo {
+	if info, ok := diskLevels[level]; ok {
+		return info
+	}
+	return unknownState(int(level))
+}
+
+func (level DiskLevel) String() string { return level.info().label }
+func (level DiskLevel) Key() string    { return level.info().key }
+func (level DiskLevel) Class() string  { return level.info().class }
+
+func (level DiskLevel) MarshalJSON() ([]byte, error) { return json.Marshal(level.Key()) }
+
+// diskLowShare is the share of the allowed space from which a host is flagged
+const diskLowShare = 0.9
+
+// diskLowFree is the share of the disk which should stay free
+const diskLowFree = 0.05
+
+// ProjectDisk is what one project keeps on a host
+type ProjectDisk struct {
+	MasterUrl     string
+	ProjectName   string
+	Used          float64
+	Share         float64 // of what BOINC may use
+	UsedAsString  string
+	ShareAsString string
+}
+
+// HostDisk
+//
+// The disk of a BOINC host and what BOINC keeps there
+type HostDisk struct {
+	Total    float64
+	Free     float64
+	Allowed  float64 // what BOINC may use in all, 0 when not known
+	Boinc    float64 // BOINC's own files
+	Used     float64 // BOINC's own files and the projects
+	Projects []ProjectDisk
+	Level    DiskLevel
+	Warnings []string
+
+	TotalAsString   string
+	FreeAsString    string
+	AllowedAsString string
+	UsedAsString    string
+	UsedShare       string // of what BOINC may use
+}
+
+// hostDisk
+//
+// Measure the disk usage of a host against what BOINC may use and the free
+// space; before the first get_disk_usage size and free space of the host info
+func hostDisk(usage DiskUsage, info HostInfo, projects Projects) HostDisk {
+	disk := HostDisk{
+		Total:   usage.DTotal,
+		Free:    usage.DFree,
+		Allowed: usage.DAllowed,
+		Boinc:   usage.DBoinc,
+		Used:    usage.DBoinc,
+	}
+	if disk.Total <= 0 {
+		disk.Total, disk.Free = info.DTotal, info.DFree
+	}
+
+	for _, project := range usage.Projects {
+		projectDisk := ProjectDisk{
+			MasterUrl:    project.MasterUrl,
+			ProjectName:  project.MasterUrl,
+			Used:         project.DiskUsage,
+			UsedAsString: formatBytes(project.DiskUsage),
+		}
+		if idx := projects.index(project.MasterUrl); idx >= 0 {
+			projectDisk.ProjectName = projects[idx].ProjectName
+		}
+		if disk.Allowed > 0 {
+			projectDisk.Share = project.DiskUsage / disk.Allowed
+			projectDisk.ShareAsString = formatPercent(projectDisk.Share)
+		}
+		disk.Used += project.DiskUsage
+		disk.Projects = append(disk.Projects, projectDisk)
+	}
+	sort.SliceStable(disk.Projects, func(i, j int) bool {
+		return disk.Projects[i].Used > disk.Projects[j].Used
+	})
+
+	disk.TotalAsString = formatBytes(disk.Total)
+	disk.FreeAsString = formatBytes(disk.Free)
+	disk.UsedAsString = formatBytes(disk.Used)
+	if disk.Allowed > 0 {
+		disk.AllowedAsString = formatBytes(disk.Allowed)
+		disk.UsedShare = formatPercent(disk.Used / disk.Allowed)
+		switch {
+		case disk.Used >= disk.Allowed:
+			disk.Level = DiskFull
+			disk.Warnings = append(disk.Warnings, "BOINC uses all of the "+disk.AllowedAsString+" it may use, no new work is fetched")
+		case disk.Used >= diskLowShare*disk.Allowed:
+			disk.Level = DiskLow
+			disk.Warnings = append(disk.Warnings, "BOINC uses "+disk.UsedShare+" of the "+disk.AllowedAsString+" it may use")
+		}
+	}
+	if disk.Total > 0 && disk.Free < diskLowFree*disk.Total {
+		if disk.Level < DiskLow {
+			disk.Level = DiskLow
+		}
+		disk.Warnings = append(disk.Warnings, "only "+disk.FreeAsString+" ("+formatPercent(disk.Free/disk.Total)+") of the disk free")
+	}
+	return disk
+}
+
+// diskHosts
+//
+// The BOINC hosts of the farm, those closest to their limit first
+func diskHosts(views []BoincClientView) []BoincClientView {
+	hosts := make([]BoincClientView, len(views))
+	copy(hosts, views)
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if hosts[i].Disk.Level != hosts[j].Disk.Level {
+			return hosts[i].Disk.Level > hosts[j].Disk.Level
+		}
+		return hosts[i].Name < hosts[j].Name
+	})
+	return hosts
+}
+
+// diskHandler shows the disk usage of all BOINC hosts
+func diskHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Hosts []BoincClientView
+	}{
+		Hosts: diskHosts(boincViews()),
+	}
+	renderPage(w, r, "cvDCollector_disk.html", data)
+}
+
+// diskAPIHandler returns the disk usage of all BOINC hosts as JSON
+func diskAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	type diskEntry struct {
+		Name string
+		Ip   string
+		HostDisk
+	}
+	hosts := []diskEntry{}
+	for _, view := range diskHosts(boincViews()) {
+		hosts = append(hosts, diskEntry{Name: view.Name, Ip: view.Ip, HostDisk: view.Disk})
+	}
+	outputJSON(w, hosts)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoincDiskUsage(t *testing.T) {
+	_, client := polledTestBoinc(t)
+
+	usage := client.DiskUsage
+	if len(usage.Projects) != 1 || usage.Projects[0].DiskUsage != 1262641152 || usage.DAllowed != 1395864371.2 || usage.DBoinc != 4308992 {
+		t.Fatalf("disk usage %+v", usage)
+	}
+
+	disk := client.view().Disk
+	if disk.Level != DiskLow || len(disk.Warnings) != 1 || !strings.Contains(disk.Warnings[0], "90.8%") {
+		t.Errorf("level %v, warnings %q", disk.Level, disk.Warnings)
+	}
+	if len(disk.Projects) != 1 || disk.Projects[0].ProjectName != "World Community Grid" || disk.Projects[0].ShareAsString != "90.5%" {
+		t.Errorf("projects %+v", disk.Projects)
+	}
+	if disk.UsedAsString != "1.2 GiB" || disk.AllowedAsString != "1.3 GiB" || disk.FreeAsString != "20.6 GiB" {
+		t.Errorf("used %q of %q, free %q", disk.UsedAsString, disk.AllowedAsString, disk.FreeAsString)
+	}
+}
+
+// a client failing get_disk_usage keeps its connection and the last disk usage
+func TestBoincDiskUsageFails(t *testing.T) {
+	server, client := polledTestBoinc(t)
+	before := client.DiskUsage
+
+	for _, reply := range []string{boincReply("<error>unrecognized op: get_disk_usage</error>"), "<boinc_gui_rpc_reply>\n<disk_usage_summary><d_total>lots"} {
+		server.setReply("get_disk_usage", func(string) string { return reply })
+		client.lastDisk = time.Time{}
+		if err := client.poll(); err != nil || !client.isConnected() {
+			t.Fatalf("poll %v, connected %v", err, client.isConnected())
+		}
+		if client.DiskUsage.DTotal != before.DTotal || len(client.DiskUsage.Projects) != len(before.Projects) {
+			t.Errorf("disk usage %+v", client.DiskUsage)
+		}
+	}
+}
+
+func TestHostDisk(t *testing.T) {
+	const gb = 1000 * 1000 * 1000
+	projects := Projects{{MasterUrl: "https://einsteinathome.org/", ProjectName: "Einstein@Home"}}
+
+	tests := []struct {
+		name     string
+		usage    DiskUsage
+		info     HostInfo
+		level    DiskLevel
+		warnings int
+	}{
+		{"plenty", DiskUsage{DTotal: 32 * gb, DFree: 20 * gb, DBoinc: 0.1 * gb, DAllowed: 10 * gb,
+			Projects: []ProjectDiskUsage{{MasterUrl: "https://einsteinathome.org/", DiskUsage: 2 * gb}}}, HostInfo{}, DiskOK, 0},
+		{"at the limit", DiskUsage{DTotal: 32 * gb, DFree: 20 * gb, DBoinc: 0.1 * gb, DAllowed: 2 * gb,
+			Projects: []ProjectDiskUsage{{MasterUrl: "https://einsteinathome.org/", DiskUsage: 2 * gb}}}, HostInfo{}, DiskFull, 1},
+		{"disk full", DiskUsage{DTotal: 32 * gb, DFree: 1 * gb, DAllowed: 10 * gb}, HostInfo{}, DiskLow, 1},
+		{"full and at the limit", DiskUsage{DTotal: 32 * gb, DFree: 0.5 * gb, DAllowed: 1 * gb,
+			Projects: []ProjectDiskUsage{{MasterUrl: "https://other.org/", DiskUsage: 1.5 * gb}}}, HostInfo{}, DiskFull, 2},
+		{"before get_disk_usage", DiskUsage{}, HostInfo{DTotal: 32 * gb, DFree: 1 * gb}, DiskLow, 1},
+	}
+	for _, test := range tests {
+		disk := hostDisk(test.usage, test.info, projects)
+		if disk.Level != test.level || len(disk.Warnings) != test.warnings {
+			t.Errorf("%s: level %v, warnings %q", test.name, disk.Level, disk.Warnings)
+		}
+	}
+
+	disk := hostDisk(tests[3].usage, HostInfo{}, projects)
+	if disk.Projects[0].ProjectName != "https://other.org/" {
+		t.Errorf("unknown project named %q", disk.Projects[0].ProjectName)
+	}
+	if disk := hostDisk(DiskUsage{}, HostInfo{}, nil); disk.Level != DiskOK || disk.Warnings != nil {
+		t.Errorf("nothing known: %+v", disk)
+	}
+}
+
+func TestDiskHosts(t *testing.T) {
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	dcClients.BOINCConfig.Clients = []BoincClient{
+		{DCClient: DCClient{Name: "alpha"}},
+		{DCClient: DCClient{Name: "beta"}, DiskUsage: DiskUsage{DTotal: 32e9, DFree: 20e9, DAllowed: 1e9, DBoinc: 1e9}},
+	}
+
+	recorder := httptest.NewRecorder()
+	diskAPIHandler(recorder, httptest.NewRequest("GET", "/api/boinc/disk", nil))
+	var hosts []struct {
+		Name  string
+		Level string
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &hosts); err != nil || len(hosts) != 2 {
+		t.Fatalf("api %s, %v", recorder.Body.String(), err)
+	}
+	if hosts[0].Name != "beta" || hosts[0].Level != "full" || hosts[1].Level != "ok" {
+		t.Errorf("hosts %+v", hosts)
+	}
+
+	recorder = httptest.NewRecorder()
+	diskHandler(recorder, httptest.NewRequest("GET", "/boinc/disk", nil))
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "no new work is fetched") {
+		t.Errorf("page %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//
+// Live updates
+//
+// After every poll the pollers hand the client's view to the event hub,
+// which compares the rows of the pages (BOINC tasks, FAH units) with what it
+// sent before and pushes only the changes to the browsers listening on
+// /events (Server-Sent Events). js/cvDCollector_live.js applies them to the
+// page in place.
+//
+
+// RowUpdate is the live part of one row of a page
+type RowUpdate struct {
+	ID        string `json:"id"` // client/task or client/unit
+	Status    string `json:"status"`
+	Class     string `json:"class,omitempty"`
+	Progress  string `json:"progress"`
+	Remaining string `json:"remaining"`
+	Finished  bool   `json:"finished,omitempty"`
+}
+
+// ClientEvent carries the changes of one client since its last event
+type ClientEvent struct {
+	Kind            string      `json:"kind"` // boinc or fah
+	Client          string      `json:"client"`
+	ConnectionError string      `json:"connection_error"`
+	Rows            []RowUpdate `json:"rows,omitempty"`    // changed or new rows
+	Added           []string    `json:"added,omitempty"`   // ids of the new rows
+	Removed         []string    `json:"removed,omitempty"` // ids of rows gone
+}
+
+// eventHub
+//
+// Fans the events out to the subscribed browsers and remembers the last state
+// sent per client to compute the next difference
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]bool
+	rows        map[string]map[string]RowUpdate // kind/client -> id -> row
+	errors      map[string]string               // kind/client -> connection error
+}
+
+// subscriberBuffer is how many events a slow browser may lag behind before it is dropped
+const subscriberBuffer = 32
+
+// eventKeepAlive is the interval of comments keeping idle connections open through proxies
+const eventKeepAlive = 30 * time.Second
+
+var events = newEventHub()
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan []byte]bool),
+		rows:        make(map[string]map[string]RowUpdate),
+		errors:      make(map[string]string),
+	}
+}
+
+// subscribe returns a channel receiving the encoded events, closed when the subscriber is dropped
+func (hub *eventHub) subscribe() chan []byte {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	ch := make(chan []byte, subscriberBuffer)
+	hub.subscribers[ch] = true
+	return ch
+}
+
+// subscriberCount returns the number of browsers listening
+func (hub *eventHub) subscriberCount() int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return len(hub.subscribers)
+}
+
+// unsubscribe ends a subscription (again)
+func (hub *eventHub) unsubscribe(ch chan []byte) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.subscribers[ch] {
+		delete(hub.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish
+//
+// Send the changes of a client's rows and connection error since the last
+// call; nothing is sent when nothing changed
+func (hub *eventHub) publish(kind string, client string, connectionError string, rows []RowUpdate) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	key := kind + "/" + client
+	current := make(map[string]RowUpdate, len(rows))
+	for _, row := range rows {
+		current[row.ID] = row
+	}
+	event := ClientEvent{Kind: kind, Client: client, ConnectionError: connectionError}
+	event.Rows, event.Added, event.Removed = diffRows(hub.rows[key], current, rows)
+	errorChanged := hub.errors[key] != connectionError
+	hub.rows[key] = current
+	hub.errors[key] = connectionError
+
+	if len(event.Rows) == 0 && len(event.Removed) == 0 && !errorChanged {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("encoding event", "client", key, "error", err)
+		return
+	}
+	for ch := range hub.subscribers {
+		select {
+		case ch <- data:
+		default:
+			// too slow; the browser reconnects and reloads the page
+			delete(hub.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// diffRows returns the rows (in their order) which are new or changed, the ids of the new ones and of those gone
+func diffRows(previous map[string]RowUpdate, current map[string]RowUpdate, rows []RowUpdate) ([]RowUpdate, []string, []string) {
+	var changed []RowUpdate
+	var added, removed []string
+	for _, row := range rows {
+		old, ok := previous[row.ID]
+		if !ok {
+			added = append(added, row.ID)
+		}
+		if !ok || old != row {
+			changed = append(changed, row)
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return changed, added, removed
+}
+
+// boincRows returns the live rows of a BOINC client
+func boincRows(view BoincClientView) []RowUpdate {
+	rows := make([]RowUpdate, 0, len(view.Tasks))
+	for _, task := range view.Tasks {
+		status := task.Status.String()
+		if task.SuspendReason != SuspendNone {
+			status += " (" + task.SuspendReason.String() + ")"
+		}
+		rows = append(rows, RowUpdate{
+			ID:        view.Name + "/" + task.Name,
+			Status:    status,
+			Class:     task.Status.Class(),
+			Progress:  task.FractionDoneAsString,
+			Remaining: task.EstimatedTimeRemainingAsString,
+			Finished:  task.IsFinished,
+		})
+	}
+	return rows
+}
+
+// fahRows returns the live rows of a FAH client
+func fahRows(view FAHClientView) []RowUpdate {
+	rows := make([]RowUpdate, 0, len(view.Units))
+	for _, unit := range view.Units {
+		rows = append(rows, RowUpdate{
+			ID:        view.Name + "/" + unit.ID,
+			Status:    unit.State,
+			Progress:  unit.Percentdone,
+			Remaining: unit.Eta,
+		})
+	}
+	return rows
+}
+
+// publishBoinc sends the changes of a BOINC client after a poll
+func publishBoinc(client *BoincClient) {
+	view := client.view()
+	events.publish("boinc", view.Name, view.ConnectionError, boincRows(view))
+}
+
+// publishFAH sends the changes of a FAH client after a poll
+func publishFAH(client *FAHClient) {
+	view := client.view()
+	events.publish("fah", view.Name, view.ConnectionError, fahRows(view))
+}
+
+// eventsHandler URL handler
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	_, _ = fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventHubPublishesChanges(t *testing.T) {
+	hub := newEventHub()
+	ch := hub.subscribe()
+
+	rows := []RowUpdate{
+		{ID: "pi/a", Status: "Running", Progress: "10.0%"},
+		{ID: "pi/b", Status: "Ready to start"},
+	}
+	hub.publish("boinc", "pi", "", rows)
+	var event ClientEvent
+	if err := json.Unmarshal(<-ch, &event); err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Rows) != 2 || len(event.Added) != 2 || len(event.Removed) != 0 {
+		t.Errorf("first event %+v", event)
+	}
+
+	// unchanged: nothing sent
+	hub.publish("boinc", "pi", "", rows)
+	select {
+	case data := <-ch:
+		t.Errorf("event without changes: %s", data)
+	default:
+	}
+
+	rows = []RowUpdate{
+		{ID: "pi/a", Status: "Running", Progress: "20.0%"},
+		{ID: "pi/c", Status: "Downloading"},
+	}
+	hub.publish("boinc", "pi", "", rows)
+	event = ClientEvent{}
+	if err := json.Unmarshal(<-ch, &event); err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Rows) != 2 || event.Rows[0].Progress != "20.0%" || event.Rows[1].ID != "pi/c" {
+		t.Errorf("changed rows %+v", event.Rows)
+	}
+	if len(event.Added) != 1 || event.Added[0] != "pi/c" || len(event.Removed) != 1 || event.Removed[0] != "pi/b" {
+		t.Errorf("added %v, removed %v", event.Added, event.Removed)
+	}
+
+	// the connection error alone is a change
+	hub.publish("boinc", "pi", "connection refused", rows)
+	event = ClientEvent{}
+	if err := json.Unmarshal(<-ch, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ConnectionError != "connection refused" || len(event.Rows) != 0 {
+		t.Errorf("error event %+v", event)
+	}
+
+	hub.unsubscribe(ch)
+	hub.unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Error("channel open after unsubscribe")
+	}
+}
+
+func TestEventHubDropsSlowSubscribers(t *testing.T) {
+	hub := newEventHub()
+	ch := hub.subscribe()
+	for idx := 0; idx <= subscriberBuffer; idx++ {
+		hub.publish("fah", "blackbox", "", []RowUpdate{{ID: "blackbox/00", Progress: strings.Repeat("x", idx)}})
+	}
+	for idx := 0; idx < subscriberBuffer; idx++ {
+		<-ch
+	}
+	if _, ok := <-ch; ok {
+		t.Error("slow subscriber not dropped")
+	}
+	hub.unsubscribe(ch)
+}
+
+func TestEventsHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer server.Close()
+
+	response, err := server.Client().Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("content type %q", contentType)
+	}
+
+	reader := bufio.NewReader(response.Body)
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ":") {
+		t.Fatalf("first line %q", line)
+	}
+
+	// the handler subscribed before it answered
+	done := make(chan string)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || strings.HasPrefix(line, "data: ") {
+				done <- line
+				return
+			}
+		}
+	}()
+	events.publish("boinc", "events-test", "", []RowUpdate{{ID: "events-test/a", Status: "Running"}})
+	select {
+	case line := <-done:
+		if !strings.Contains(line, `"client":"events-test"`) {
+			t.Errorf("event %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -55,9 +57,32 @@ type Unit struct {
 	BaseCredit     string `json:"basecredit"`
 }
 
+//
+// PRCG
+//
+// Project, run, clone and gen of a unit in the usual notation, e.g. "17326 (7,1184,41)"
+//
+func (unit Unit) PRCG() string {
+	return fmt.Sprintf("%d (%d,%d,%d)", unit.Project, unit.Run, unit.Clone, unit.Gen)
+}
+
+// FAHOptions are the options of a client or a slot; the FAH client gives every value as string
+type FAHOptions map[string]string
+
+type Options struct {
+	Options FAHOptions `json:"options"`
+}
+
+type SlotOptions struct {
+	Options FAHOptions `json:"slot-options"`
+}
+
 var slotinfo = "slot-info"
 var queueinfo = "queue-info"
 
+// optionsRefresh is the time between two polls of the options, they seldom change
+const optionsRefresh = 5 * time.Minute
+
 func (client *FAHClient) flavor() string {
 	return "FAH"
 }
@@ -69,53 +94,94 @@ func (client *FAHClient) flavor() string {
 //
 
 func (client *FAHClient) connect() error {
+	client.rpc.Lock()
+	defer client.rpc.Unlock()
+	return client.open()
+}
+
+//
+// method reconnect
+//
+// Drop the connection and open a new one, between two commands of the
+// poller; the poller goes on with the new connection
+//
+func (client *FAHClient) reconnect() error {
+	client.rpc.Lock()
+	defer client.rpc.Unlock()
+	_ = client.disconnect(nil)
+	return client.open()
+}
+
+// open connects and authorizes unless connected already; the caller holds rpc
+func (client *FAHClient) open() error {
 	var err error = nil
 
 	if client.Ip == "" || client.Port < 1024 {
-		return fmt.Errorf("invalid parameter for #{client.style()}")
+		client.stats.recordConnect(false)
+		return fmt.Errorf("invalid parameter for %s client %s", client.flavor(), client.Name)
 	}
 
-	adr := fmt.Sprintf("%s:%d", client.Ip, client.Port)
+	adr := net.JoinHostPort(client.Ip, strconv.Itoa(client.Port))
 
 	// if we have no connection, then try to connect
-	if client.connection != nil {
+	if client.isConnected() {
 		return err
 	}
 
-	client.ConnectionError = fmt.Errorf("connecting")
-	fmt.Printf("open connection to %s\n", adr)
-	client.connection, err = net.DialTimeout("tcp", adr, 10*time.Second)
+	client.setConnectionError(fmt.Errorf("connecting"))
+	defer func() { client.stats.recordConnect(client.isConnected()) }()
+
+	if client.Refresh < 1 {
+		client.Refresh = 10
+	}
+	client.logger().Info("open connection", "address", adr)
+	conn, err := net.DialTimeout("tcp", adr, 10*time.Second)
 
 	if err != nil {
-		client.ConnectionError = err
+		client.setConnectionError(err)
 		return err
 	}
+	client.setConnection(conn)
 
-	_ = client.receive(nil) // read the banner from the FAH Client
+	// read the banner from the FAH Client
+	if _, err = client.receiveMessage(); err != nil {
+		return client.disconnect(err)
+	}
 
-	authMsg := fmt.Sprintf("auth %s\n", client.Pwd)
+	authMsg := fmt.Sprintf("auth %s", client.Pwd)
 	if err = client.send(authMsg); err != nil {
 		return client.disconnect(err)
 	}
-	return client.receive(nil)
+	message, err := client.receiveMessage()
+	if err != nil {
+		return client.disconnect(err)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(message), "OK") {
+		return client.disconnect(fmt.Errorf("authorization failed for %s", adr))
+	}
+
+	client.setConnectionError(nil)
+	// a restarted client may have other options, the poller fetches them again
+	client.renewed.Store(true)
+
+	return nil
 }
 
 func (client *FAHClient) getConnection() *net.Conn {
 	return &client.connection
 }
 
-func (client *FAHClient) isConnected() bool {
-	return client.connection != nil
-}
-
 func (client *FAHClient) disconnect(errIn error) error {
-	client.ConnectionError = errIn
+	client.setConnectionError(errIn)
 
-	if client.connection == nil {
-		return nil
+	conn := client.setConnection(nil)
+	if conn == nil {
+		return errIn
+	}
+	err := conn.Close()
+	if errIn != nil {
+		return errIn
 	}
-	err := client.connection.Close()
-	client.connection = nil
 	return err
 }
 
@@ -126,39 +192,72 @@ func (client *FAHClient) disconnect(errIn error) error {
 // Result:		error 	error information or nil in case of success
 //
 func (client *FAHClient) send(object interface{}) error {
-	if client.Debug == true {
-		fmt.Printf("%s", object)
+	conn, _ := client.conn()
+	if conn == nil {
+		return errNotConnected
 	}
-	_, err := fmt.Fprintf(client.connection, "%s\n", object)
+	if command := fmt.Sprint(object); strings.HasPrefix(command, "auth ") {
+		client.logger().Debug("send", "data", "auth (password left out)")
+	} else {
+		client.logger().Debug("send", "data", command)
+	}
+	// every command/answer exchange has to finish in time, otherwise the client is considered gone
+	_ = conn.SetDeadline(time.Now().Add(rpcTimeout))
+
+	_, err := fmt.Fprintf(conn, "%s\n", object)
 	return err
 }
 
+//
+// method receiveMessage
+// Result:		string	raw answer up to and including the prompt
+//				error 	read error, nil in case of success
+//
+func (client *FAHClient) receiveMessage() (string, error) {
+	_, reader := client.conn()
+	if reader == nil {
+		return "", errNotConnected
+	}
+	message, err := reader.ReadString('>')
+	client.stats.recordReceived(len(message), nil)
+	return message, err
+}
+
 //
 // method receive
 // Parameter:	client	management object for the connected client
 //				object  data object will be received
-// Result:		none
+// Result:		error 	read or unmarshal error, nil in case of success
 //
 func (client *FAHClient) receive(object interface{}) error {
-	message, _ := bufio.NewReader(client.connection).ReadString('>')
+	message, err := client.receiveMessage()
+	if err != nil {
+		return err
+	}
+	// e.g. "\nERROR: unknown command 'slot-options'\n>"
+	if text := strings.TrimSpace(message); strings.HasPrefix(text, "ERROR: ") {
+		text, _, _ = strings.Cut(strings.TrimPrefix(text, "ERROR: "), "\n")
+		return errors.New(strings.TrimSpace(text))
+	}
 
 	msg := PyPON2JSON(message)
 
-	if client.Debug == true {
-		_, _ = fmt.Printf("%q\n", msg)
-	}
-	var err error = nil
+	client.logger().Debug("receive", "data", fahSecrets.ReplaceAllString(msg, `$1(left out)"`))
 
 	if object != nil {
 		err = json.Unmarshal([]byte(msg), object)
 		if err != nil {
-			err = fmt.Errorf("Error unmarshaling: %v\n", err)
+			err = fmt.Errorf("unmarshaling reply: %w", err)
+			client.stats.recordReceived(0, err)
 		}
 	}
 
 	return err
 }
 
+// fahSecrets finds passkey and password in the options, to keep them out of the log
+var fahSecrets = regexp.MustCompile(`("(?:passkey|password)":\s*")[^"]*"`)
+
 //
 // awful try to make the unknown PyON into real JSON for parsing
 // e.g. Replace True with true, False with false and others
@@ -169,6 +268,8 @@ func PyPON2JSON(message string) string {
 	msg = strings.Replace(msg, "False", "false", -1)
 	msg = strings.Replace(msg, "PyON 1 slots", "\"slots\":", -1)
 	msg = strings.Replace(msg, "PyON 1 units", "\"units\":", -1)
+	msg = strings.Replace(msg, "PyON 1 options", "\"options\":", -1)
+	msg = strings.Replace(msg, "PyON 1 slot-options", "\"slot-options\":", -1)
 	msg = strings.Replace(msg, "\n---\n>", "", -1)
 	msg = strings.Replace(msg, "\\n", "\n", -1)
 
@@ -177,24 +278,137 @@ func PyPON2JSON(message string) string {
 }
 
 //
+// method call
+// Parameter:	command	the command line to send
+//				reply	data object for the answer, nil to only wait for it
+// Result:		error 	error information or nil in case of success
 //
+// The poller and the option changes share the connection, so one command
+// and its answer go through at a time
+//
+func (client *FAHClient) call(command string, reply interface{}) error {
+	client.rpc.Lock()
+	defer client.rpc.Unlock()
+
+	if err := client.send(command); err != nil {
+		return err
+	}
+	return client.receive(reply)
+}
+
+//
+// method poll
+//
+// fetch slots and work units once, the options every optionsRefresh
+//
+func (client *FAHClient) poll() error {
+	slots := Slots{}
+	units := Units{}
+
+	if err := client.call(slotinfo, &slots); err != nil {
+		return err
+	}
+	if err := client.call(queueinfo, &units); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	client.Slots = slots
+	client.Units = units
+	client.mu.Unlock()
+
+	if client.renewed.Swap(false) {
+		client.lastOptions = time.Time{}
+	}
+	if now := time.Now(); now.Sub(client.lastOptions) >= optionsRefresh {
+		// the options are not needed for the dashboard; when they fail the last ones stay
+		if err := client.pollOptions(); err != nil {
+			if isConnectionError(err) {
+				return err
+			}
+			client.logger().Warn("options failed, keeping the last value", "error", err)
+		}
+		client.lastOptions = now
+	}
+	return nil
+}
+
+//
+// method pollOptions
+//
+// fetch the options of the client and of each of its slots, defaults included
+//
+func (client *FAHClient) pollOptions() error {
+	options := Options{}
+	if err := client.call("options -a", &options); err != nil {
+		return err
+	}
+
+	client.mu.RLock()
+	slots := client.Slots.Slots
+	client.mu.RUnlock()
+
+	slotOptions := make(map[string]FAHOptions, len(slots))
+	for _, slot := range slots {
+		reply := SlotOptions{}
+		if err := client.call("slot-options "+slot.ID+" -a", &reply); err != nil {
+			return err
+		}
+		slotOptions[slot.ID] = reply.Options
+	}
+
+	client.mu.Lock()
+	client.Options = options.Options
+	client.SlotOptions = slotOptions
+	client.mu.Unlock()
+	return nil
+}
+
+//
+// method setOptions
+//
+// change options of the client, e.g. "user=anna team=1234", and save them to
+// its config.xml so they survive a restart
+//
+func (client *FAHClient) setOptions(changes string) error {
+	if err := client.call("options "+changes, nil); err != nil {
+		return err
+	}
+	if err := client.call("save", nil); err != nil {
+		return fmt.Errorf("%w: %v", errOptionsNotSaved, err)
+	}
+	return nil
+}
+
+// errOptionsNotSaved is the error of setOptions when the client took the options but could not save them
+var errOptionsNotSaved = errors.New("options changed but not saved")
+
+//
+// loadState
+//
+// loop for one FAH client; returns after a failed poll so the client gets connected again
 //
 func (client *FAHClient) loadState() {
 
 	for true {
-		if client.connection == nil {
+		// a reconnect from the web page holds rpc until the new connection is there
+		client.rpc.Lock()
+		connected := client.isConnected()
+		client.rpc.Unlock()
+		if !connected {
 			return
 		}
 
-		err := client.send(slotinfo)
-		if err == nil {
-			_ = client.receive(&client.Slots)
-		}
-
-		err = client.send(queueinfo)
-		if err == nil {
-			_ = client.receive(&client.Units)
+		start := time.Now()
+		err := client.poll()
+		client.stats.recordPoll(start, err)
+		if err != nil {
+			client.logger().Warn("poll failed", "error", err)
+			_ = client.disconnect(err)
+			publishFAH(client)
+			return
 		}
+		publishFAH(client)
 
 		time.Sleep(time.Duration(client.Refresh) * time.Second)
 
@@ -210,6 +424,7 @@ func loadFahStats() {
 
 	// loop forever (in background) and fetch disconnected clients for reconnect
 	for true {
+		fahSweep.Store(time.Now().UnixNano())
 		// go over the list of clients
 		for idx := range dcClients.FAHConfig.Clients {
 			// get the reference
@@ -217,18 +432,17 @@ func loadFahStats() {
 			// if we have no connection yet
 			if client.isConnected() == false {
 				// then open the connection
-				client.connect()
-				fmt.Printf("%s client %s (%s)\n", client.flavor(), client.Name, client.Ip)
-
-				// and if successful start loading the data in background
-				if client.isConnected() == true {
-					go func() {
-						client.loadState()
-					}()
+				if err := client.connect(); err != nil {
+					client.logger().Warn("connect failed", "error", err)
 				}
 			}
+
+			// and if connected make sure the data is loaded in background
+			if client.isConnected() == true {
+				client.startPolling(client.loadState)
+			}
 		}
 		// wait a period of time and try the client list again to connect those not yet connected
-		time.Sleep(20 * time.Second)
+		time.Sleep(sweepInterval)
 	}
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//
+// FAH options
+//
+// Whom a FAH client folds for and how: user, team and passkey, the power it
+// may use and the cause it prefers, plus what each slot has of its own, like
+// the GPU it runs on. /fah/options shows them for every client, the passkey
+// only as set or not; operators change user, team, power and cause on one
+// client or several at once.
+//
+
+// FAHSettings are the options shown for a client and for each of its slots
+type FAHSettings struct {
+	User       string
+	Team       string
+	PasskeySet bool // the passkey itself is never shown
+	Power      string
+	Cause      string
+}
+
+// FAHHostOptions
+//
+// The options of a FAH client, prepared for display
+type FAHHostOptions struct {
+	Known bool // polled at least once
+	FAHSettings
+	Slots []FAHSlotOptions
+}
+
+// FAHSlotOptions are the options of one slot; the settings are empty where the slot goes with the client's
+type FAHSlotOptions struct {
+	ID          string
+	Description string
+	FAHSettings
+	GPUIndex string // empty for CPU slots
+	CPUs     string // empty for GPU slots
+	Paused   bool
+}
+
+// fahSettings picks the settings out of the options
+func fahSettings(options FAHOptions) FAHSettings {
+	return FAHSettings{
+		User:       options["user"],
+		Team:       options["team"],
+		PasskeySet: options["passkey"] != "",
+		Power:      options["power"],
+		Cause:      options["cause"],
+	}
+}
+
+// hostOptions prepares the options of a client and its slots for display
+func hostOptions(options FAHOptions, slots []Slot, slotOptions map[string]FAHOptions) FAHHostOptions {
+	host := FAHHostOptions{
+		Known:       options != nil,
+		FAHSettings: fahSettings(options),
+	}
+	for _, slot := range slots {
+		own := slotOptions[slot.ID]
+		slotView := FAHSlotOptions{
+			ID:          slot.ID,
+			Description: slot.Description,
+			FAHSettings: fahSettings(own),
+			Paused:      own["paused"] == "true",
+		}
+		// the description starts with the type, e.g. "gpu:1:TU116 [GeForce GTX 1660 SUPER]"
+		if strings.HasPrefix(slot.Description, "gpu") {
+			slotView.GPUIndex = own["gpu-index"]
+		} else {
+			slotView.CPUs = own["cpus"]
+		}
+		host.Slots = append(host.Slots, slotView)
+	}
+	return host
+}
+
+// fahOptionField is an option operators may change
+type fahOptionField struct {
+	name  string // as in config.xml and the form
+	check func(value string) (string, error)
+}
+
+// fahUserPattern are the characters Folding@home takes for a user name
+var fahUserPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-(){}\[\]^~!$]{1,100}$`)
+
+var fahPowers = []string{"light", "medium", "full"}
+var fahCauses = []string{"ANY", "ALZHEIMERS", "CANCER", "HUNTINGTONS", "PARKINSONS"}
+
+var fahOptionFields = []fahOptionField{
+	{"user", func(value string) (string, error) {
+		if !fahUserPattern.MatchString(value) {
+			return "", fmt.Errorf("user: %q is no Folding@home user name", value)
+		}
+		return value, nil
+	}},
+	{"team", func(value string) (string, error) {
+		team, err := strconv.ParseUint(value, 10, 31)
+		if err != nil {
+			return "", fmt.Errorf("team: %q is no team number", value)
+		}
+		return strconv.FormatUint(team, 10), nil
+	}},
+	{"power", func(value string) (string, error) {
+		return oneOf("power", strings.ToLower(value), fahPowers)
+	}},
+	{"cause", func(value string) (string, error) {
+		return oneOf("cause", strings.ToUpper(value), fahCauses)
+	}},
+}
+
+// oneOf checks that value is one of the choices for the option name
+func oneOf(name string, value string, choices []string) (string, error) {
+	for _, choice := range choices {
+		if value == choice {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %q is none of %s", name, value, strings.Join(choices, ", "))
+}
+
+// parseFahOptionChanges reads the options given in the form as "name=value" for the options command; empty ones stay as they are
+func parseFahOptionChanges(form url.Values) ([]string, error) {
+	var changes []string
+	for _, field := range fahOptionFields {
+		text := strings.TrimSpace(form.Get(field.name))
+		if text == "" {
+			continue
+		}
+		value, err := field.check(text)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, field.name+"="+value)
+	}
+	return changes, nil
+}
+
+// fahOptionsHandler shows the options of all FAH clients
+func fahOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Hosts  []FAHClientView
+		Powers []string
+		Causes []string
+	}{
+		Hosts:  fahViews(),
+		Powers: fahPowers,
+		Causes: fahCauses,
+	}
+	renderPage(w, r, "cvDCollector_fah_options.html", data)
+}
+
+// fahOptionsAPIHandler returns the options of all FAH clients as JSON
+func fahOptionsAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	type optionsEntry struct {
+		Name string
+		Ip   string
+		FAHHostOptions
+	}
+	hosts := []optionsEntry{}
+	for _, view := range fahViews() {
+		hosts = append(hosts, optionsEntry{Name: view.Name, Ip: view.Ip, FAHHostOptions: view.Options})
+	}
+	outputJSON(w, hosts)
+}
+
+// setFahOptionsHandler
+//
+// Change user, team, power or cause of the FAH clients of the path ("pi",
+// "pi,nas" or "all") to the values of the form
+func setFahOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Path[len("/set-fah-options/"):]
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	changes, err := parseFahOptionChanges(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(changes) == 0 {
+		http.Error(w, "nothing to change", http.StatusBadRequest)
+		return
+	}
+
+	clients, err := findFAHClients(names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	done, failed := 0, 0
+	var messages []string
+	for _, client := range clients {
+		err := client.setOptions(strings.Join(changes, " "))
+		audit(r, client.Name, "set-fah-options", "options "+strings.Join(changes, " "), "", err)
+		if err != nil {
+			client.logger().Warn("options failed", "error", err)
+			messages = append(messages, client.Name+": "+err.Error())
+			failed++
+			// unsaved options apply anyway until the client restarts
+			if !errors.Is(err, errOptionsNotSaved) {
+				continue
+			}
+		} else {
+			done++
+		}
+
+		// show the new options right away
+		if err := client.pollOptions(); err != nil {
+			client.logger().Warn("options -a failed", "error", err)
+		}
+		publishFAH(client)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if failed > 0 {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	_, _ = fmt.Fprintf(w, "set-fah-options: %d done, %d failed\n", done, failed)
+	if len(messages) > 0 {
+		_, _ = fmt.Fprintln(w, strings.Join(messages, "\n"))
+	}
+}
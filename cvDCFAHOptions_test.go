@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFahOptions(t *testing.T) {
+	server := startFakeFah(t, "")
+	client := newTestFahClient(server, "")
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.disconnect(nil)
+
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Options["user"] != "ChristianVirtual" || client.Options["passkey"] == "" || client.SlotOptions["01"]["gpu-index"] != "0" {
+		t.Fatalf("options %v, slots %v", client.Options, client.SlotOptions)
+	}
+	// the options are polled once in a while only
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(server.received(), " "); got != "auth slot-info queue-info options slot-options slot-options slot-info queue-info" {
+		t.Errorf("requests %s", got)
+	}
+
+	view := client.view().Options
+	want := FAHSettings{User: "ChristianVirtual", Team: "224497", PasskeySet: true, Power: "full", Cause: "ANY"}
+	if !view.Known || view.FAHSettings != want || len(view.Slots) != 2 {
+		t.Fatalf("view %+v", view)
+	}
+	cpu, gpu := view.Slots[0], view.Slots[1]
+	if cpu.CPUs != "3" || cpu.GPUIndex != "" || cpu.Team != "" || cpu.Paused {
+		t.Errorf("cpu slot %+v", cpu)
+	}
+	if gpu.GPUIndex != "0" || gpu.CPUs != "" || gpu.Team != "238316" || !gpu.Paused {
+		t.Errorf("gpu slot %+v", gpu)
+	}
+
+	// options that fail keep the last ones, the slots are polled on
+	server.setReply("options", func(string) string { return "\nERROR: permission denied\n" })
+	client.lastOptions = time.Time{}
+	if err := client.poll(); err != nil || !client.isConnected() || client.Options["user"] != "ChristianVirtual" || client.lastOptions.IsZero() {
+		t.Errorf("failing options: %v, %v", err, client.Options)
+	}
+
+	// errors of the FAH client come back as such
+	if err := client.call("slot-options 07 -a", &SlotOptions{}); err == nil || err.Error() != "slot not found" {
+		t.Errorf("unknown slot: %v", err)
+	}
+}
+
+func TestParseFahOptionChanges(t *testing.T) {
+	tests := []struct {
+		form url.Values
+		want string
+		err  bool
+	}{
+		{url.Values{"user": {" anna_b "}, "team": {"0224497"}, "power": {"Light"}, "cause": {"cancer"}}, "user=anna_b team=224497 power=light cause=CANCER", false},
+		{url.Values{"team": {""}, "power": {"full"}}, "power=full", false},
+		{url.Values{}, "", false},
+		{url.Values{"user": {"anna b"}}, "", true},
+		{url.Values{"user": {"anna>"}}, "", true},
+		{url.Values{"team": {"-1"}}, "", true},
+		{url.Values{"power": {"turbo"}}, "", true},
+		{url.Values{"cause": {"covid"}}, "", true},
+	}
+	for _, test := range tests {
+		changes, err := parseFahOptionChanges(test.form)
+		if (err != nil) != test.err || strings.Join(changes, " ") != test.want {
+			t.Errorf("%v: %q, %v", test.form, changes, err)
+		}
+	}
+}
+
+func TestSetFahOptions(t *testing.T) {
+	withAuth(t, AuthConfig{})
+	blackbox, nas := startFakeFah(t, ""), startFakeFah(t, "")
+	options := fixture(t, "fah/options.pyon")
+	for _, server := range []*fakeServer{blackbox, nas} {
+		server.setReply("options", func(request string) string {
+			if request == "options -a" {
+				return options
+			}
+			return "\nPyON 1 options\n{\"user\": \"anna\", \"team\": \"1234\"}\n---\n"
+		})
+		server.setReply("save", func(string) string { return "" })
+	}
+	saved := dcClients.FAHConfig.Clients
+	defer func() { dcClients.FAHConfig.Clients = saved }()
+	blackboxIp, blackboxPort := blackbox.Addr()
+	nasIp, nasPort := nas.Addr()
+	dcClients.FAHConfig.Clients = []FAHClient{
+		{DCClient: DCClient{Name: "blackbox", Ip: blackboxIp, Port: blackboxPort}},
+		{DCClient: DCClient{Name: "nas", Ip: nasIp, Port: nasPort}},
+	}
+	for idx := range dcClients.FAHConfig.Clients {
+		client := &dcClients.FAHConfig.Clients[idx]
+		if err := client.connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer client.disconnect(nil)
+		if err := client.poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	post := func(path string, form url.Values) (int, string) {
+		form.Set("csrf", csrfToken(User{}))
+		request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = "127.0.0.1:4711"
+		recorder := httptest.NewRecorder()
+		authorize(RoleOperator, setFahOptionsHandler)(recorder, request)
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, body := post("/set-fah-options/all", url.Values{"user": {"anna"}, "team": {"1234"}}); code != 200 || !strings.HasPrefix(body, "set-fah-options: 2 done, 0 failed") {
+		t.Errorf("set: %d %q", code, body)
+	}
+	for _, server := range []*fakeServer{blackbox, nas} {
+		if got := strings.Join(server.received(), "|"); !strings.HasSuffix(got, "|options|save|options|slot-options|slot-options") {
+			t.Errorf("requests %s", got)
+		}
+	}
+
+	// nas does not save
+	nas.setReply("save", func(string) string { return "\nERROR: permission denied\n" })
+	if code, body := post("/set-fah-options/blackbox,nas", url.Values{"power": {"light"}}); code != 502 || !strings.Contains(body, "1 done, 1 failed\nnas: options changed but not saved: permission denied") {
+		t.Errorf("failing save: %d %q", code, body)
+	}
+	if got := strings.Join(nas.received(), "|"); !strings.HasSuffix(got, "|options|save|options|slot-options|slot-options") {
+		t.Errorf("unsaved options are not shown: %s", got)
+	}
+	if code, _ := post("/set-fah-options/blackbox", url.Values{"team": {"many"}}); code != 400 {
+		t.Errorf("bad team: %d", code)
+	}
+	if code, _ := post("/set-fah-options/blackbox", url.Values{}); code != 400 {
+		t.Errorf("nothing to change: %d", code)
+	}
+	if code, _ := post("/set-fah-options/blackbox,mac", url.Values{"power": {"full"}}); code != 404 {
+		t.Errorf("unknown client: %d", code)
+	}
+
+	entries, err := readAudit(auditFile(), "nas", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, entry := range entries {
+		commands = append(commands, entry.Action+": "+entry.Command+" "+entry.Outcome)
+	}
+	if got := strings.Join(commands, "|"); got != "set-fah-options: options power=light failed|set-fah-options: options user=anna team=1234 ok" {
+		t.Errorf("audit %q", commands)
+	}
+
+	// the passkey stays on the clients
+	recorder := httptest.NewRecorder()
+	fahOptionsAPIHandler(recorder, httptest.NewRequest("GET", "/api/fah/options", nil))
+	var hosts []struct {
+		Name string
+		FAHHostOptions
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &hosts); err != nil || len(hosts) != 2 || !hosts[1].PasskeySet || len(hosts[1].Slots) != 2 || strings.Contains(recorder.Body.String(), "0123456789abcdef") {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+	recorder = httptest.NewRecorder()
+	fahOptionsHandler(recorder, httptest.NewRequest("GET", "/fah/options", nil))
+	if body := recorder.Body.String(); recorder.Code != 200 || !strings.Contains(body, "<td>ChristianVirtual</td>") || !strings.Contains(body, "GPU index 0") || strings.Contains(body, "0123456789abcdef") {
+		t.Errorf("page %d %s", recorder.Code, body)
+	}
+}
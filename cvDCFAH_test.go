@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFahConnectAndPoll(t *testing.T) {
+	server := startFakeFah(t, "secret")
+	client := newTestFahClient(server, "secret")
+
+	if err := client.connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.disconnect(nil)
+
+	if err := client.poll(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	if len(client.Slots.Slots) != 2 || client.Slots.Slots[0].Status != "RUNNING" || client.Slots.Slots[1].Idle {
+		t.Errorf("slots = %+v", client.Slots.Slots)
+	}
+	if len(client.Units.Units) != 1 {
+		t.Fatalf("units = %d, want 1", len(client.Units.Units))
+	}
+	unit := client.Units.Units[0]
+	if unit.Project != 17326 || unit.Run != 7 || unit.Clone != 1184 || unit.Gen != 41 || unit.Percentdone != "37.21%" {
+		t.Errorf("unit = %+v", unit)
+	}
+}
+
+func TestFahWrongPassword(t *testing.T) {
+	server := startFakeFah(t, "secret")
+	client := newTestFahClient(server, "wrong")
+
+	if err := client.connect(); err == nil {
+		t.Fatal("connect with wrong password succeeded")
+	}
+	if client.isConnected() {
+		t.Error("client still connected after failed authorization")
+	}
+}
+
+func TestFahReconnect(t *testing.T) {
+	server := startFakeFah(t, "")
+	client := newTestFahClient(server, "")
+
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.dropConnections()
+	client.loadState()
+	if client.isConnected() {
+		t.Fatal("client still connected after the server dropped the connection")
+	}
+	if len(client.Units.Units) != 1 {
+		t.Error("cached units lost after a failed poll")
+	}
+
+	if err := client.connect(); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	defer client.disconnect(nil)
+	if err := client.poll(); err != nil {
+		t.Fatalf("poll after reconnect: %v", err)
+	}
+}
+
+func TestPyPON2JSON(t *testing.T) {
+	msg := PyPON2JSON("\nPyON 1 slots\n[{\"idle\": True}, {\"idle\": False}]\n---\n>")
+	want := "{\n\n\"slots\":\n[{\"idle\": true}, {\"idle\": false}]\n}"
+	if msg != want {
+		t.Errorf("PyPON2JSON = %q, want %q", msg, want)
+	}
+}
+
+// a reconnect from the web page while the poller fetches the options makes it fetch them again
+func TestFahReconnectWhilePolling(t *testing.T) {
+	server := startFakeFah(t, "")
+	slotOptions := fixture(t, "fah/slot-options-00.pyon")
+	server.setReply("slot-options", func(string) string {
+		time.Sleep(50 * time.Millisecond)
+		return slotOptions
+	})
+	client := newTestFahClient(server, "")
+	client.Refresh = 1
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	client.startPolling(client.loadState)
+
+	// the reconnect waits for the slot options the poller asked for
+	for start := time.Now(); !strings.Contains(strings.Join(server.received(), " "), "slot-options") && time.Since(start) < 5*time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if err := client.reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); client.stats.snapshot().Polls < 2 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := client.stats.snapshot(); stats.Polls < 2 || stats.Failures != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+	polled := 0
+	for _, request := range server.received() {
+		if request == "options" {
+			polled++
+		}
+	}
+	if polled < 2 {
+		t.Errorf("options polled %d times", polled)
+	}
+
+	_ = client.disconnect(nil)
+	for start := time.Now(); client.polling.Load() && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectionErrors(t *testing.T) {
+	client := newTestFahClient(startFakeFah(t, ""), "")
+	err := client.call(slotinfo, &Slots{})
+	if !errors.Is(err, errNotConnected) || !isConnectionError(fmt.Errorf("options: %w", err)) {
+		t.Errorf("without connection: %v", err)
+	}
+	if boinc := (&BoincClient{}); !errors.Is(boinc.call(&GetState{}, &ClientStateReply{}), errNotConnected) {
+		t.Error("BOINC without connection")
+	}
+	// errors the client answers with are none
+	if isConnectionError(errors.New("slot not found")) {
+		t.Error("reply error taken for a connection error")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+)
+
+//
+// Fake clients
+//
+// Small in-process stand-ins for a BOINC GUI RPC server and a FAH v7 command
+// server. They speak just enough of each protocol (handshake, framing and a
+// table of replies per request) for BoincClient and FAHClient to connect,
+// authenticate and poll against them without real clients on the network.
+//
+
+// fakeReply produces the reply for one request; request holds the raw text
+// received from the collector (the XML document for BOINC, the command line for FAH)
+type fakeReply func(request string) string
+
+// fakeServer
+//
+// Listener, connection bookkeeping and reply table shared by both fakes
+type fakeServer struct {
+	Password string
+
+	listener net.Listener
+	serve    func(conn net.Conn)
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	replies  map[string]fakeReply
+	requests []string
+	wg       sync.WaitGroup
+}
+
+// newFakeBoincServer
+//
+// Start a fake BOINC client listening on addr (e.g. "127.0.0.1:0")
+func newFakeBoincServer(addr string, password string) (*fakeServer, error) {
+	server := &fakeServer{Password: password}
+	server.serve = server.serveBoinc
+	return server, server.listen(addr)
+}
+
+// newFakeFahServer
+//
+// Start a fake FAH client listening on addr (e.g. "127.0.0.1:0")
+func newFakeFahServer(addr string, password string) (*fakeServer, error) {
+	server := &fakeServer{Password: password}
+	server.serve = server.serveFah
+	return server, server.listen(addr)
+}
+
+func (server *fakeServer) listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server.mu.Lock()
+	server.listener = listener
+	if server.conns == nil {
+		server.conns = make(map[net.Conn]struct{})
+	}
+	server.mu.Unlock()
+
+	server.wg.Add(1)
+	go func() {
+		defer server.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.track(conn, true)
+			server.wg.Add(1)
+			go func() {
+				defer server.wg.Done()
+				defer server.track(conn, false)
+				defer conn.Close()
+				server.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+func (server *fakeServer) track(conn net.Conn, open bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if open {
+		server.conns[conn] = struct{}{}
+	} else {
+		delete(server.conns, conn)
+	}
+}
+
+// Addr returns host and port the fake is listening on, ready for a DCClient
+func (server *fakeServer) Addr() (string, int) {
+	tcpAddr := server.listener.Addr().(*net.TCPAddr)
+	return tcpAddr.IP.String(), tcpAddr.Port
+}
+
+// setReply registers the reply for a request (BOINC tag or FAH command)
+func (server *fakeServer) setReply(request string, reply fakeReply) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.replies == nil {
+		server.replies = make(map[string]fakeReply)
+	}
+	server.replies[request] = reply
+}
+
+// setRecordedReply registers a fixed, previously recorded reply for a request
+func (server *fakeServer) setRecordedReply(request string, recorded string) {
+	server.setReply(request, func(string) string {
+		return recorded
+	})
+}
+
+// received returns the requests seen so far, in order
+func (server *fakeServer) received() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string(nil), server.requests...)
+}
+
+func (server *fakeServer) lookup(request string) (fakeReply, bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.requests = append(server.requests, request)
+	reply, ok := server.replies[request]
+	return reply, ok
+}
+
+// dropConnections closes every open connection but keeps listening, like a
+// client restarting its RPC server
+func (server *fakeServer) dropConnections() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for conn := range server.conns {
+		_ = conn.Close()
+	}
+}
+
+// Close stops listening, drops all connections and waits for the handlers
+func (server *fakeServer) Close() error {
+	err := server.listener.Close()
+	server.dropConnections()
+	server.wg.Wait()
+	return err
+}
+
+// serveBoinc
+//
+// GUI RPC conversation: messages are terminated by 0x03, the first two requests
+// are expected to be the auth1/auth2 handshake with md5(nonce+password)
+func (server *fakeServer) serveBoinc(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	nonce := fmt.Sprintf("%d.%06d", rand.Int31(), rand.Intn(1000000))
+	authorized := false
+
+	for {
+		request, err := reader.ReadString(0x03)
+		if err != nil {
+			return
+		}
+		tag := boincRequestTag(request)
+
+		var reply string
+		switch {
+		case tag == "auth1":
+			server.lookup(tag)
+			reply = boincReply("<nonce>" + nonce + "</nonce>")
+		case tag == "auth2":
+			server.lookup(tag)
+			hash := md5.Sum([]byte(nonce + server.Password))
+			if strings.Contains(request, hex.EncodeToString(hash[:])) {
+				authorized = true
+				reply = boincReply("<authorized/>")
+			} else {
+				reply = boincReply("<unauthorized/>")
+			}
+		case !authorized:
+			server.lookup(tag)
+			reply = boincReply("<unauthorized/>")
+		default:
+			if handler, ok := server.lookup(tag); ok {
+				reply = handler(request)
+			} else {
+				reply = boincReply("<error>unrecognized op: " + tag + "</error>")
+			}
+		}
+
+		if _, err := fmt.Fprintf(conn, "%s\x03", reply); err != nil {
+			return
+		}
+	}
+}
+
+// boincRequestTag returns the name of the operation inside a GUI RPC request
+func boincRequestTag(request string) string {
+	decoder := xml.NewDecoder(strings.NewReader(strings.TrimSuffix(request, "\x03")))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "boinc_gui_rpc_request" {
+			return start.Name.Local
+		}
+	}
+}
+
+// boincReply wraps a reply body the way the BOINC client does
+func boincReply(body string) string {
+	return "<boinc_gui_rpc_reply>\n" + body + "\n</boinc_gui_rpc_reply>\n"
+}
+
+// serveFah
+//
+// FAH v7 telnet style conversation: a banner, then one command per line, each
+// answer followed by the "> " prompt
+func (server *fakeServer) serveFah(conn net.Conn) {
+	const prompt = "> "
+	authorized := server.Password == ""
+
+	if _, err := fmt.Fprintf(conn, "\nWelcome to the Folding@home Client command server.\n%s", prompt); err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		command := strings.Fields(line)[0]
+
+		var reply string
+		switch {
+		case command == "exit" || command == "quit":
+			server.lookup(command)
+			return
+		case command == "auth":
+			server.lookup(command)
+			if server.Password == "" || strings.TrimSpace(strings.TrimPrefix(line, "auth")) == server.Password {
+				authorized = true
+				reply = "OK\n"
+			} else {
+				reply = "FAILED\n"
+			}
+		case !authorized:
+			server.lookup(command)
+			reply = "\nERROR: unauthorized\n"
+		default:
+			if handler, ok := server.lookup(command); ok {
+				reply = handler(line)
+			} else {
+				reply = "\nERROR: unknown command '" + command + "'\n"
+			}
+		}
+
+		if _, err := fmt.Fprintf(conn, "%s%s", reply, prompt); err != nil {
+			return
+		}
+	}
+}
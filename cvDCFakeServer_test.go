@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//
+// helpers to run BoincClient and FAHClient against the fakes with recorded replies
+//
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func startFakeBoinc(t *testing.T, password string) *fakeServer {
+	t.Helper()
+	server, err := newFakeBoincServer("127.0.0.1:0", password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	server.setRecordedReply("get_state", fixture(t, "boinc/get_state.xml"))
+	server.setRecordedReply("get_simple_gui_info", fixture(t, "boinc/get_simple_gui_info.xml"))
+	server.setRecordedReply("get_cc_status", fixture(t, "boinc/get_cc_status.xml"))
+	server.setRecordedReply("get_results", fixture(t, "boinc/get_results.xml"))
+	server.setRecordedReply("get_disk_usage", fixture(t, "boinc/get_disk_usage.xml"))
+	server.setRecordedReply("get_file_transfers", fixture(t, "boinc/get_file_transfers.xml"))
+	server.setRecordedReply("get_global_prefs_working", fixture(t, "boinc/get_global_prefs_working.xml"))
+	server.setRecordedReply("get_global_prefs_override", fixture(t, "boinc/get_global_prefs_override.xml"))
+	server.setRecordedReply("get_all_projects_list", fixture(t, "boinc/get_all_projects_list.xml"))
+	return server
+}
+
+func startFakeFah(t *testing.T, password string) *fakeServer {
+	t.Helper()
+	server, err := newFakeFahServer("127.0.0.1:0", password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	server.setRecordedReply("slot-info", fixture(t, "fah/slots.pyon"))
+	server.setRecordedReply("queue-info", fixture(t, "fah/units.pyon"))
+	server.setRecordedReply("options", fixture(t, "fah/options.pyon"))
+	slotOptions := map[string]string{
+		"00": fixture(t, "fah/slot-options-00.pyon"),
+		"01": fixture(t, "fah/slot-options-01.pyon"),
+	}
+	server.setReply("slot-options", func(request string) string {
+		if fields := strings.Fields(request); len(fields) > 1 && slotOptions[fields[1]] != "" {
+			return slotOptions[fields[1]]
+		}
+		return "\nERROR: slot not found\n"
+	})
+	return server
+}
+
+func newTestBoincClient(server *fakeServer, password string) *BoincClient {
+	ip, port := server.Addr()
+	client := &BoincClient{}
+	client.Name, client.Ip, client.Port, client.Pwd = "pi", ip, port, password
+	return client
+}
+
+// polledTestBoinc returns a fake BOINC client and a BoincClient connected to it
+// and polled once; the connection is closed when the test ends
+func polledTestBoinc(t *testing.T) (*fakeServer, *BoincClient) {
+	t.Helper()
+	server := startFakeBoinc(t, "")
+	client := newTestBoincClient(server, "")
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.disconnect(nil) })
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func newTestFahClient(server *fakeServer, password string) *FAHClient {
+	ip, port := server.Addr()
+	client := &FAHClient{}
+	client.Name, client.Ip, client.Port, client.Pwd = "blackbox", ip, port, password
+	return client
+}
+
+func TestFakeServerRecordsRequests(t *testing.T) {
+	server := startFakeBoinc(t, "")
+	client := newTestBoincClient(server, "")
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.disconnect(nil)
+
+	if err := client.send(&GetState{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.receive(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got := server.received()
+	want := []string{"auth1", "auth2", "get_state"}
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Fatalf("requests = %v, want %v", got, want)
+		}
+	}
+}
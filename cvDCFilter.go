@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//
+// Filtering of BOINC tasks and FAH units
+//
+// The pages and the API take the same query parameters, all optional and
+// combined with "and":
+//
+//   client   name of the client, also taken from the path (/boinc/<client>, "all" for every client)
+//   project  part of the project name or URL, or its initials (wcg for World Community Grid);
+//            the project number for FAH
+//   app      part of the application name; the core for FAH
+//   state    comma separated status keys (BOINC: running,waiting,...; FAH: the unit state, e.g. ready)
+//   due      deadline within this window from now, e.g. 36h or 3d; includes missed deadlines
+//   q        part of the WU or result name; the PRCG for FAH, e.g. "17326 (7,1184,41)"
+//
+
+// UnitFilter holds the parsed filter parameters of a request
+type UnitFilter struct {
+	Client  string
+	Project string
+	App     string
+	State   string
+	Due     string
+	Search  string
+
+	states []string
+	due    time.Duration
+}
+
+// parseUnitFilter
+//
+// Read the filter of a request to prefix (e.g. "/boinc/"); fails on a deadline
+// window it cannot read, so a typo does not silently show everything
+func parseUnitFilter(r *http.Request, prefix string) (UnitFilter, error) {
+	filter := UnitFilter{
+		Client:  r.FormValue("client"),
+		Project: strings.TrimSpace(r.FormValue("project")),
+		App:     strings.TrimSpace(r.FormValue("app")),
+		State:   strings.TrimSpace(r.FormValue("state")),
+		Due:     strings.TrimSpace(r.FormValue("due")),
+		Search:  strings.TrimSpace(r.FormValue("q")),
+	}
+	if filter.Client == "" && strings.HasPrefix(r.URL.Path, prefix) {
+		filter.Client = r.URL.Path[len(prefix):]
+	}
+	if filter.Client == "all" {
+		filter.Client = ""
+	}
+
+	for _, state := range strings.Split(filter.State, ",") {
+		if state = strings.ToLower(strings.TrimSpace(state)); state != "" {
+			filter.states = append(filter.states, state)
+		}
+	}
+
+	if filter.Due != "" {
+		due, err := parseDueWindow(filter.Due)
+		if err != nil {
+			return filter, err
+		}
+		filter.due = due
+	}
+	return filter, nil
+}
+
+// parseDueWindow reads a deadline window as Go duration or in days ("3d")
+func parseDueWindow(text string) (time.Duration, error) {
+	if days := strings.TrimSuffix(text, "d"); days != text {
+		if count, err := strconv.ParseFloat(days, 64); err == nil && count >= 0 {
+			return time.Duration(count * float64(24*time.Hour)), nil
+		}
+	} else if due, err := time.ParseDuration(text); err == nil && due >= 0 {
+		return due, nil
+	}
+	return 0, fmt.Errorf("invalid deadline window %q", text)
+}
+
+// checkTaskStates fails for states which are no BOINC task status key
+func (filter UnitFilter) checkTaskStates() error {
+	for _, state := range filter.states {
+		if _, ok := parseTaskStatus(state); !ok {
+			return fmt.Errorf("unknown state %q", state)
+		}
+	}
+	return nil
+}
+
+// IsSet tells whether the filter restricts anything
+func (filter UnitFilter) IsSet() bool {
+	return filter.Client != "" || filter.Project != "" || filter.App != "" ||
+		filter.State != "" || filter.Due != "" || filter.Search != ""
+}
+
+// matchClient tells whether a client passes the client filter
+func (filter UnitFilter) matchClient(name string) bool {
+	return filter.Client == "" || strings.EqualFold(filter.Client, name)
+}
+
+// matchState tells whether a state key is one of the requested
+func (filter UnitFilter) matchState(key string) bool {
+	if len(filter.states) == 0 {
+		return true
+	}
+	for _, state := range filter.states {
+		if strings.EqualFold(state, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDue tells whether a deadline lies within the deadline window
+func (filter UnitFilter) matchDue(deadline time.Time, now time.Time) bool {
+	return filter.Due == "" || !deadline.After(now.Add(filter.due))
+}
+
+// containsFold is a case insensitive strings.Contains
+func containsFold(text string, part string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(part))
+}
+
+// initials of a name, e.g. "wcg" for "World Community Grid"
+func initials(name string) string {
+	var text strings.Builder
+	for _, word := range strings.Fields(name) {
+		text.WriteRune(unicode.ToLower([]rune(word)[0]))
+	}
+	return text.String()
+}
+
+// matchTask tells whether a BOINC task passes the filter
+func (filter UnitFilter) matchTask(task *BoincTask, now time.Time) bool {
+	if !filter.matchClient(task.Client) {
+		return false
+	}
+	if filter.Project != "" && !containsFold(task.ProjectName, filter.Project) &&
+		!containsFold(task.ProjectUrl, filter.Project) && initials(task.ProjectName) != strings.ToLower(filter.Project) {
+		return false
+	}
+	if filter.App != "" && !containsFold(task.AppName, filter.App) {
+		return false
+	}
+	if filter.Search != "" && !containsFold(task.WUName, filter.Search) && !containsFold(task.Name, filter.Search) {
+		return false
+	}
+	return filter.matchState(task.Status.Key()) &&
+		filter.matchDue(time.Unix(int64(task.ReportDeadline), 0), now)
+}
+
+// matchUnit tells whether a FAH unit passes the filter (the client is checked per view)
+func (filter UnitFilter) matchUnit(unit *Unit, now time.Time) bool {
+	if filter.Project != "" && strconv.Itoa(unit.Project) != filter.Project {
+		return false
+	}
+	if filter.App != "" && !containsFold(unit.Core, filter.App) {
+		return false
+	}
+	if filter.Search != "" && !containsFold(unit.PRCG(), filter.Search) {
+		return false
+	}
+	if filter.Due != "" {
+		deadline, err := time.Parse(time.RFC3339, unit.Deadline)
+		if err != nil || !filter.matchDue(deadline, now) {
+			return false
+		}
+	}
+	return filter.matchState(unit.State)
+}
+
+// filterBoincViews
+//
+// Drop the clients and tasks not passing the filter; the counters of the
+// clients keep covering all their tasks
+func filterBoincViews(views []BoincClientView, filter UnitFilter, now time.Time) []BoincClientView {
+	if !filter.IsSet() {
+		return views
+	}
+	var filtered []BoincClientView
+	for _, view := range views {
+		if !filter.matchClient(view.Name) {
+			continue
+		}
+		tasks := view.Tasks
+		view.Tasks = nil
+		for idx := range tasks {
+			if filter.matchTask(&tasks[idx], now) {
+				view.Tasks = append(view.Tasks, tasks[idx])
+			}
+		}
+		filtered = append(filtered, view)
+	}
+	return filtered
+}
+
+// filterFAHViews drops the clients and units not passing the filter
+func filterFAHViews(views []FAHClientView, filter UnitFilter, now time.Time) []FAHClientView {
+	if !filter.IsSet() {
+		return views
+	}
+	var filtered []FAHClientView
+	for _, view := range views {
+		if !filter.matchClient(view.Name) {
+			continue
+		}
+		units := view.Units
+		view.Units = nil
+		for idx := range units {
+			if filter.matchUnit(&units[idx], now) {
+				view.Units = append(view.Units, units[idx])
+			}
+		}
+		filtered = append(filtered, view)
+	}
+	return filtered
+}
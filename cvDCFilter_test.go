@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseUnitFilter(t *testing.T) {
+	tests := []struct {
+		url    string
+		client string
+		due    time.Duration
+		fails  bool
+	}{
+		{"/boinc/all", "", 0, false},
+		{"/boinc/", "", 0, false},
+		{"/boinc/pi", "pi", 0, false},
+		{"/boinc/all?client=pi", "pi", 0, false},
+		{"/boinc/pi?client=blackbox", "blackbox", 0, false},
+		{"/boinc/all?due=36h", "", 36 * time.Hour, false},
+		{"/boinc/all?due=1.5d", "", 36 * time.Hour, false},
+		{"/boinc/all?due=soon", "", 0, true},
+		{"/boinc/all?due=-2d", "", 0, true},
+	}
+	for _, test := range tests {
+		filter, err := parseUnitFilter(httptest.NewRequest("GET", test.url, nil), "/boinc/")
+		if (err != nil) != test.fails {
+			t.Errorf("%s: error %v", test.url, err)
+			continue
+		}
+		if filter.Client != test.client || filter.due != test.due {
+			t.Errorf("%s: client %q due %s, want %q %s", test.url, filter.Client, filter.due, test.client, test.due)
+		}
+	}
+
+	filter, _ := parseUnitFilter(httptest.NewRequest("GET", "/boinc/all?state=running,Waiting", nil), "/boinc/")
+	if err := filter.checkTaskStates(); err != nil {
+		t.Error(err)
+	}
+	filter, _ = parseUnitFilter(httptest.NewRequest("GET", "/boinc/all?state=runing", nil), "/boinc/")
+	if err := filter.checkTaskStates(); err == nil {
+		t.Error("unknown state accepted")
+	}
+}
+
+func TestFilterBoincViews(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	task := func(client, name, project, url, app string, status TaskStatus, deadline time.Duration) BoincTask {
+		return BoincTask{
+			Result: Result{Name: name + "_0", WUName: name, ProjectUrl: url,
+				ReportDeadline: float64(now.Add(deadline).Unix())},
+			Client:      client,
+			ProjectName: project,
+			AppName:     app,
+			Status:      status,
+		}
+	}
+	views := []BoincClientView{
+		{Name: "pi", Tasks: []BoincTask{
+			task("pi", "opn1_a", "World Community Grid", "http://www.worldcommunitygrid.org/", "OpenPandemics", StatusRunning, 72*time.Hour),
+			task("pi", "rosetta_b", "Rosetta@home", "https://boinc.bakerlab.org/rosetta/", "Rosetta", StatusWaiting, 12*time.Hour),
+		}},
+		{Name: "blackbox", Tasks: []BoincTask{
+			task("blackbox", "opn1_c", "World Community Grid", "http://www.worldcommunitygrid.org/", "OpenPandemics", StatusReadyToStart, -time.Hour),
+			task("blackbox", "einstein_d", "Einstein@Home", "http://einstein.phys.uwm.edu/", "Gravitational Wave search", StatusRunning, 200*time.Hour),
+		}},
+	}
+
+	tests := []struct {
+		filter UnitFilter
+		want   string
+	}{
+		{UnitFilter{}, "pi:opn1_a,rosetta_b blackbox:opn1_c,einstein_d"},
+		{UnitFilter{Client: "PI"}, "pi:opn1_a,rosetta_b"},
+		{UnitFilter{Project: "wcg"}, "pi:opn1_a blackbox:opn1_c"},
+		{UnitFilter{Project: "bakerlab"}, "pi:rosetta_b blackbox:"},
+		{UnitFilter{Project: "einstein"}, "pi: blackbox:einstein_d"},
+		{UnitFilter{App: "wave"}, "pi: blackbox:einstein_d"},
+		{UnitFilter{State: "running", states: []string{"running"}}, "pi:opn1_a blackbox:einstein_d"},
+		{UnitFilter{State: "ready,waiting", states: []string{"ready", "waiting"}}, "pi:rosetta_b blackbox:opn1_c"},
+		{UnitFilter{Due: "1d", due: 24 * time.Hour}, "pi:rosetta_b blackbox:opn1_c"},
+		{UnitFilter{Search: "OPN1"}, "pi:opn1_a blackbox:opn1_c"},
+		{UnitFilter{Search: "c_0"}, "pi: blackbox:opn1_c"},
+		{UnitFilter{Project: "wcg", State: "running", states: []string{"running"}}, "pi:opn1_a blackbox:"},
+	}
+	for _, test := range tests {
+		got := ""
+		for _, view := range filterBoincViews(views, test.filter, now) {
+			if got != "" {
+				got += " "
+			}
+			got += view.Name + ":"
+			for idx, task := range view.Tasks {
+				if idx > 0 {
+					got += ","
+				}
+				got += task.WUName
+			}
+		}
+		if got != test.want {
+			t.Errorf("%+v: %s, want %s", test.filter, got, test.want)
+		}
+	}
+	if len(views[0].Tasks) != 2 || len(views[1].Tasks) != 2 {
+		t.Error("filtering changed the views passed in")
+	}
+}
+
+func TestFilterFAHViews(t *testing.T) {
+	now := time.Date(2021, 1, 29, 0, 0, 0, 0, time.UTC)
+	views := []FAHClientView{
+		{Name: "blackbox", Units: []Unit{
+			{ID: "00", State: "RUNNING", Project: 17326, Run: 7, Clone: 1184, Gen: 41, Core: "0xa8", Deadline: "2021-01-31T07:01:48Z"},
+			{ID: "01", State: "READY", Project: 13424, Run: 1, Clone: 2, Gen: 3, Core: "0x22", Deadline: "2021-02-10T00:00:00Z"},
+		}},
+		{Name: "pi"},
+	}
+
+	tests := []struct {
+		filter UnitFilter
+		want   []string
+	}{
+		{UnitFilter{}, []string{"00", "01"}},
+		{UnitFilter{Project: "13424"}, []string{"01"}},
+		{UnitFilter{App: "0xA8"}, []string{"00"}},
+		{UnitFilter{State: "ready", states: []string{"ready"}}, []string{"01"}},
+		{UnitFilter{Due: "3d", due: 72 * time.Hour}, []string{"00"}},
+		{UnitFilter{Search: "(7,1184,"}, []string{"00"}},
+	}
+	for _, test := range tests {
+		filtered := filterFAHViews(views, test.filter, now)
+		if len(filtered) != 2 || len(filtered[0].Units) != len(test.want) {
+			t.Errorf("%+v: %+v", test.filter, filtered)
+			continue
+		}
+		for idx, id := range test.want {
+			if filtered[0].Units[idx].ID != id {
+				t.Errorf("%+v: unit %s, want %s", test.filter, filtered[0].Units[idx].ID, id)
+			}
+		}
+	}
+
+	if filtered := filterFAHViews(views, UnitFilter{Client: "pi"}, now); len(filtered) != 1 || filtered[0].Name != "pi" {
+		t.Errorf("client filter: %+v", filtered)
+	}
+	if prcg := views[0].Units[0].PRCG(); prcg != "17326 (7,1184,41)" {
+		t.Errorf("PRCG %s", prcg)
+	}
+}
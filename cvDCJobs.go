@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Background jobs
+//
+// Maintenance actions like the benchmarks take a while on every host and
+// may go to the whole farm, so they run as jobs in the background: the
+// request only starts the job, /jobs shows how far each host got and what
+// came of it. The last jobs are kept in memory only.
+//
+
+// JobState tells how far a job, or one host of it, got
+type JobState int
+
+const (
+	JobPending JobState = iota
+	JobRunning
+	JobDone
+	JobFailed
+)
+
+var jobStates = map[JobState]stateInfo{
+	JobPending: {"Pending", "pending", "light"},
+	JobRunning: {"Running", "running", "info"},
+	JobDone:    {"Done", "done", "success"},
+	JobFailed:  {"Failed", "failed", "danger"},
+}
+
+func (state JobState) info() stateInfo { return lookupState(jobStates, state) }
+
+func (state JobState) String() string { return state.info().label }
+func (state JobState) Key() string    { return state.info().key }
+func (state JobState) Class() string  { return state.info().class }
+
+func (state JobState) MarshalJSON() ([]byte, error) { return json.Marshal(state.Key()) }
+
+// JobStep is the part of a job on one client
+type JobStep struct {
+	Client   string
+	State    JobState
+	Progress string // what is going on right now
+	Result   string
+	Error    string
+	Started  time.Time
+	Finished time.Time
+}
+
+// Job
+//
+// One action on one or more clients, run in the background
+type Job struct {
+	ID       int
+	Action   string // as in the path, e.g. run-benchmarks
+	User     string
+	Started  time.Time
+	Finished time.Time // zero while running
+	State    JobState
+	Steps    []JobStep
+
+	StartedAsString  string
+	DurationAsString string
+	Done             int // steps finished, successful or not
+}
+
+// jobsKept is how many finished jobs are remembered
+const jobsKept = 50
+
+// jobList holds the jobs, newest first
+type jobList struct {
+	mu   sync.Mutex
+	next int
+	jobs []*Job
+}
+
+var jobs = &jobList{}
+
+// add registers a new job for the clients and drops the oldest finished ones
+func (list *jobList) add(action string, user string, clients []*BoincClient) *Job {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	list.next++
+	job := &Job{ID: list.next, Action: action, User: user, Started: time.Now(), State: JobRunning}
+	for _, client := range clients {
+		job.Steps = append(job.Steps, JobStep{Client: client.Name})
+	}
+
+	kept := []*Job{job}
+	for _, other := range list.jobs {
+		if len(kept) < jobsKept || other.Finished.IsZero() {
+			kept = append(kept, other)
+		}
+	}
+	list.jobs = kept
+	return job
+}
+
+// update changes a step of a job under the lock
+func (list *jobList) update(job *Job, idx int, change func(step *JobStep)) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	change(&job.Steps[idx])
+}
+
+// finish closes the job once all steps are through
+func (list *jobList) finish(job *Job) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	job.Finished = time.Now()
+	job.State = JobDone
+	for _, step := range job.Steps {
+		if step.State == JobFailed {
+			job.State = JobFailed
+		}
+	}
+}
+
+// snapshot copies the jobs for display
+func (list *jobList) snapshot(now time.Time) []Job {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	snapshot := make([]Job, 0, len(list.jobs))
+	for _, job := range list.jobs {
+		copied := *job
+		copied.Steps = append([]JobStep(nil), job.Steps...)
+		copied.StartedAsString = copied.Started.Format("2006-01-02 15:04:05")
+		end := copied.Finished
+		if end.IsZero() {
+			end = now
+		}
+		copied.DurationAsString = formatDHMS(end.Sub(copied.Started).Round(time.Second).Seconds())
+		for _, step := range copied.Steps {
+			if step.State == JobDone || step.State == JobFailed {
+				copied.Done++
+			}
+		}
+		snapshot = append(snapshot, copied)
+	}
+	return snapshot
+}
+
+// jobWork is the work of a job on one client; it tells progress and returns the result
+type jobWork func(client *BoincClient, progress func(string)) (string, error)
+
+// startJob
+//
+// Run the work on all clients at the same time in the background; every
+// client's outcome goes to the audit log as action with command
+func startJob(r *http.Request, action string, command string, clients []*BoincClient, work jobWork) *Job {
+	// the request is gone by the time the clients answer
+	actor := requestActor(r)
+	job := jobs.add(action, actor.user, clients)
+	names := make([]string, len(clients))
+	for idx, client := range clients {
+		names[idx] = client.Name
+	}
+	actor.audit(strings.Join(names, ","), action, command, AuditStarted, nil)
+
+	go func() {
+		var wg sync.WaitGroup
+		for idx, client := range clients {
+			wg.Add(1)
+			go func(idx int, client *BoincClient) {
+				defer wg.Done()
+				jobs.update(job, idx, func(step *JobStep) {
+					step.State, step.Started = JobRunning, time.Now()
+				})
+				result, err := work(client, func(progress string) {
+					jobs.update(job, idx, func(step *JobStep) { step.Progress = progress })
+				})
+				actor.audit(client.Name, action, command, "", err)
+				if err != nil {
+					client.logger().Warn(command+" failed", "job", job.ID, "error", err)
+				}
+				jobs.update(job, idx, func(step *JobStep) {
+					step.State, step.Finished, step.Progress, step.Result = JobDone, time.Now(), "", result
+					if err != nil {
+						step.State, step.Error, step.Result = JobFailed, err.Error(), ""
+					}
+				})
+				publishBoinc(client)
+			}(idx, client)
+		}
+		wg.Wait()
+		jobs.finish(job)
+	}()
+	return job
+}
+
+// maintenanceAction is a maintenance RPC as a job
+type maintenanceAction struct {
+	command string // the GUI RPC, for the audit log
+	work    jobWork
+}
+
+// maintenanceActions by the first part of their path
+var maintenanceActions = map[string]maintenanceAction{
+	"run-benchmarks": {"run_benchmarks", func(client *BoincClient, progress func(string)) (string, error) {
+		info, err := client.runBenchmarks(progress)
+		if err != nil {
+			return "", err
+		}
+		iops := strings.TrimSuffix(formatFpops(info.PIOps), "FLOP") + "IOPS"
+		return fmt.Sprintf("%sS and %s per core", formatFpops(info.PFPOps), iops), nil
+	}},
+	"network-available": {"network_available", func(client *BoincClient, _ func(string)) (string, error) {
+		return "transfers and scheduler requests retried", client.networkAvailable()
+	}},
+	"read-cc-config": {"read_cc_config", func(client *BoincClient, _ func(string)) (string, error) {
+		return "cc_config.xml read", client.readCCConfig()
+	}},
+	"quit-client": {"quit", func(client *BoincClient, _ func(string)) (string, error) {
+		return "client stopped", client.quit()
+	}},
+	"newer-version": {"get_newer_version", func(client *BoincClient, _ func(string)) (string, error) {
+		version, url, err := client.newerVersion()
+		if err != nil || version == "" {
+			return "up to date", err
+		}
+		return "BOINC " + version + " available at " + url, nil
+	}},
+}
+
+// maintenanceHandler
+//
+// Start a maintenance action (the first part of the path) on the clients of
+// the rest of the path ("pi", "pi,nas" or "all") as a job
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	action, names, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+	maintenance, ok := maintenanceActions[action]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	clients, err := findBoincClients(names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	job := startJob(r, action, maintenance.command, clients, maintenance.work)
+	writeJobStarted(w, job, nil)
+}
+
+// writeJobStarted answers 202 with the job on /jobs as Location, and the messages of clients left out
+func writeJobStarted(w http.ResponseWriter, job *Job, messages []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Location", fmt.Sprintf("/jobs#job-%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = fmt.Fprintf(w, "%s: job %d started on %d clients\n", job.Action, job.ID, len(job.Steps))
+	if len(messages) > 0 {
+		_, _ = fmt.Fprintln(w, strings.Join(messages, "\n"))
+	}
+}
+
+// jobsHandler shows the jobs, newest first
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Jobs    []Job
+		Running bool
+	}{
+		Jobs: jobs.snapshot(time.Now()),
+	}
+	for _, job := range data.Jobs {
+		data.Running = data.Running || job.State == JobRunning
+	}
+	renderPage(w, r, "cvDCollector_jobs.html", data)
+}
+
+// jobsAPIHandler returns the jobs as JSON
+func jobsAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	outputJSON(w, jobs.snapshot(time.Now()))
+}
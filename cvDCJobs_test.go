@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// maintainable lets the fake BOINC client run maintenance; its benchmarks are done on the second look
+func maintainable(server *fakeServer) *fakeServer {
+	success := func(string) string { return boincReply("<success/>") }
+	looks := 0
+	server.setReply("get_host_info", func(string) string {
+		calculated := "1700000000"
+		if looks++; looks > 2 {
+			calculated = "1800000000"
+		}
+		return boincReply("<host_info>\n<p_ncpus>4</p_ncpus>\n<p_fpops>1500000000</p_fpops>\n<p_iops>4000000000</p_iops>\n<p_calculated>" + calculated + "</p_calculated>\n</host_info>")
+	})
+	server.setReply("run_benchmarks", success)
+	server.setReply("network_available", success)
+	server.setReply("read_cc_config", success)
+	server.setReply("get_newer_version", func(string) string {
+		return boincReply("<newer_version>7.24.1</newer_version>\n<download_url>https://boinc.berkeley.edu/download.php</download_url>")
+	})
+	return server
+}
+
+// waitForJob returns the job with the ID once it is finished
+func waitForJob(t *testing.T, id int) Job {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		for _, job := range jobs.snapshot(time.Now()) {
+			if job.ID == id && !job.Finished.IsZero() {
+				return job
+			}
+		}
+	}
+	t.Fatalf("job %d does not finish", id)
+	return Job{}
+}
+
+func TestBoincMaintenanceRPCs(t *testing.T) {
+	saved := benchmarkPollInterval
+	defer func() { benchmarkPollInterval = saved }()
+	benchmarkPollInterval = time.Millisecond
+
+	server, client := polledTestBoinc(t)
+	maintainable(server)
+	// get_host_info knows no coprocessors, the ones from get_state stay
+	client.ClientStateReply.ClientState.HostInfo.Coprocs.Cuda = []Coproc{{Name: "GeForce GTX 1650"}}
+
+	var progress []string
+	info, err := client.runBenchmarks(func(text string) { progress = append(progress, text) })
+	if err != nil || info.PCalculated != 1800000000 || info.PFPOps != 1.5e9 || len(progress) != 1 {
+		t.Fatalf("benchmarks %+v, %v, progress %q", info, err, progress)
+	}
+	if got := client.ClientStateReply.ClientState.HostInfo; got.PCalculated != 1800000000 || len(got.Coprocs.Cuda) != 1 {
+		t.Errorf("cached host info %+v", got)
+	}
+
+	if err := client.networkAvailable(); err != nil {
+		t.Errorf("network available: %v", err)
+	}
+	if err := client.readCCConfig(); err != nil {
+		t.Errorf("read cc_config: %v", err)
+	}
+	if version, url, err := client.newerVersion(); err != nil || version != "7.24.1" || url != "https://boinc.berkeley.edu/download.php" {
+		t.Errorf("newer version %q %q, %v", version, url, err)
+	}
+	// the fake client does not know quit
+	if err := client.quit(); err == nil {
+		t.Errorf("quit of an unknown op succeeded")
+	}
+}
+
+func TestMaintenanceJobs(t *testing.T) {
+	withAuth(t, AuthConfig{})
+	pi, nas := maintainable(startFakeBoinc(t, "")), startFakeBoinc(t, "")
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	piIp, piPort := pi.Addr()
+	nasIp, nasPort := nas.Addr()
+	dcClients.BOINCConfig.Clients = []BoincClient{
+		{DCClient: DCClient{Name: "pi", Ip: piIp, Port: piPort}},
+		{DCClient: DCClient{Name: "nas", Ip: nasIp, Port: nasPort}},
+	}
+	for idx := range dcClients.BOINCConfig.Clients {
+		client := &dcClients.BOINCConfig.Clients[idx]
+		if err := client.connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer client.disconnect(nil)
+	}
+
+	post := func(path string) (int, string, string) {
+		request := httptest.NewRequest("POST", path, strings.NewReader("csrf="+csrfToken(User{})))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = "127.0.0.1:4711"
+		recorder := httptest.NewRecorder()
+		authorize(RoleOperator, maintenanceHandler)(recorder, request)
+		return recorder.Code, recorder.Header().Get("Location"), recorder.Body.String()
+	}
+	code, location, body := post("/network-available/all")
+	if code != 202 || !strings.HasPrefix(location, "/jobs#job-") || !strings.Contains(body, "network-available: job ") || !strings.HasSuffix(body, "started on 2 clients\n") {
+		t.Fatalf("start: %d %q %q", code, location, body)
+	}
+	var id int
+	var err error
+	if id, err = strconv.Atoi(strings.TrimPrefix(location, "/jobs#job-")); err != nil {
+		t.Fatal(err)
+	}
+	job := waitForJob(t, id)
+	// the nas does not know network_available
+	if job.State != JobFailed || job.Done != 2 || job.Steps[0].State != JobDone || job.Steps[0].Result == "" || job.Steps[1].State != JobFailed || !strings.Contains(job.Steps[1].Error, "unrecognized op") || job.Steps[1].Result != "" {
+		t.Errorf("job %+v", job)
+	}
+
+	_, location, _ = post("/newer-version/pi")
+	if id, err = strconv.Atoi(strings.TrimPrefix(location, "/jobs#job-")); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitForJob(t, id); job.State != JobDone || len(job.Steps) != 1 || job.Steps[0].Result != "BOINC 7.24.1 available at https://boinc.berkeley.edu/download.php" {
+		t.Errorf("newer version %+v", job)
+	}
+
+	if code, _, _ := post("/read-cc-config/pi,mac"); code != 404 {
+		t.Errorf("unknown client: %d", code)
+	}
+	if code, _, _ := post("/defrag/pi"); code != 404 {
+		t.Errorf("unknown action: %d", code)
+	}
+
+	entries, err := readAudit(auditFile(), "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, entry := range entries {
+		commands = append(commands, entry.Client+" "+entry.Action+": "+entry.Command+" "+entry.Outcome+" by "+entry.IP)
+	}
+	got := strings.Join(commands, "|")
+	if !strings.HasPrefix(got, "pi newer-version: get_newer_version ok by 127.0.0.1|pi newer-version: get_newer_version started by 127.0.0.1|") {
+		t.Errorf("audit %q", commands)
+	}
+	if !strings.Contains(got, "nas network-available: network_available failed") || !strings.Contains(got, "pi network-available: network_available ok") || !strings.HasSuffix(got, "pi,nas network-available: network_available started by 127.0.0.1") {
+		t.Errorf("audit %q", commands)
+	}
+
+	recorder := httptest.NewRecorder()
+	jobsAPIHandler(recorder, httptest.NewRequest("GET", "/api/jobs", nil))
+	var listed []map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listed); err != nil || len(listed) < 2 || listed[0]["Action"] != "newer-version" || listed[0]["State"] != "done" {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+	recorder = httptest.NewRecorder()
+	jobsHandler(recorder, httptest.NewRequest("GET", "/jobs", nil))
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "BOINC 7.24.1 available") || strings.Contains(recorder.Body.String(), "http-equiv=\"refresh\"") {
+		t.Errorf("page %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+//
+// Logging
+//
+// Diagnostics go through log/slog: text (the default) or JSON lines on
+// stderr, at the level set in the "log" part of clients.json. Messages about a
+// client carry its flavor, name and ip. "debug": true on a client logs the
+// raw requests and replies of that one client at debug level, whatever the
+// level of the rest.
+//
+
+// LogConfig is the "log" part of clients.json
+type LogConfig struct {
+	Level  string `json:"level"`  // debug, info (default), warn or error
+	Format string `json:"format"` // text (default) or json
+}
+
+// logLevel is the level of everything but the clients with debug set
+var logLevel = new(slog.LevelVar)
+
+// setupLogging makes the configured logger the default one, writing to out
+func setupLogging(config LogConfig, out io.Writer) error {
+	level := slog.LevelInfo
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return fmt.Errorf("log level %q: %w", config.Level, err)
+		}
+	}
+	logLevel.Set(level)
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch strings.ToLower(config.Format) {
+	case "", "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(out, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(out, options)))
+	default:
+		return fmt.Errorf("log format %q is neither text nor json", config.Format)
+	}
+	return nil
+}
+
+// debugHandler lets debug messages of one client through
+type debugHandler struct {
+	slog.Handler
+}
+
+func (handler debugHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (handler debugHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return debugHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler debugHandler) WithGroup(name string) slog.Handler {
+	return debugHandler{handler.Handler.WithGroup(name)}
+}
+
+// clientLogger returns the logger for the messages about a client
+func clientLogger(flavor string, client *DCClient) *slog.Logger {
+	handler := slog.Default().Handler()
+	if client.Debug {
+		handler = debugHandler{handler}
+	}
+	return slog.New(handler).With("flavor", flavor, "name", client.Name, "ip", client.Ip)
+}
+
+func (client *BoincClient) logger() *slog.Logger {
+	return clientLogger(client.flavor(), &client.DCClient)
+}
+
+func (client *FAHClient) logger() *slog.Logger {
+	return clientLogger(client.flavor(), &client.DCClient)
+}
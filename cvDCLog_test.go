@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// withLogging sends the log of a test to a buffer
+func withLogging(t *testing.T, config LogConfig) *bytes.Buffer {
+	saved := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	var out bytes.Buffer
+	if err := setupLogging(config, &out); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func TestSetupLogging(t *testing.T) {
+	out := withLogging(t, LogConfig{Level: "warn", Format: "json"})
+	slog.Info("hidden")
+	slog.Warn("shown", "client", "pi")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("%q: %v", out.String(), err)
+	}
+	if line["msg"] != "shown" || line["client"] != "pi" {
+		t.Errorf("%v", line)
+	}
+
+	for _, config := range []LogConfig{{Level: "loud"}, {Format: "xml"}} {
+		if err := setupLogging(config, out); err == nil {
+			t.Errorf("%+v accepted", config)
+		}
+	}
+}
+
+func TestClientDebugLog(t *testing.T) {
+	out := withLogging(t, LogConfig{})
+
+	server := startFakeFah(t, "secret")
+	quiet := newTestFahClient(server, "secret")
+	if err := quiet.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer quiet.disconnect(nil)
+	if strings.Contains(out.String(), "level=DEBUG") {
+		t.Errorf("debug messages without debug: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "flavor=FAH") || !strings.Contains(out.String(), "ip=127.0.0.1") {
+		t.Errorf("client not named: %s", out.String())
+	}
+
+	out.Reset()
+	chatty := newTestFahClient(server, "secret")
+	chatty.Debug = true
+	if err := chatty.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer chatty.disconnect(nil)
+	if err := chatty.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "msg=receive") || !strings.Contains(out.String(), "queue-info") {
+		t.Errorf("no raw messages with debug: %s", out.String())
+	}
+	if strings.Contains(out.String(), "secret") || strings.Contains(out.String(), "0123456789abcdef") {
+		t.Errorf("password or passkey logged: %s", out.String())
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+//
+// Farm overview
+//
+// Every physical host once, with its BOINC and FAH client merged: clients are
+// the same host when their names match (ignoring case) or, failing that, when
+// they have the same address which is not a loopback one.
+//
+
+// HostOverview
+//
+// Summary of one physical host
+type HostOverview struct {
+	Name      string
+	Ip        string
+	Boinc     *BoincClientView `json:",omitempty"`
+	FAH       *FAHClientView   `json:",omitempty"`
+	Connected bool             // every client of the host is connected
+
+	Tasks       int     // BOINC tasks and FAH units
+	ActiveTasks int     // running ones
+	Progress    float64 // average fraction done of the running ones
+	CreditRate  float64 // BOINC recent average credit of the host (per day)
+	PPD         float64 // FAH points per day
+
+	Alerts []string
+
+	ProgressAsString string
+}
+
+// FarmOverview
+//
+// All hosts with the totals of the farm
+type FarmOverview struct {
+	Hosts       []HostOverview
+	Connected   int // hosts with every client connected
+	Tasks       int
+	ActiveTasks int
+	AtRisk      int // BOINC tasks projected to miss their deadline
+	Missed      int
+	CreditRate  float64
+	PPD         float64
+	Alerts      int // hosts with alerts
+
+	ProgressAsString string
+}
+
+// fahSlotAlerts are slot states which need attention
+var fahSlotAlerts = map[string]bool{"PAUSED": true, "FAILED": true}
+
+// sameHost tells whether a FAH client runs on the host of a BOINC client
+func sameHost(boinc *BoincClientView, fah *FAHClientView) bool {
+	if strings.EqualFold(boinc.Name, fah.Name) {
+		return true
+	}
+	ip := net.ParseIP(boinc.Ip)
+	return boinc.Ip == fah.Ip && !(ip != nil && ip.IsLoopback()) && boinc.Ip != "localhost"
+}
+
+// parseNumber reads numbers FAH sends as text, e.g. "31.00%" or "21703"
+func parseNumber(text string) float64 {
+	number, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(text), "%"), 64)
+	return number
+}
+
+// farmOverview
+//
+// Merge the views of the BOINC and FAH clients to hosts, in config order
+// (BOINC first) and sum up the farm
+func farmOverview(boincViews []BoincClientView, fahViews []FAHClientView) FarmOverview {
+	var farm FarmOverview
+	merged := make([]bool, len(fahViews))
+
+	for idx := range boincViews {
+		host := HostOverview{Name: boincViews[idx].Name, Ip: boincViews[idx].Ip, Boinc: &boincViews[idx]}
+		// a matching name wins over a matching address
+		match := -1
+		for fahIdx := range fahViews {
+			if !merged[fahIdx] && strings.EqualFold(boincViews[idx].Name, fahViews[fahIdx].Name) {
+				match = fahIdx
+				break
+			}
+		}
+		for fahIdx := range fahViews {
+			if match < 0 && !merged[fahIdx] && sameHost(&boincViews[idx], &fahViews[fahIdx]) {
+				match = fahIdx
+			}
+		}
+		if match >= 0 {
+			merged[match] = true
+			host.FAH = &fahViews[match]
+		}
+		farm.Hosts = append(farm.Hosts, host)
+	}
+	for idx := range fahViews {
+		if !merged[idx] {
+			farm.Hosts = append(farm.Hosts, HostOverview{Name: fahViews[idx].Name, Ip: fahViews[idx].Ip, FAH: &fahViews[idx]})
+		}
+	}
+
+	var progress float64
+	for idx := range farm.Hosts {
+		host := &farm.Hosts[idx]
+		host.summarize()
+
+		if host.Connected {
+			farm.Connected++
+		}
+		if len(host.Alerts) > 0 {
+			farm.Alerts++
+		}
+		farm.Tasks += host.Tasks
+		farm.ActiveTasks += host.ActiveTasks
+		farm.CreditRate += host.CreditRate
+		farm.PPD += host.PPD
+		progress += host.Progress * float64(host.ActiveTasks)
+		if host.Boinc != nil {
+			farm.AtRisk += host.Boinc.AtRisk
+			farm.Missed += host.Boinc.Missed
+		}
+	}
+	if farm.ActiveTasks > 0 {
+		farm.ProgressAsString = formatPercent(progress / float64(farm.ActiveTasks))
+	}
+	return farm
+}
+
+// summarize fills counters, rates and alerts of a host from its clients
+func (host *HostOverview) summarize() {
+	host.Connected = true
+	var progress float64
+
+	if boinc := host.Boinc; boinc != nil {
+		if boinc.ConnectionError != "" {
+			host.Connected = false
+			host.Alerts = append(host.Alerts, "BOINC: "+boinc.ConnectionError)
+		}
+		for _, task := range boinc.Tasks {
+			host.Tasks++
+			if task.Status == StatusRunning {
+				host.ActiveTasks++
+				progress += task.Activetask.FractionDone
+			}
+			if task.Status == StatusError || task.Status == StatusUploadFailed {
+				host.Alerts = append(host.Alerts, "BOINC: "+task.Name+" "+task.Status.String())
+			}
+		}
+		for _, project := range boinc.Projects {
+			host.CreditRate += project.HostAvgCredit
+		}
+		if boinc.CCStatus.TaskSuspendReason != SuspendNone && boinc.CCStatus.TaskSuspendReason != SuspendCPUThrottle {
+			host.Alerts = append(host.Alerts, "BOINC suspended: "+boinc.CCStatus.TaskSuspendReason.String())
+		}
+		if boinc.Missed > 0 {
+			host.Alerts = append(host.Alerts, "BOINC deadlines: "+strconv.Itoa(boinc.Missed)+" missed")
+		}
+		if boinc.AtRisk > 0 {
+			host.Alerts = append(host.Alerts, "BOINC deadlines: "+strconv.Itoa(boinc.AtRisk)+" at risk")
+		}
+		for _, warning := range boinc.Disk.Warnings {
+			host.Alerts = append(host.Alerts, "BOINC disk: "+warning)
+		}
+		stuck := 0
+		for _, transfer := range boinc.Transfers {
+			if transfer.Stuck {
+				stuck++
+			}
+		}
+		if stuck > 0 {
+			host.Alerts = append(host.Alerts, "BOINC transfers: "+strconv.Itoa(stuck)+" stuck")
+		}
+	}
+
+	if fah := host.FAH; fah != nil {
+		if fah.ConnectionError != "" {
+			host.Connected = false
+			host.Alerts = append(host.Alerts, "FAH: "+fah.ConnectionError)
+		}
+		for _, unit := range fah.Units {
+			host.Tasks++
+			if unit.State == "RUNNING" {
+				host.ActiveTasks++
+				progress += parseNumber(unit.Percentdone) / 100
+			}
+			host.PPD += parseNumber(unit.PPD)
+			if unit.Error != "" && unit.Error != "NO_ERROR" {
+				host.Alerts = append(host.Alerts, "FAH: "+unit.PRCG()+" "+unit.Error)
+			}
+		}
+		for _, slot := range fah.Slots {
+			if fahSlotAlerts[slot.Status] {
+				alert := "FAH: slot " + slot.ID + " " + strings.ToLower(slot.Status)
+				if slot.Reason != "" {
+					alert += " (" + slot.Reason + ")"
+				}
+				host.Alerts = append(host.Alerts, alert)
+			}
+		}
+	}
+
+	if host.ActiveTasks > 0 {
+		host.Progress = progress / float64(host.ActiveTasks)
+		host.ProgressAsString = formatPercent(host.Progress)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFarmOverview(t *testing.T) {
+	boinc := []BoincClientView{
+		{Name: "pi", Ip: "192.168.1.10",
+			Projects: Projects{{HostAvgCredit: 1000}, {HostAvgCredit: 500}},
+			Tasks: []BoincTask{
+				{Status: StatusRunning, Result: Result{Activetask: ActiveTask{FractionDone: 0.5}}},
+				{Status: StatusRunning, Result: Result{Activetask: ActiveTask{FractionDone: 0.3}}},
+				{Status: StatusReadyToStart},
+			},
+			AtRisk: 1},
+		{Name: "nuc", Ip: "192.168.1.20", ConnectionError: "connection refused"},
+		{Name: "sim01", Ip: "127.0.0.1"},
+	}
+	fah := []FAHClientView{
+		// same address as nuc
+		{Name: "nuc-fah", Ip: "192.168.1.20", Units: []Unit{{State: "RUNNING", Percentdone: "40.00%", PPD: "20000"}}},
+		// same name as pi
+		{Name: "PI", Ip: "pi.local", Slots: []Slot{{ID: "01", Status: "PAUSED", Reason: "by user"}}},
+		// loopback addresses do not identify a host
+		{Name: "sim02", Ip: "127.0.0.1", Units: []Unit{{State: "READY", Error: "BAD_WORK_UNIT", PPD: "0"}}},
+	}
+
+	farm := farmOverview(boinc, fah)
+	want := []struct {
+		name     string
+		fah      string
+		active   int
+		tasks    int
+		alerts   int
+		progress string
+	}{
+		{"pi", "PI", 2, 3, 2, "40.0%"},
+		{"nuc", "nuc-fah", 1, 1, 1, "40.0%"},
+		{"sim01", "", 0, 0, 0, ""},
+		{"sim02", "sim02", 0, 1, 1, ""},
+	}
+	if len(farm.Hosts) != len(want) {
+		t.Fatalf("%d hosts, want %d", len(farm.Hosts), len(want))
+	}
+	for idx, expected := range want {
+		host := farm.Hosts[idx]
+		fahName := ""
+		if host.FAH != nil {
+			fahName = host.FAH.Name
+		}
+		if host.Name != expected.name || fahName != expected.fah {
+			t.Errorf("host %d: %s with FAH %q, want %s with %q", idx, host.Name, fahName, expected.name, expected.fah)
+		}
+		if host.ActiveTasks != expected.active || host.Tasks != expected.tasks {
+			t.Errorf("%s: %d of %d tasks running, want %d of %d", host.Name, host.ActiveTasks, host.Tasks, expected.active, expected.tasks)
+		}
+		if len(host.Alerts) != expected.alerts {
+			t.Errorf("%s: alerts %q", host.Name, host.Alerts)
+		}
+		if host.ProgressAsString != expected.progress {
+			t.Errorf("%s: progress %q, want %q", host.Name, host.ProgressAsString, expected.progress)
+		}
+	}
+
+	if farm.Connected != 3 || farm.Tasks != 5 || farm.ActiveTasks != 3 || farm.AtRisk != 1 || farm.Alerts != 3 {
+		t.Errorf("farm %d connected, %d of %d tasks running, %d at risk, %d with alerts",
+			farm.Connected, farm.ActiveTasks, farm.Tasks, farm.AtRisk, farm.Alerts)
+	}
+	if farm.CreditRate != 1500 || farm.PPD != 20000 {
+		t.Errorf("farm credit %.0f, PPD %.0f", farm.CreditRate, farm.PPD)
+	}
+	if farm.ProgressAsString != "40.0%" {
+		t.Errorf("farm progress %q", farm.ProgressAsString)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//
+// Computing preferences
+//
+// What BOINC may use of a host: CPU time and cores, memory, disk and the hours
+// it may compute and use the network. The working preferences are the web
+// preferences of the projects with the local override of the host on top;
+// /boinc/prefs shows them for every host, and operators push an override with
+// new limits to one host or several at once.
+//
+
+// HostPrefs
+//
+// The working preferences of a host, prepared for display
+type HostPrefs struct {
+	Known      bool // polled at least once
+	Overridden bool // the host has a local override
+	Working    GlobalPrefs
+	Override   *GlobalPrefs
+	Cores      int // CPUs BOINC may use, 0 when the host is not known
+	Days       []string
+
+	CPUAsString     string // e.g. "80% of the CPU time"
+	CoresAsString   string // e.g. "75% (3 of 4 CPUs)"
+	MemoryAsString  string
+	DiskAsString    string
+	ComputeAsString string // hours computing is allowed, e.g. "22:00-07:00" or "always"
+	NetworkAsString string
+}
+
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// hostPrefs prepares the working preferences of a host with ncpus CPUs for display
+func hostPrefs(working GlobalPrefs, override *GlobalPrefs, ncpus int) HostPrefs {
+	prefs := HostPrefs{
+		Known:      working.XMLName.Local != "",
+		Overridden: override != nil,
+		Working:    working,
+		Override:   override,
+	}
+	if !prefs.Known {
+		return prefs
+	}
+
+	cpuUsage := working.CpuUsageLimit
+	if cpuUsage <= 0 {
+		cpuUsage = 100
+	}
+	prefs.CPUAsString = fmt.Sprintf("%.0f%% of the CPU time", cpuUsage)
+
+	// like the client: at least one CPU, no limit for 0
+	coresPct := working.MaxNCpusPct
+	if coresPct <= 0 {
+		coresPct = 100
+	}
+	prefs.CoresAsString = fmt.Sprintf("%.0f%%", coresPct)
+	if ncpus > 0 {
+		prefs.Cores = int(float64(ncpus) * coresPct / 100)
+		if prefs.Cores < 1 {
+			prefs.Cores = 1
+		}
+		prefs.CoresAsString += fmt.Sprintf(" (%d of %d CPUs)", prefs.Cores, ncpus)
+	}
+
+	prefs.MemoryAsString = fmt.Sprintf("%.0f%% in use, %.0f%% idle", working.RamMaxUsedBusyPct, working.RamMaxUsedIdlePct)
+
+	var disk []string
+	if working.DiskMaxUsedGB > 0 {
+		disk = append(disk, fmt.Sprintf("at most %.1f GB", working.DiskMaxUsedGB))
+	}
+	if working.DiskMaxUsedPct > 0 {
+		disk = append(disk, fmt.Sprintf("%.0f%% of the disk", working.DiskMaxUsedPct))
+	}
+	if working.DiskMinFreeGB > 0 {
+		disk = append(disk, fmt.Sprintf("%.1f GB left free", working.DiskMinFreeGB))
+	}
+	prefs.DiskAsString = strings.Join(disk, ", ")
+	if prefs.DiskAsString == "" {
+		prefs.DiskAsString = "no limit"
+	}
+
+	prefs.ComputeAsString = formatHours(working.StartHour, working.EndHour)
+	prefs.NetworkAsString = formatHours(working.NetStartHour, working.NetEndHour)
+	for _, day := range working.DayPrefs {
+		if day.DayOfWeek < 0 || day.DayOfWeek >= len(weekdays) {
+			continue
+		}
+		prefs.Days = append(prefs.Days, fmt.Sprintf("%s: computing %s, network %s", weekdays[day.DayOfWeek],
+			formatHours(day.StartHour, day.EndHour), formatHours(day.NetStartHour, day.NetEndHour)))
+	}
+	return prefs
+}
+
+// formatHours shows the hours from start to end, "always" when they are the same
+func formatHours(start float64, end float64) string {
+	if start == end {
+		return "always"
+	}
+	return formatHour(start) + "-" + formatHour(end)
+}
+
+// formatHour shows an hour of the day like 7.5 as "07:30"
+func formatHour(hour float64) string {
+	minutes := int(hour*60 + 0.5)
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// prefsField is one preference an operator may set from the dashboard
+type prefsField struct {
+	name string // as in global_prefs_override.xml and the form
+	max  float64
+}
+
+var prefsFields = []prefsField{
+	{"cpu_usage_limit", 100},
+	{"max_ncpus_pct", 100},
+	{"ram_max_used_busy_pct", 100},
+	{"ram_max_used_idle_pct", 100},
+	{"disk_max_used_gb", 1e6},
+	{"disk_max_used_pct", 100},
+	{"disk_min_free_gb", 1e6},
+	{"start_hour", 24},
+	{"end_hour", 24},
+	{"net_start_hour", 24},
+	{"net_end_hour", 24},
+}
+
+// prefsChange is a new value for one of the prefsFields
+type prefsChange struct {
+	field prefsField
+	value float64
+}
+
+// parsePrefsChanges reads the preferences given in the form; empty ones stay as they are
+func parsePrefsChanges(form url.Values) ([]prefsChange, error) {
+	var changes []prefsChange
+	for _, field := range prefsFields {
+		text := strings.TrimSpace(form.Get(field.name))
+		if text == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || value < 0 || value > field.max {
+			return nil, fmt.Errorf("%s: %q is no number from 0 to %g", field.name, text, field.max)
+		}
+		changes = append(changes, prefsChange{field, value})
+	}
+	return changes, nil
+}
+
+// applyPrefsChanges sets the changes on the override and describes them for the audit log
+func applyPrefsChanges(override *PrefsOverride, changes []prefsChange) string {
+	var described []string
+	for _, change := range changes {
+		value := strconv.FormatFloat(change.value, 'f', -1, 64)
+		override.set(change.field.name, value)
+		described = append(described, change.field.name+"="+value)
+	}
+	return strings.Join(described, " ")
+}
+
+// prefsHandler shows the computing preferences of all BOINC hosts
+func prefsHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Hosts []BoincClientView
+	}{
+		Hosts: boincViews(),
+	}
+	renderPage(w, r, "cvDCollector_prefs.html", data)
+}
+
+// prefsAPIHandler returns the computing preferences of all BOINC hosts as JSON
+func prefsAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	type prefsEntry struct {
+		Name string
+		Ip   string
+		HostPrefs
+	}
+	hosts := []prefsEntry{}
+	for _, view := range boincViews() {
+		hosts = append(hosts, prefsEntry{Name: view.Name, Ip: view.Ip, HostPrefs: view.Prefs})
+	}
+	outputJSON(w, hosts)
+}
+
+// setPrefsHandler
+//
+// Push an override to the clients of the path ("pi", "pi,nas" or "all"): their
+// override with the preferences of the form, or none for "clear". What the
+// override does not set still follows the web preferences
+func setPrefsHandler(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Path[len("/set-prefs/"):]
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	remove := r.Form.Get("clear") != ""
+	changes, err := parsePrefsChanges(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !remove && len(changes) == 0 {
+		http.Error(w, "nothing to change", http.StatusBadRequest)
+		return
+	}
+
+	clients, err := findBoincClients(names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	done, failed := 0, 0
+	var messages []string
+	for _, client := range clients {
+		var command string
+		if remove {
+			command = "set_global_prefs_override (none)"
+			err = client.clearPrefsOverride()
+		} else {
+			client.mu.RLock()
+			known := client.GlobalPrefs.XMLName.Local != ""
+			client.mu.RUnlock()
+
+			override := client.prefsOverride()
+			command = "set_global_prefs_override " + applyPrefsChanges(&override, changes)
+			if !known {
+				err = errors.New("preferences not known yet")
+			} else {
+				err = client.setPrefsOverride(override)
+			}
+		}
+		audit(r, client.Name, "set-prefs", command, "", err)
+		if err != nil {
+			client.logger().Warn("set_global_prefs_override failed", "error", err)
+			messages = append(messages, client.Name+": "+err.Error())
+			failed++
+			continue
+		}
+		done++
+
+		// show the new preferences right away
+		if err := client.pollPrefs(); err != nil {
+			client.logger().Warn("get_global_prefs_working failed", "error", err)
+		}
+		publishBoinc(client)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if failed > 0 {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	_, _ = fmt.Fprintf(w, "set-prefs: %d done, %d failed\n", done, failed)
+	if len(messages) > 0 {
+		_, _ = fmt.Fprintln(w, strings.Join(messages, "\n"))
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoincPrefs(t *testing.T) {
+	server, client := polledTestBoinc(t)
+
+	working := client.GlobalPrefs
+	if working.MaxNCpusPct != 75 || working.EndHour != 7.5 || working.DiskMaxUsedGB != 1.3 || len(working.DayPrefs) != 1 || working.DayPrefs[0].NetEndHour != 6 {
+		t.Errorf("working %+v", working)
+	}
+	if client.PrefsOverride == nil || client.PrefsOverride.CpuUsageLimit != 80 {
+		t.Errorf("override %+v", client.PrefsOverride)
+	}
+
+	prefs := client.view().Prefs
+	if !prefs.Known || !prefs.Overridden || prefs.Cores != 3 {
+		t.Errorf("prefs %+v", prefs)
+	}
+	got := []string{prefs.CPUAsString, prefs.CoresAsString, prefs.MemoryAsString, prefs.DiskAsString, prefs.ComputeAsString, prefs.NetworkAsString}
+	want := []string{"80% of the CPU time", "75% (3 of 4 CPUs)", "50% in use, 90% idle", "at most 1.3 GB, 90% of the disk, 0.1 GB left free", "22:00-07:30", "always"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(prefs.Days) != 1 || prefs.Days[0] != "Sat: computing always, network 01:00-06:00" {
+		t.Errorf("days %q", prefs.Days)
+	}
+
+	// without an override file the client answers with an error
+	server.setReply("get_global_prefs_override", func(string) string { return boincReply("<error>no prefs override file</error>") })
+	if err := client.pollPrefs(); err != nil || client.PrefsOverride != nil {
+		t.Errorf("no override: %v, %+v", err, client.PrefsOverride)
+	}
+	// a host without preferences keeps being polled with the last ones known
+	server.setReply("get_global_prefs_working", func(string) string { return boincReply("<error>no preferences</error>") })
+	client.lastPrefs = time.Time{}
+	if err := client.poll(); err != nil || !client.isConnected() || client.GlobalPrefs.MaxNCpusPct != 75 {
+		t.Errorf("no preferences: %v, %+v", err, client.GlobalPrefs)
+	}
+	if prefs := hostPrefs(GlobalPrefs{}, nil, 4); prefs.Known || prefs.CPUAsString != "" {
+		t.Errorf("not polled yet %+v", prefs)
+	}
+}
+
+func TestSetPrefs(t *testing.T) {
+	withAuth(t, AuthConfig{})
+	server := startFakeBoinc(t, "")
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	ip, port := server.Addr()
+	dcClients.BOINCConfig.Clients = []BoincClient{
+		{DCClient: DCClient{Name: "pi", Ip: ip, Port: port}},
+		{DCClient: DCClient{Name: "nas"}},
+	}
+	client := &dcClients.BOINCConfig.Clients[0]
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.disconnect(nil)
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	var pushed []string
+	server.setReply("set_global_prefs_override", func(request string) string {
+		pushed = append(pushed, request)
+		return boincReply("<success/>")
+	})
+	server.setReply("read_global_prefs_override", func(string) string { return boincReply("<success/>") })
+	post := func(path string, form url.Values) (int, string) {
+		form.Set("csrf", csrfToken(User{}))
+		request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = "127.0.0.1:4711"
+		recorder := httptest.NewRecorder()
+		authorize(RoleOperator, setPrefsHandler)(recorder, request)
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// the override of the host with the new values, nothing of the web preferences
+	if code, body := post("/set-prefs/pi", url.Values{"max_ncpus_pct": {"50"}, "end_hour": {"6.5"}}); code != 200 || !strings.HasPrefix(body, "set-prefs: 1 done, 0 failed") {
+		t.Errorf("set: %d %q", code, body)
+	}
+	if len(pushed) != 1 {
+		t.Fatalf("pushed %q", pushed)
+	}
+	for _, part := range []string{"<max_ncpus_pct>50</max_ncpus_pct>", "<end_hour>6.5</end_hour>", "<cpu_usage_limit>80.000000</cpu_usage_limit>", "<start_hour>22.000000</start_hour>"} {
+		if !strings.Contains(pushed[0], part) {
+			t.Errorf("%s not in %q", part, pushed[0])
+		}
+	}
+	for _, part := range []string{"75.000000", "7.500000", "source_project", "day_of_week", "run_on_batteries", "work_buf"} {
+		if strings.Contains(pushed[0], part) {
+			t.Errorf("%s in %q", part, pushed[0])
+		}
+	}
+
+	if code, _ := post("/set-prefs/pi", url.Values{"max_ncpus_pct": {"150"}}); code != 400 {
+		t.Errorf("out of range: %d", code)
+	}
+	if code, _ := post("/set-prefs/pi", url.Values{}); code != 400 {
+		t.Errorf("nothing to change: %d", code)
+	}
+	if code, _ := post("/set-prefs/pi,mac", url.Values{"max_ncpus_pct": {"50"}}); code != 404 {
+		t.Errorf("unknown client: %d", code)
+	}
+
+	// nas was never polled
+	code, body := post("/set-prefs/pi,nas", url.Values{"clear": {"1"}})
+	if code != 502 || !strings.Contains(body, "1 done, 1 failed") || len(pushed) != 2 || !strings.Contains(pushed[1], "<set_global_prefs_override></set_global_prefs_override>") {
+		t.Errorf("clear: %d %q, pushed %q", code, body, pushed)
+	}
+
+	entries, err := readAudit(auditFile(), "pi", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Command != "set_global_prefs_override (none)" || entries[1].Command != "set_global_prefs_override max_ncpus_pct=50 end_hour=6.5" {
+		t.Errorf("audit %+v", entries)
+	}
+
+	recorder := httptest.NewRecorder()
+	prefsAPIHandler(recorder, httptest.NewRequest("GET", "/api/boinc/prefs", nil))
+	var answer []struct {
+		Name  string
+		Known bool
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &answer); err != nil || len(answer) != 2 || !answer[0].Known || answer[1].Known {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+	recorder = httptest.NewRecorder()
+	prefsHandler(recorder, httptest.NewRequest("GET", "/boinc/prefs", nil))
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "75% (3 of 4 CPUs)") {
+		t.Errorf("page %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// without an override only the new value is pushed
+	server.setReply("get_global_prefs_override", func(string) string { return boincReply("<error>no prefs override file</error>") })
+	if err := client.pollPrefs(); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := post("/set-prefs/pi", url.Values{"cpu_usage_limit": {"60"}}); code != 200 || len(pushed) != 3 {
+		t.Fatalf("set without override: %d %q, pushed %q", code, body, pushed)
+	}
+	if !strings.Contains(pushed[2], "<cpu_usage_limit>60</cpu_usage_limit>") || strings.Count(pushed[2], "</") != 4 {
+		t.Errorf("pushed %q", pushed[2])
+	}
+}
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Simulator
+//
+// "cvDC simulate" starts a number of in-process fake BOINC and FAH clients
+// (see cvDCFakeServer.go) whose work units evolve over time: progress
+// advances, results finish, get reported and replaced, and now and then a
+// host drops off the network for a while. The collector is pointed at them
+// like at any real farm, which is handy for demos, template development and
+// load tests.
+//
+
+// simulation settings given on the command line
+type simConfig struct {
+	BoincHosts int
+	FahHosts   int
+	Speed      float64 // simulated seconds per real second
+	DropRate   float64 // chance per host and second to drop off the network
+	Seed       int64
+}
+
+// simHost
+//
+// One simulated machine; tick advances its state by dt simulated seconds
+type simHost struct {
+	mu      sync.Mutex
+	name    string
+	addr    string
+	server  *fakeServer
+	offline int // remaining seconds before the host comes back
+	rnd     *rand.Rand
+	seq     int
+	boinc   bool
+
+	// BOINC state
+	state       ClientStateReply
+	durations   map[string]float64 // total run time per result name
+	diskAllowed float64            // what BOINC may use on the disk
+	prefs       GlobalPrefs        // the web preferences
+	override    *PrefsOverride     // the local override, nil without one
+	attachError int                // outcome of the last project_attach
+	benchmarks  time.Time          // when the running benchmarks finish
+	quit        bool               // asked to quit, stops on the next tick
+
+	// FAH state
+	slots       Slots
+	units       Units
+	options     FAHOptions
+	slotOptions map[string]FAHOptions
+}
+
+// simulated BOINC projects and their applications
+var simProjects = []struct {
+	url, name string
+	app       App
+	days      float64 // deadline after download
+	runtime   float64 // typical run time in seconds
+	spare     bool    // not attached at the start, only in the projects list
+}{
+	{"http://www.worldcommunitygrid.org/", "World Community Grid", App{Name: "opn1", UserFriendlyName: "OpenPandemics - COVID-19"}, 7, 3 * 3600, false},
+	{"https://boinc.bakerlab.org/rosetta/", "Rosetta@home", App{Name: "rosetta", UserFriendlyName: "Rosetta"}, 3, 8 * 3600, false},
+	{"http://einstein.phys.uwm.edu/", "Einstein@Home", App{Name: "einstein_O3AS", UserFriendlyName: "Gravitational Wave search O3 All-Sky"}, 14, 12 * 3600, false},
+	{"https://milkyway.cs.rpi.edu/milkyway/", "MilkyWay@home", App{Name: "milkyway_nbody", UserFriendlyName: "Milkyway@home N-Body Simulation"}, 12, 2 * 3600, true},
+}
+
+// startSimulation
+//
+// Parse the simulate arguments, start the fake clients and fill dcClients with
+// matching client entries
+func startSimulation(args []string) {
+	config := simConfig{}
+	port := 8080
+
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	flags.IntVar(&config.BoincHosts, "boinc", 4, "number of simulated BOINC clients")
+	flags.IntVar(&config.FahHosts, "fah", 2, "number of simulated FAH clients")
+	flags.Float64Var(&config.Speed, "speed", 60, "simulated seconds per real second")
+	flags.Float64Var(&config.DropRate, "drop", 0.001, "chance per host and second to drop off the network")
+	flags.Int64Var(&config.Seed, "seed", time.Now().UnixNano(), "random seed")
+	flags.IntVar(&port, "port", port, "web server port")
+	flags.StringVar(&dcClients.AssetDir, "assets", "", "load templates, CSS and JS from this directory (for editing them)")
+	flags.StringVar(&dcClients.TemplateDir, "templates", "", "pages in this directory replace the built in ones")
+	flags.StringVar(&dcClients.Theme, "theme", "", "default theme: light, dark or wall")
+	flags.StringVar(&dcClients.Log.Level, "log", "", "log level: debug, info, warn or error")
+	flags.StringVar(&dcClients.Log.Format, "log-format", "", "log format: text or json")
+	_ = flags.Parse(args)
+
+	dcClients.ServerPort = port
+
+	hosts, err := newSimulation(config)
+	exitOnError("starting the simulation", err)
+
+	go runSimulation(hosts, config)
+}
+
+// newSimulation
+//
+// Create and start the simulated hosts and register them as clients
+func newSimulation(config simConfig) ([]*simHost, error) {
+	var hosts []*simHost
+	rnd := rand.New(rand.NewSource(config.Seed))
+
+	for idx := 0; idx < config.BoincHosts; idx++ {
+		host := &simHost{name: fmt.Sprintf("sim%02d", idx+1), rnd: rand.New(rand.NewSource(rnd.Int63()))}
+		server, err := newFakeBoincServer("127.0.0.1:0", "")
+		if err != nil {
+			return nil, err
+		}
+		host.server = server
+		host.boinc = true
+		host.initBoinc()
+		server.setReply("get_state", host.boincState)
+		server.setReply("get_simple_gui_info", host.boincSimpleGuiInfo)
+		server.setReply("get_results", host.boincResults)
+		server.setReply("get_cc_status", host.boincCCStatus)
+		server.setReply("get_disk_usage", host.boincDiskUsage)
+		server.setReply("get_file_transfers", func(string) string { return boincReply("<file_transfers></file_transfers>") })
+		server.setReply("retry_file_transfer", func(string) string { return boincReply("<success/>") })
+		server.setReply("abort_file_transfer", func(string) string { return boincReply("<success/>") })
+		server.setReply("get_global_prefs_working", host.boincPrefsWorking)
+		server.setReply("get_global_prefs_override", host.boincPrefsOverride)
+		server.setReply("set_global_prefs_override", host.boincSetPrefsOverride)
+		server.setReply("read_global_prefs_override", func(string) string { return boincReply("<success/>") })
+		server.setReply("get_all_projects_list", boincProjectsList)
+		server.setReply("lookup_account", func(string) string { return boincReply("<success/>") })
+		server.setReply("lookup_account_poll", func(string) string {
+			return boincReply("<account_out>\n<authenticator>0123456789abcdef_simulated</authenticator>\n</account_out>")
+		})
+		server.setReply("project_attach", host.boincProjectAttach)
+		server.setReply("project_attach_poll", host.boincProjectAttachPoll)
+		server.setReply("project_detach", host.boincProjectDetach)
+		server.setReply("get_host_info", host.boincHostInfo)
+		server.setReply("run_benchmarks", host.boincRunBenchmarks)
+		server.setReply("network_available", func(string) string { return boincReply("<success/>") })
+		server.setReply("read_cc_config", func(string) string { return boincReply("<success/>") })
+		server.setReply("get_newer_version", func(string) string {
+			return boincReply("<newer_version>7.24.1</newer_version>\n<download_url>https://boinc.berkeley.edu/download.php</download_url>")
+		})
+		server.setReply("quit", host.boincQuit)
+
+		hosts = append(hosts, host)
+		dcClients.BOINCConfig.Clients = append(dcClients.BOINCConfig.Clients, BoincClient{DCClient: host.dcClient()})
+	}
+
+	for idx := 0; idx < config.FahHosts; idx++ {
+		host := &simHost{name: fmt.Sprintf("sim%02d", idx+1), rnd: rand.New(rand.NewSource(rnd.Int63()))}
+		server, err := newFakeFahServer("127.0.0.1:0", "")
+		if err != nil {
+			return nil, err
+		}
+		host.server = server
+		host.initFah()
+		server.setReply("slot-info", host.fahSlots)
+		server.setReply("queue-info", host.fahUnits)
+		server.setReply("options", host.fahOptions)
+		server.setReply("slot-options", host.fahSlotOptions)
+		server.setReply("save", func(string) string { return "" })
+
+		hosts = append(hosts, host)
+		dcClients.FAHConfig.Clients = append(dcClients.FAHConfig.Clients, FAHClient{DCClient: host.dcClient()})
+	}
+
+	return hosts, nil
+}
+
+func (host *simHost) dcClient() DCClient {
+	ip, port := host.server.Addr()
+	host.addr = net.JoinHostPort(ip, strconv.Itoa(port))
+	return DCClient{Name: host.name, Ip: ip, Port: port, Refresh: 5}
+}
+
+// runSimulation
+//
+// Advance all hosts once per second, forever
+func runSimulation(hosts []*simHost, config simConfig) {
+	slog.Info("simulating", "boinc", config.BoincHosts, "fah", config.FahHosts, "speed", config.Speed)
+	for range time.Tick(time.Second) {
+		for _, host := range hosts {
+			host.tick(config)
+		}
+	}
+}
+
+func (host *simHost) tick(config simConfig) {
+	// hosts dropping out and coming back; the server is handled outside the
+	// lock as closing it waits for requests which need the lock themselves
+	host.mu.Lock()
+	quit := host.quit
+	host.quit = false
+	host.mu.Unlock()
+	if quit {
+		// until someone starts it again
+		host.offline = 60
+		slog.Info("simulated client quits", "name", host.name, "seconds", host.offline)
+		_ = host.server.Close()
+		return
+	}
+	if host.offline > 0 {
+		host.offline--
+		if host.offline == 0 {
+			if err := host.server.listen(host.addr); err != nil {
+				slog.Warn("simulated client stays offline", "name", host.name, "error", err)
+				host.offline = 10
+				return
+			}
+			slog.Info("simulated client back online", "name", host.name)
+		}
+		return
+	}
+	if host.rnd.Float64() < config.DropRate {
+		host.offline = 10 + host.rnd.Intn(110)
+		slog.Info("simulated client drops off", "name", host.name, "seconds", host.offline)
+		_ = host.server.Close()
+		return
+	}
+
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	if host.boinc {
+		host.tickBoinc(config.Speed)
+	} else {
+		host.tickFah(config.Speed)
+	}
+}
+
+//
+// BOINC
+//
+
+func (host *simHost) initBoinc() {
+	now := float64(time.Now().Unix())
+	cpus := []int8{2, 4, 4, 8}[host.rnd.Intn(4)]
+	host.durations = make(map[string]float64)
+
+	state := &host.state.ClientState
+	state.HostInfo = HostInfo{
+		Timezone:   "0",
+		DomainName: host.name,
+		IPAddr:     "127.0.0.1",
+		PnCPUs:     cpus,
+		PVendor:    "ARM",
+		PModel:     "BCM2711 (simulated)",
+		PFPOps:     1.0e9,
+		PIOps:      3.0e9,
+		MNBytes:    4 * 1024 * 1024 * 1024,
+		DTotal:     32 * 1000 * 1000 * 1000,
+		DFree:      float64(10+host.rnd.Intn(20)) * 1000 * 1000 * 1000,
+		OSName:     "Linux Raspbian",
+		OSVersion:  "Raspbian GNU/Linux 10 (buster)",
+	}
+	// some SD cards get tight
+	host.diskAllowed = float64(700+host.rnd.Intn(2500)) * 1000 * 1000
+	host.prefs = GlobalPrefs{RunIfUserActive: 1, SuspendCpuUsage: 25, WorkBufMinDays: 0.1, WorkBufAdditionalDays: 0.5,
+		MaxNCpusPct: 100, CpuSchedulingPeriodMinutes: 60, DiskInterval: 60, DiskMaxUsedGB: host.diskAllowed / 1e9,
+		DiskMaxUsedPct: 90, DiskMinFreeGB: 0.1, VmMaxUsedPct: 75, RamMaxUsedBusyPct: 50, RamMaxUsedIdlePct: 90,
+		IdleTimeToRun: 3, CpuUsageLimit: 100}
+	state.PlatformName = "aarch64-unknown-linux-gnu"
+	state.Platforms = []string{state.PlatformName}
+	state.CoreClientMajorVersion, state.CoreClientMinorVersion, state.CoreClientRelease = 7, 16, 11
+	state.TimeStats = TimeStats{
+		OnFrac:          0.95 + 0.05*host.rnd.Float64(),
+		ActiveFrac:      0.9 + 0.1*host.rnd.Float64(),
+		GpuActiveFrac:   0.9,
+		ClientStartTime: now,
+		Now:             now,
+	}
+
+	for idx, project := range simProjects {
+		if !project.spare {
+			host.attachSimProject(idx)
+		}
+	}
+
+	// twice as many tasks as cores, half of them already running for a while
+	for idx := 0; idx < 2*int(cpus); idx++ {
+		result := host.newResult(now)
+		if idx < int(cpus) {
+			elapsed := host.rnd.Float64() * host.durations[result.Name]
+			host.advanceResult(result, elapsed)
+		}
+	}
+}
+
+// attachSimProject adds one of the simProjects with its application to the host
+func (host *simHost) attachSimProject(idx int) {
+	project := simProjects[idx]
+	state := &host.state.ClientState
+	state.Projects = append(state.Projects, Project{
+		MasterUrl:       project.url,
+		ProjectName:     project.name,
+		UserName:        "simulator",
+		HostTotalCredit: float64(host.rnd.Intn(500000)),
+		HostAvgCredit:   float64(host.rnd.Intn(2000)),
+		ResourceShare:   100,
+	})
+	for _, app := range state.Apps {
+		if app.Name == project.app.Name {
+			// attached before
+			return
+		}
+	}
+	state.Apps = append(state.Apps, project.app)
+	state.AppVersions = append(state.AppVersions, AppVersion{
+		AppName:    project.app.Name,
+		VersionNum: 700 + host.rnd.Intn(100),
+		Platform:   "aarch64-unknown-linux-gnu",
+		AvgNcpus:   1,
+		Flops:      1.0e9,
+	})
+}
+
+// newResult adds a freshly downloaded result (and its workunit) to the queue; nil without projects
+func (host *simHost) newResult(now float64) *Result {
+	state := &host.state.ClientState
+	if len(state.Projects) == 0 {
+		return nil
+	}
+	attached := state.Projects[host.rnd.Intn(len(state.Projects))]
+	project := simProjects[0]
+	for _, simProject := range simProjects {
+		if simProject.url == attached.MasterUrl {
+			project = simProject
+		}
+	}
+	host.seq++
+
+	wuName := fmt.Sprintf("%s_%07d_%05d", project.app.Name, 1000+host.rnd.Intn(9000), host.seq)
+	duration := project.runtime * (0.5 + host.rnd.Float64())
+	deadline := now + project.days*24*3600
+	if host.rnd.Intn(10) == 0 {
+		// now and then a tight deadline, to have something to worry about
+		deadline = now + duration*(0.8+host.rnd.Float64())
+	}
+
+	version := ""
+	for _, appVersion := range state.AppVersions {
+		if appVersion.AppName == project.app.Name {
+			version = strconv.Itoa(appVersion.VersionNum)
+		}
+	}
+	state.WorkUnits = append(state.WorkUnits, WorkUnit{
+		Name:        wuName,
+		AppName:     project.app.Name,
+		RscFpopsEst: duration * 1.0e9,
+	})
+	state.Results = append(state.Results, Result{
+		Name:                   wuName + "_0",
+		WUName:                 wuName,
+		Platform:               "aarch64-unknown-linux-gnu",
+		VersionNum:             version,
+		ProjectUrl:             project.url,
+		State:                  2, // files downloaded
+		ReportDeadline:         deadline,
+		ReceivedTime:           now,
+		EstimatedTimeRemaining: duration,
+	})
+	host.durations[wuName+"_0"] = duration
+
+	return &state.Results[len(state.Results)-1]
+}
+
+// advanceResult lets a result compute for dt seconds
+func (host *simHost) advanceResult(result *Result, dt float64) {
+	duration := host.durations[result.Name]
+	task := &result.Activetask
+
+	task.TaskState = 1 // executing
+	task.ElapsedTime += dt
+	task.CurrentCPUTime += dt * 0.98
+	task.CheckpointCPUTime = task.CurrentCPUTime
+	task.WorkingSetSize = 48 * 1024 * 1024
+	task.ProgressRate = 1 / duration
+
+	if task.ElapsedTime >= duration {
+		result.State = 5 // files uploaded
+		result.FinalElapsedTime = duration
+		result.FinalCPUTime = task.CurrentCPUTime
+		result.EstimatedTimeRemaining = 0
+		result.ReadyToReport = &struct{}{}
+		result.Activetask = ActiveTask{}
+		return
+	}
+	task.FractionDone = task.ElapsedTime / duration
+	result.EstimatedTimeRemaining = duration - task.ElapsedTime
+}
+
+func (host *simHost) tickBoinc(speed float64) {
+	now := float64(time.Now().Unix())
+	state := &host.state.ClientState
+	state.TimeStats.Now = now
+
+	cpus := int(state.HostInfo.PnCPUs)
+	running := 0
+	queued := 0
+	var results Results
+	for idx := range state.Results {
+		result := &state.Results[idx]
+		if result.ReadyToReport != nil {
+			// report finished results after a (simulated) hour
+			if host.rnd.Float64() < speed/3600 {
+				delete(host.durations, result.Name)
+				continue
+			}
+		} else if running < cpus {
+			running++
+			host.advanceResult(result, speed)
+		} else {
+			queued++
+		}
+		results = append(results, *result)
+	}
+	state.Results = results
+
+	for ; queued < cpus; queued++ {
+		if host.newResult(now) == nil {
+			break
+		}
+	}
+
+	// drop workunits without result
+	var workUnits []WorkUnit
+	for _, workUnit := range state.WorkUnits {
+		if _, ok := host.durations[workUnit.Name+"_0"]; ok {
+			workUnits = append(workUnits, workUnit)
+		}
+	}
+	state.WorkUnits = workUnits
+}
+
+// boincMarshal renders a reply of the simulated client
+func boincMarshal(reply interface{}) string {
+	enc, err := xml.MarshalIndent(reply, "", "  ")
+	if err != nil {
+		return boincReply("<error>" + err.Error() + "</error>")
+	}
+	return string(enc) + "\n"
+}
+
+// boincState answers get_state with the current simulated state
+func (host *simHost) boincState(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return boincMarshal(&host.state)
+}
+
+func (host *simHost) boincSimpleGuiInfo(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	reply := simpleGuiInfoReply{}
+	reply.SimpleGuiInfo.Projects = host.state.ClientState.Projects
+	reply.SimpleGuiInfo.Results = host.state.ClientState.Results
+	return boincMarshal(&reply)
+}
+
+func (host *simHost) boincResults(request string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	activeOnly := strings.Contains(request, "<active_only>1</active_only>")
+	reply := resultsReply{}
+	for _, result := range host.state.ClientState.Results {
+		if !activeOnly || result.Activetask.TaskState != 0 {
+			reply.Results = append(reply.Results, result)
+		}
+	}
+	return boincMarshal(&reply)
+}
+
+func (host *simHost) boincCCStatus(string) string {
+	reply := ccStatusReply{CCStatus: CCStatus{NetworkStatus: 2, TaskMode: 2, TaskModePerm: 2, GpuMode: 2, GpuModePerm: 2, NetworkMode: 2, NetworkModePerm: 2}}
+	return boincMarshal(&reply)
+}
+
+// boincDiskUsage answers get_disk_usage: every project keeps its apps and the files of its tasks
+func (host *simHost) boincDiskUsage(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	state := host.state.ClientState
+	usage := DiskUsage{DTotal: state.HostInfo.DTotal, DFree: state.HostInfo.DFree, DBoinc: 5 * 1000 * 1000, DAllowed: host.diskAllowed}
+	for _, project := range state.Projects {
+		used := 150 * 1000 * 1000.0
+		for _, result := range state.Results {
+			if result.ProjectUrl == project.MasterUrl {
+				used += 60 * 1000 * 1000
+			}
+		}
+		usage.Projects = append(usage.Projects, ProjectDiskUsage{MasterUrl: project.MasterUrl, DiskUsage: used})
+	}
+	return boincMarshal(&diskUsageReply{DiskUsage: usage})
+}
+
+// boincPrefsWorking answers get_global_prefs_working: the web preferences with the override on top
+func (host *simHost) boincPrefsWorking(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	prefs := host.prefs
+	prefs.DayPrefs = append([]DayPrefs(nil), prefs.DayPrefs...)
+	if host.override != nil {
+		if err := host.override.apply(&prefs); err != nil {
+			return boincReply("<error>" + err.Error() + "</error>")
+		}
+	}
+	return boincMarshal(&globalPrefsReply{Prefs: &prefs})
+}
+
+func (host *simHost) boincPrefsOverride(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	if host.override == nil {
+		return boincReply("<error>no prefs override file</error>")
+	}
+	return boincMarshal(&prefsOverrideReply{Prefs: host.override})
+}
+
+// boincSetPrefsOverride answers set_global_prefs_override; without preferences it removes the override
+func (host *simHost) boincSetPrefsOverride(request string) string {
+	set := setGlobalPrefsOverride{}
+	if err := xml.Unmarshal([]byte(request), &set); err != nil {
+		return boincReply("<error>" + err.Error() + "</error>")
+	}
+
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	if set.Prefs.XMLName.Local == "" {
+		host.override = nil
+	} else {
+		host.override = &set.Prefs
+	}
+	return boincReply("<success/>")
+}
+
+// boincProjectsList answers get_all_projects_list with the simulated projects
+func boincProjectsList(string) string {
+	reply := allProjectsListReply{}
+	for _, project := range simProjects {
+		reply.Projects = append(reply.Projects, ProjectListEntry{Name: project.name, Url: project.url, GeneralArea: "simulated",
+			Platforms: []string{"aarch64-unknown-linux-gnu"}})
+	}
+	return boincMarshal(&reply)
+}
+
+// boincProjectAttach answers project_attach; only the simulated projects can be attached
+func (host *simHost) boincProjectAttach(request string) string {
+	attach := projectAttach{}
+	if err := xml.Unmarshal([]byte(request), &attach); err != nil {
+		return boincReply("<error>" + err.Error() + "</error>")
+	}
+
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.attachError = -189 // ERR_INVALID_URL
+	for idx, project := range simProjects {
+		if project.url == attach.ProjectUrl {
+			if host.state.ClientState.Projects.index(project.url) >= 0 {
+				return boincReply("<error>Already attached to project</error>")
+			}
+			host.attachSimProject(idx)
+			host.attachError = 0
+		}
+	}
+	return boincReply("<success/>")
+}
+
+func (host *simHost) boincProjectAttachPoll(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return boincReply(fmt.Sprintf("<project_attach_reply>\n<error_num>%d</error_num>\n</project_attach_reply>", host.attachError))
+}
+
+// boincProjectDetach answers project_detach: the project goes with its tasks
+func (host *simHost) boincProjectDetach(request string) string {
+	detach := projectDetach{}
+	if err := xml.Unmarshal([]byte(request), &detach); err != nil {
+		return boincReply("<error>" + err.Error() + "</error>")
+	}
+
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	state := &host.state.ClientState
+	idx := state.Projects.index(detach.ProjectUrl)
+	if idx < 0 {
+		return boincReply("<error>No such project</error>")
+	}
+	state.Projects = append(state.Projects[:idx], state.Projects[idx+1:]...)
+	var results Results
+	for _, result := range state.Results {
+		if result.ProjectUrl == detach.ProjectUrl {
+			delete(host.durations, result.Name)
+		} else {
+			results = append(results, result)
+		}
+	}
+	state.Results = results
+	return boincReply("<success/>")
+}
+
+// boincHostInfo answers get_host_info, with new benchmark results once they are done
+func (host *simHost) boincHostInfo(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	info := &host.state.ClientState.HostInfo
+	if !host.benchmarks.IsZero() && time.Now().After(host.benchmarks) {
+		host.benchmarks = time.Time{}
+		info.PCalculated = float64(time.Now().Unix())
+		info.PFPOps = 1.0e9 * (0.9 + 0.2*host.rnd.Float64())
+		info.PIOps = 3.0e9 * (0.9 + 0.2*host.rnd.Float64())
+	}
+	return boincMarshal(&hostInfoReply{HostInfo: *info})
+}
+
+// boincRunBenchmarks answers run_benchmarks; they take a few seconds
+func (host *simHost) boincRunBenchmarks(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.benchmarks = time.Now().Add(time.Duration(5+host.rnd.Intn(10)) * time.Second)
+	return boincReply("<success/>")
+}
+
+func (host *simHost) boincQuit(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.quit = true
+	return boincReply("<success/>")
+}
+
+//
+// FAH
+//
+
+func (host *simHost) initFah() {
+	host.slots.Slots = []Slot{{ID: "00", Status: "RUNNING", Description: "cpu:4"}}
+	if host.rnd.Intn(2) == 0 {
+		host.slots.Slots = append(host.slots.Slots, Slot{ID: "01", Status: "RUNNING", Description: "gpu:0:GP104 [GeForce GTX 1070] (simulated)"})
+	}
+	host.options = FAHOptions{
+		"user": "Anonymous", "team": "0", "passkey": "", "power": "medium", "cause": "ANY",
+		"gpu": "true", "idle": "false", "checkpoint": "15", "command-port": "36330",
+	}
+	if host.rnd.Intn(2) == 0 {
+		host.options["user"], host.options["team"], host.options["passkey"] = host.name, "224497", fmt.Sprintf("%032x", host.rnd.Int63())
+	}
+	host.slotOptions = map[string]FAHOptions{}
+	for _, slot := range host.slots.Slots {
+		options := FAHOptions{"cpus": "", "gpu-index": "", "paused": "false", "idle": "false"}
+		if strings.HasPrefix(slot.Description, "gpu") {
+			options["gpu-index"] = "0"
+		} else {
+			options["cpus"] = "4"
+		}
+		host.slotOptions[slot.ID] = options
+	}
+	for _, slot := range host.slots.Slots {
+		unit := host.newUnit(slot.ID)
+		unit.FramesDone = host.rnd.Intn(100)
+		host.units.Units = append(host.units.Units, unit)
+	}
+}
+
+func (host *simHost) newUnit(slot string) Unit {
+	host.seq++
+	now := time.Now().UTC()
+	return Unit{
+		ID:          fmt.Sprintf("%02d", host.seq%100),
+		State:       "RUNNING",
+		Error:       "NO_ERROR",
+		Project:     13000 + host.rnd.Intn(5000),
+		Run:         host.rnd.Intn(10),
+		Clone:       host.rnd.Intn(2000),
+		Gen:         host.rnd.Intn(100),
+		Core:        "0xa8",
+		Unit:        fmt.Sprintf("0x%032x", host.rnd.Int63()),
+		TotalFrames: 100,
+		Assigned:    now.Format(time.RFC3339),
+		Timeout:     now.Add(24 * time.Hour).Format(time.RFC3339),
+		Deadline:    now.Add(72 * time.Hour).Format(time.RFC3339),
+		WS:          "129.32.209.202",
+		CS:          "129.32.209.203",
+		Slot:        slot,
+		BaseCredit:  strconv.Itoa(1000 + host.rnd.Intn(5000)),
+	}
+}
+
+func (host *simHost) tickFah(speed float64) {
+	for idx := range host.units.Units {
+		unit := &host.units.Units[idx]
+
+		// one frame per (simulated) 3 minutes, give or take
+		if host.rnd.Float64() < speed/180 {
+			unit.FramesDone++
+		}
+		if unit.FramesDone >= unit.TotalFrames {
+			*unit = host.newUnit(unit.Slot)
+		}
+
+		tpf := 180 * time.Second
+		remaining := time.Duration(unit.TotalFrames-unit.FramesDone) * tpf
+		unit.Percentdone = fmt.Sprintf("%.2f%%", 100*float64(unit.FramesDone)/float64(unit.TotalFrames))
+		unit.TPF = fahDuration(tpf)
+		unit.Eta = fahDuration(remaining)
+		unit.PPD = strconv.Itoa(20000 + host.rnd.Intn(2000))
+		unit.CreditEstimate = unit.BaseCredit
+		unit.TimeRemaining = fmt.Sprintf("%.2f days", time.Until(mustParseTime(unit.Deadline)).Hours()/24)
+	}
+}
+
+// fahDuration formats a duration the way FAH does ("3 hours 12 mins")
+func fahDuration(duration time.Duration) string {
+	hours := int(duration.Hours())
+	mins := int(duration.Minutes()) % 60
+	secs := int(duration.Seconds()) % 60
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%d hours %02d mins", hours, mins)
+	case mins > 0:
+		return fmt.Sprintf("%d mins %02d secs", mins, secs)
+	default:
+		return fmt.Sprintf("%d secs", secs)
+	}
+}
+
+func mustParseTime(value string) time.Time {
+	parsed, _ := time.Parse(time.RFC3339, value)
+	return parsed
+}
+
+// fahPyON renders a reply the way the FAH client does
+func fahPyON(name string, object interface{}) string {
+	enc, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return "\nERROR: " + err.Error() + "\n"
+	}
+	return "\nPyON 1 " + name + "\n" + string(enc) + "\n---\n"
+}
+
+func (host *simHost) fahSlots(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return fahPyON("slots", host.slots.Slots)
+}
+
+func (host *simHost) fahUnits(string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return fahPyON("units", host.units.Units)
+}
+
+// fahOptions answers "options": sets the name=value arguments and lists the options
+func (host *simHost) fahOptions(request string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	changed := FAHOptions{}
+	for _, arg := range strings.Fields(request)[1:] {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			host.options[name] = value
+			changed[name] = value
+		}
+	}
+	if len(changed) > 0 {
+		return fahPyON("options", changed)
+	}
+	return fahPyON("options", host.options)
+}
+
+// fahSlotOptions answers "slot-options <slot> -a"
+func (host *simHost) fahSlotOptions(request string) string {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	fields := strings.Fields(request)
+	if len(fields) < 2 || host.slotOptions[fields[1]] == nil {
+		return "\nERROR: slot not found\n"
+	}
+	return fahPyON("slot-options", host.slotOptions[fields[1]])
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestSimulationEvolves(t *testing.T) {
+	saved := dcClients
+	defer func() { dcClients = saved }()
+	dcClients = DCClients{}
+
+	config := simConfig{BoincHosts: 1, FahHosts: 1, Speed: 600, Seed: 1}
+	hosts, err := newSimulation(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, host := range hosts {
+			_ = host.server.Close()
+		}
+	}()
+	if len(dcClients.BOINCConfig.Clients) != 1 || len(dcClients.FAHConfig.Clients) != 1 {
+		t.Fatalf("clients = %d BOINC, %d FAH", len(dcClients.BOINCConfig.Clients), len(dcClients.FAHConfig.Clients))
+	}
+
+	boinc := &dcClients.BOINCConfig.Clients[0]
+	fah := &dcClients.FAHConfig.Clients[0]
+	for _, err := range []error{boinc.connect(), fah.connect()} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer boinc.disconnect(nil)
+	defer fah.disconnect(nil)
+
+	if err := boinc.poll(); err != nil {
+		t.Fatal(err)
+	}
+	state := boinc.ClientStateReply.ClientState
+	attached := 0
+	for _, project := range simProjects {
+		if !project.spare {
+			attached++
+		}
+	}
+	if state.HostInfo.DomainName != "sim01" || len(state.Results) == 0 || len(state.Projects) != attached {
+		t.Fatalf("simulated state = %+v", state)
+	}
+	before := 0.0
+	for _, result := range state.Results {
+		before += result.EstimatedTimeRemaining
+	}
+
+	for idx := 0; idx < 10; idx++ {
+		for _, host := range hosts {
+			host.tick(config)
+		}
+	}
+
+	if err := boinc.poll(); err != nil {
+		t.Fatal(err)
+	}
+	after := 0.0
+	for _, result := range boinc.ClientStateReply.ClientState.Results {
+		after += result.EstimatedTimeRemaining
+	}
+	if after == before {
+		t.Error("simulated BOINC results did not progress")
+	}
+
+	if err := fah.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fah.Slots.Slots) == 0 || len(fah.Units.Units) != len(fah.Slots.Slots) {
+		t.Errorf("simulated FAH slots/units = %d/%d", len(fah.Slots.Slots), len(fah.Units.Units))
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//
+// Sorting and grouping of BOINC tasks
+//
+// The pages and the API take "sort=<key>" (a leading "-" reverses the order)
+// and "group=<key>" parameters. Every comparator falls back to client and
+// task name, so equal keys keep a fixed order between requests.
+//
+
+// taskComparator returns <0, 0 or >0 like strings.Compare
+type taskComparator func(a, b *BoincTask) int
+
+var taskComparators = map[string]taskComparator{
+	"remaining": func(a, b *BoincTask) int { return compareFloat(a.EstimatedTimeRemaining, b.EstimatedTimeRemaining) },
+	"deadline":  func(a, b *BoincTask) int { return compareFloat(a.ReportDeadline, b.ReportDeadline) },
+	"progress":  func(a, b *BoincTask) int { return compareFloat(taskProgress(a), taskProgress(b)) },
+	"project":   func(a, b *BoincTask) int { return compareText(a.ProjectName, b.ProjectName) },
+	"app":       func(a, b *BoincTask) int { return compareText(a.AppName, b.AppName) },
+	"client":    func(a, b *BoincTask) int { return compareText(a.Client, b.Client) },
+	"state":     func(a, b *BoincTask) int { return int(a.Status) - int(b.Status) },
+}
+
+// taskGroupers return the name of the group a task belongs to
+var taskGroupers = map[string]func(task *BoincTask) string{
+	"client":  func(task *BoincTask) string { return task.Client },
+	"project": func(task *BoincTask) string { return task.ProjectName },
+	"app":     func(task *BoincTask) string { return task.AppName },
+}
+
+// defaultTaskSort is used when no sort parameter is given
+const defaultTaskSort = "remaining"
+
+// sortOption is one entry of the sort and group selections of the BOINC page
+type sortOption struct {
+	Key   string
+	Label string
+}
+
+var taskSortOptions = []sortOption{
+	{"remaining", "Remaining time"},
+	{"-remaining", "Remaining time, longest first"},
+	{"deadline", "Deadline"},
+	{"-deadline", "Deadline, latest first"},
+	{"progress", "Progress"},
+	{"-progress", "Progress, most done first"},
+	{"project", "Project"},
+	{"app", "Application"},
+	{"client", "Client"},
+	{"state", "Status"},
+}
+
+var taskGroupOptions = []sortOption{
+	{"client", "client"},
+	{"project", "project"},
+	{"app", "application"},
+}
+
+// BoincTaskGroup
+//
+// Tasks sharing a client, project or application
+type BoincTaskGroup struct {
+	Name   string
+	Client *BoincClientView `json:",omitempty"` // only when grouped by client
+	Tasks  []BoincTask
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareText(a, b string) int {
+	if order := strings.Compare(strings.ToLower(a), strings.ToLower(b)); order != 0 {
+		return order
+	}
+	return strings.Compare(a, b)
+}
+
+// taskProgress is the fraction done, finished tasks count as complete
+func taskProgress(task *BoincTask) float64 {
+	switch task.Status {
+	case StatusUploading, StatusReadyToReport:
+		return 1
+	}
+	return task.Activetask.FractionDone
+}
+
+// taskLess
+//
+// Ordering for a sort parameter, e.g. "deadline" or "-progress"; fails for unknown keys
+func taskLess(sortKey string) (func(a, b *BoincTask) bool, error) {
+	if sortKey == "" {
+		sortKey = defaultTaskSort
+	}
+	descending := strings.HasPrefix(sortKey, "-")
+	compare, ok := taskComparators[strings.TrimPrefix(sortKey, "-")]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key %q", sortKey)
+	}
+
+	return func(a, b *BoincTask) bool {
+		order := compare(a, b)
+		if descending {
+			order = -order
+		}
+		if order == 0 {
+			order = compareText(a.Client, b.Client)
+		}
+		if order == 0 {
+			order = strings.Compare(a.Name, b.Name)
+		}
+		return order < 0
+	}, nil
+}
+
+// sortTasks sorts tasks in place by a sort parameter
+func sortTasks(tasks []BoincTask, sortKey string) error {
+	less, err := taskLess(sortKey)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return less(&tasks[i], &tasks[j])
+	})
+	return nil
+}
+
+// groupTasks
+//
+// Sort the tasks of all clients and split them into groups; grouped by client
+// every configured client gets a group (in config order) even without tasks,
+// other groups are ordered by name
+func groupTasks(views []BoincClientView, groupKey string, sortKey string) ([]BoincTaskGroup, error) {
+	if groupKey == "" {
+		groupKey = "client"
+	}
+	grouper, ok := taskGroupers[groupKey]
+	if !ok {
+		return nil, fmt.Errorf("unknown group key %q", groupKey)
+	}
+
+	var tasks []BoincTask
+	for _, view := range views {
+		tasks = append(tasks, view.Tasks...)
+	}
+	if err := sortTasks(tasks, sortKey); err != nil {
+		return nil, err
+	}
+
+	var groups []BoincTaskGroup
+	index := make(map[string]int)
+	if groupKey == "client" {
+		for idx := range views {
+			index[views[idx].Name] = len(groups)
+			groups = append(groups, BoincTaskGroup{Name: views[idx].Name, Client: &views[idx]})
+		}
+	}
+	for _, task := range tasks {
+		name := grouper(&task)
+		idx, ok := index[name]
+		if !ok {
+			idx = len(groups)
+			index[name] = idx
+			groups = append(groups, BoincTaskGroup{Name: name})
+		}
+		groups[idx].Tasks = append(groups[idx].Tasks, task)
+	}
+
+	if groupKey != "client" {
+		sort.SliceStable(groups, func(i, j int) bool {
+			return compareText(groups[i].Name, groups[j].Name) < 0
+		})
+	}
+	return groups, nil
+}
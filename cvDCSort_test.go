@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func sortTestTasks() []BoincTask {
+	task := func(client, name, project string, status TaskStatus, remaining, done float64) BoincTask {
+		return BoincTask{
+			Result: Result{Name: name, WUName: name, EstimatedTimeRemaining: remaining,
+				ReportDeadline: 1000 - remaining, Activetask: ActiveTask{FractionDone: done}},
+			Client:      client,
+			ProjectName: project,
+			AppName:     project + " app",
+			Status:      status,
+		}
+	}
+	return []BoincTask{
+		task("host2", "c", "Rosetta", StatusRunning, 300, 0.5),
+		task("host1", "b", "WCG", StatusReadyToStart, 300, 0),
+		task("host1", "a", "wcg", StatusRunning, 100, 0.9),
+		task("host2", "d", "Rosetta", StatusReadyToReport, 0, 0),
+		task("host1", "e", "Einstein", StatusWaiting, 300, 0.1),
+	}
+}
+
+func taskNames(tasks []BoincTask) string {
+	names := ""
+	for _, task := range tasks {
+		names += task.Name
+	}
+	return names
+}
+
+func TestSortTasks(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"", "dabec"},
+		{"remaining", "dabec"},
+		{"-remaining", "becad"},
+		{"deadline", "becad"},
+		{"progress", "becad"},
+		{"-progress", "daceb"},
+		{"project", "ecdba"},
+		{"app", "ecdba"},
+		{"client", "abecd"},
+		{"-client", "cdabe"},
+		{"state", "baced"},
+	}
+	for _, test := range tests {
+		tasks := sortTestTasks()
+		if err := sortTasks(tasks, test.sort); err != nil {
+			t.Fatalf("sort %q: %s", test.sort, err)
+		}
+		if got := taskNames(tasks); got != test.want {
+			t.Errorf("sort %q: %s, want %s", test.sort, got, test.want)
+		}
+	}
+
+	if err := sortTasks(sortTestTasks(), "color"); err == nil {
+		t.Error("unknown sort key accepted")
+	}
+}
+
+func TestTaskLessIsStrictWeakOrdering(t *testing.T) {
+	tasks := sortTestTasks()
+	for key := range taskComparators {
+		for _, sortKey := range []string{key, "-" + key} {
+			less, err := taskLess(sortKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range tasks {
+				if less(&tasks[i], &tasks[i]) {
+					t.Errorf("%s: %s less than itself", sortKey, tasks[i].Name)
+				}
+				for j := range tasks {
+					if i != j && less(&tasks[i], &tasks[j]) == less(&tasks[j], &tasks[i]) {
+						t.Errorf("%s: %s and %s not ordered", sortKey, tasks[i].Name, tasks[j].Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResultsLess(t *testing.T) {
+	results := Results{
+		{Name: "r3", WUName: "wu2", EstimatedTimeRemaining: 10},
+		{Name: "r2", WUName: "wu1", EstimatedTimeRemaining: 20},
+		{Name: "r1", WUName: "wu2", EstimatedTimeRemaining: 10},
+		{Name: "r0", WUName: "wu1", EstimatedTimeRemaining: 10},
+	}
+	sort.Sort(results)
+	for idx, name := range []string{"r0", "r1", "r3", "r2"} {
+		if results[idx].Name != name {
+			t.Errorf("results[%d] = %s, want %s", idx, results[idx].Name, name)
+		}
+	}
+}
+
+func TestGroupTasks(t *testing.T) {
+	tasks := sortTestTasks()
+	views := []BoincClientView{
+		{Name: "host2", Tasks: []BoincTask{tasks[0], tasks[3]}},
+		{Name: "host3"},
+		{Name: "host1", Tasks: []BoincTask{tasks[1], tasks[2], tasks[4]}},
+	}
+
+	groups, err := groupTasks(views, "client", "remaining")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, group := range groups {
+		if group.Client == nil || group.Client.Name != group.Name {
+			t.Errorf("group %s without its client", group.Name)
+		}
+		got = append(got, group.Name+":"+taskNames(group.Tasks))
+	}
+	// clients in config order, also without tasks
+	want := []string{"host2:dc", "host3:", "host1:abe"}
+	if len(got) != len(want) {
+		t.Fatalf("groups %v, want %v", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Errorf("groups %v, want %v", got, want)
+			break
+		}
+	}
+
+	groups, err = groupTasks(views, "project", "-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, group := range groups {
+		if group.Client != nil {
+			t.Errorf("project group %s with a client", group.Name)
+		}
+		got = append(got, group.Name+":"+taskNames(group.Tasks))
+	}
+	want = []string{"Einstein:e", "Rosetta:dc", "WCG:b", "wcg:a"}
+	if len(got) != len(want) {
+		t.Fatalf("groups %v, want %v", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Errorf("groups %v, want %v", got, want)
+			break
+		}
+	}
+
+	if _, err := groupTasks(views, "color", ""); err == nil {
+		t.Error("unknown group key accepted")
+	}
+}
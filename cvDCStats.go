@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// Self-observability
+//
+// Counters of the pollers, to tell a dead host (not connected, connects
+// failing) from a stuck collector (connected, but no poll finishing or the
+// reconnect loops not running). /healthz answers as long as the web server
+// does, /readyz only while the pollers work; both need no login so that
+// monitoring can ask. /stats and /api/stats show the counters per client.
+//
+
+// PollStats are the counters of one client
+type PollStats struct {
+	Polls            int64
+	Failures         int64 // polls which failed, the client is reconnected then
+	ParseErrors      int64 // replies which could not be read
+	BytesReceived    int64
+	Connects         int64 // connection attempts
+	Reconnects       int64 // successful connections after the first one
+	LastPoll         time.Time
+	LastPollDuration time.Duration
+	LastSuccess      time.Time // end of the last successful poll
+	LastError        string
+
+	connected bool // connected once already
+}
+
+// pollStats guards the counters of a client
+type pollStats struct {
+	mu    sync.Mutex
+	stats PollStats
+}
+
+// startTime is when the collector started
+var startTime = time.Now()
+
+// sweepInterval is the pause of the loops (re)connecting the clients
+const sweepInterval = 20 * time.Second
+
+// last run of the loops (re)connecting the clients, as Unix nano seconds
+var boincSweep, fahSweep atomic.Int64
+
+func (p *pollStats) snapshot() PollStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// recordPoll counts a poll which started at start
+func (p *pollStats) recordPoll(start time.Time, err error) {
+	end := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Polls++
+	p.stats.LastPoll = start
+	p.stats.LastPollDuration = end.Sub(start)
+	if err != nil {
+		p.stats.Failures++
+		p.stats.LastError = err.Error()
+	} else {
+		p.stats.LastSuccess = end
+	}
+}
+
+// recordConnect counts a connection attempt
+func (p *pollStats) recordConnect(ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Connects++
+	if ok {
+		if p.stats.connected {
+			p.stats.Reconnects++
+		}
+		p.stats.connected = true
+	}
+}
+
+// recordReceived counts the bytes of a reply and whether it could be read
+func (p *pollStats) recordReceived(bytes int, parseError error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.BytesReceived += int64(bytes)
+	if parseError != nil {
+		p.stats.ParseErrors++
+		p.stats.LastError = parseError.Error()
+	}
+}
+
+// ClientStats is a client with its counters
+type ClientStats struct {
+	Flavor    string
+	Name      string
+	Ip        string
+	Connected bool
+	Stale     bool // connected, but no poll finished for too long
+	PollStats
+
+	LastPollDurationAsString string
+	LastSuccessAsString      string
+}
+
+// CollectorStats is the state of the collector itself
+type CollectorStats struct {
+	Start       time.Time
+	Uptime      string
+	Goroutines  int
+	MemoryInUse string
+	Subscribers int // browsers listening for live updates
+	BoincSweep  time.Time
+	FAHSweep    time.Time
+	Clients     []ClientStats
+	Problems    []string // why the collector is not ready
+}
+
+// staleAfter is how long a connected client may go without a finished poll
+func staleAfter(refresh int8) time.Duration {
+	return 3*time.Duration(refresh)*time.Second + 2*rpcTimeout
+}
+
+func clientStats(flavor string, client *DCClient, now time.Time) ClientStats {
+	stats := ClientStats{
+		Flavor:    flavor,
+		Name:      client.Name,
+		Ip:        client.Ip,
+		PollStats: client.stats.snapshot(),
+	}
+	client.mu.RLock()
+	stats.Connected = client.connection != nil
+	client.mu.RUnlock()
+
+	since := stats.LastSuccess
+	if since.IsZero() {
+		since = startTime
+	}
+	stats.Stale = stats.Connected && now.Sub(since) > staleAfter(client.Refresh)
+	if stats.Polls > 0 {
+		stats.LastPollDurationAsString = stats.LastPollDuration.Round(time.Millisecond).String()
+	}
+	if !stats.LastSuccess.IsZero() {
+		stats.LastSuccessAsString = stats.LastSuccess.Format("2006-01-02 15:04:05")
+	}
+	return stats
+}
+
+// collectorStats
+//
+// The counters of all clients and what keeps the collector from being ready
+func collectorStats(now time.Time) CollectorStats {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	stats := CollectorStats{
+		Start:       startTime,
+		Uptime:      formatDHMS(now.Sub(startTime).Round(time.Second).Seconds()),
+		Goroutines:  runtime.NumGoroutine(),
+		MemoryInUse: formatBytes(float64(memory.HeapInuse)),
+		Subscribers: events.subscriberCount(),
+	}
+	if sweep := boincSweep.Load(); sweep != 0 {
+		stats.BoincSweep = time.Unix(0, sweep)
+	}
+	if sweep := fahSweep.Load(); sweep != 0 {
+		stats.FAHSweep = time.Unix(0, sweep)
+	}
+
+	for idx := range dcClients.BOINCConfig.Clients {
+		client := &dcClients.BOINCConfig.Clients[idx]
+		stats.Clients = append(stats.Clients, clientStats(client.flavor(), &client.DCClient, now))
+	}
+	for idx := range dcClients.FAHConfig.Clients {
+		client := &dcClients.FAHConfig.Clients[idx]
+		stats.Clients = append(stats.Clients, clientStats(client.flavor(), &client.DCClient, now))
+	}
+	sort.SliceStable(stats.Clients, func(i, j int) bool {
+		return stats.Clients[i].Name < stats.Clients[j].Name
+	})
+
+	stats.Problems = readinessProblems(stats, now)
+	return stats
+}
+
+// readinessProblems lists what is wrong with the collector (not with the hosts)
+func readinessProblems(stats CollectorStats, now time.Time) []string {
+	var problems []string
+	// a loop missing a few runs hangs
+	late := 3 * sweepInterval
+	if len(dcClients.BOINCConfig.Clients) > 0 && now.Sub(stats.BoincSweep) > late {
+		problems = append(problems, "BOINC clients are not (re)connected")
+	}
+	if len(dcClients.FAHConfig.Clients) > 0 && now.Sub(stats.FAHSweep) > late {
+		problems = append(problems, "FAH clients are not (re)connected")
+	}
+	for _, client := range stats.Clients {
+		if client.Connects == 0 {
+			problems = append(problems, client.Flavor+" client "+client.Name+" not tried yet")
+		} else if client.Stale {
+			problems = append(problems, client.Flavor+" client "+client.Name+" connected but not polled since "+client.LastSuccessAsString)
+		}
+	}
+	return problems
+}
+
+// healthzHandler answers as long as the collector serves requests
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// readyzHandler answers 200 while the pollers work, 503 with the problems else
+func readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	problems := collectorStats(time.Now()).Problems
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, problem := range problems {
+			_, _ = w.Write([]byte(problem + "\n"))
+		}
+		return
+	}
+	_, _ = w.Write([]byte("ready\n"))
+}
+
+// statsHandler shows the counters of the pollers
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, r, "cvDCollector_stats.html", collectorStats(time.Now()))
+}
+
+// statsAPIHandler returns the counters of the pollers as JSON
+func statsAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	outputJSON(w, collectorStats(time.Now()))
+}
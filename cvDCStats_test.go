@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollStats(t *testing.T) {
+	server := startFakeBoinc(t, "remote")
+	client := newTestBoincClient(server, "remote")
+
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+	stats := client.stats.snapshot()
+	if stats.Connects != 1 || stats.Reconnects != 0 || stats.BytesReceived == 0 || stats.ParseErrors != 0 {
+		t.Errorf("after the first poll %+v", stats)
+	}
+
+	// loadState returns after the failed poll
+	server.dropConnections()
+	client.loadState()
+	stats = client.stats.snapshot()
+	if stats.Polls != 1 || stats.Failures != 1 || stats.LastError == "" || !stats.LastSuccess.IsZero() {
+		t.Errorf("after a failed poll %+v", stats)
+	}
+
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.disconnect(nil)
+	if stats = client.stats.snapshot(); stats.Connects != 2 || stats.Reconnects != 1 {
+		t.Errorf("after the reconnect %+v", stats)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	saved, savedFah := dcClients.BOINCConfig.Clients, dcClients.FAHConfig.Clients
+	defer func() {
+		dcClients.BOINCConfig.Clients, dcClients.FAHConfig.Clients = saved, savedFah
+		boincSweep.Store(0)
+	}()
+	dcClients.BOINCConfig.Clients = []BoincClient{{DCClient: DCClient{Name: "pi", Ip: "127.0.0.1", Refresh: 10}}}
+	dcClients.FAHConfig.Clients = nil
+
+	readyz := func() (int, string) {
+		recorder := httptest.NewRecorder()
+		readyzHandler(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// the loop never ran and the client was never tried
+	if code, body := readyz(); code != 503 || !strings.Contains(body, "not (re)connected") || !strings.Contains(body, "not tried yet") {
+		t.Errorf("before the first sweep: %d %q", code, body)
+	}
+
+	now := time.Now()
+	boincSweep.Store(now.UnixNano())
+	client := &dcClients.BOINCConfig.Clients[0]
+	client.stats.recordConnect(false)
+	if code, body := readyz(); code != 200 || body != "ready\n" {
+		t.Errorf("host down is no problem of the collector: %d %q", code, body)
+	}
+
+	// connected, but the last poll finished long ago
+	client.stats.recordConnect(true)
+	client.stats.recordPoll(now.Add(-time.Hour), nil)
+	client.stats.stats.LastSuccess = now.Add(-time.Hour)
+	connection, other := net.Pipe()
+	defer other.Close()
+	client.connection = connection
+	defer func() {
+		client.connection = nil
+		_ = connection.Close()
+	}()
+	stats := collectorStats(now)
+	if len(stats.Clients) != 1 || !stats.Clients[0].Stale || len(stats.Problems) != 1 {
+		t.Errorf("stale client %+v", stats)
+	}
+
+	recorder := httptest.NewRecorder()
+	healthzHandler(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != 200 {
+		t.Errorf("healthz %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	statsAPIHandler(recorder, httptest.NewRequest("GET", "/api/stats", nil))
+	var answer CollectorStats
+	if err := json.Unmarshal(recorder.Body.Bytes(), &answer); err != nil || len(answer.Clients) != 1 || answer.Clients[0].Connects != 2 {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+
+	recorder = httptest.NewRecorder()
+	statsHandler(recorder, httptest.NewRequest("GET", "/stats", nil))
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "pi") {
+		t.Errorf("page %d %s", recorder.Code, recorder.Body.String())
+	}
+}
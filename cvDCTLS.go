@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+//
+// TLS
+//
+// With a "tls" part in clients.json the collector serves HTTPS on "port". A
+// certificate and key missing on the first start are created self-signed (for
+// the LAN, the browser asks once to trust it); for a real one set "cert" and
+// "key" to its files. "redirect_port" answers plain HTTP with a redirect to
+// HTTPS. With "client_ca" browsers and scripts must present a certificate
+// signed by that CA; its common name is then the user name (see cvDCAuth.go).
+//
+
+// TLSConfig is the "tls" part of clients.json
+type TLSConfig struct {
+	Cert         string `json:"cert"`          // PEM certificate (chain), default cvDC.crt
+	Key          string `json:"key"`           // PEM private key, default cvDC.key
+	RedirectPort int    `json:"redirect_port"` // plain HTTP port redirecting to HTTPS, 0 for none
+	ClientCA     string `json:"client_ca"`     // PEM CA certificates client certificates are checked against
+	ClientAuth   string `json:"client_auth"`   // require (default with client_ca) or optional
+}
+
+const (
+	defaultCertFile = "cvDC.crt"
+	defaultKeyFile  = "cvDC.key"
+)
+
+// selfSignedValidity is how long a generated certificate is valid
+const selfSignedValidity = 5 * 365 * 24 * time.Hour
+
+// certFiles returns the certificate and key file, the defaults when not set
+func (config *TLSConfig) certFiles() (string, string) {
+	cert, key := config.Cert, config.Key
+	if cert == "" {
+		cert = defaultCertFile
+	}
+	if key == "" {
+		key = defaultKeyFile
+	}
+	return cert, key
+}
+
+// clientCertsEnabled tells if client certificates are checked
+func clientCertsEnabled() bool {
+	return dcClients.TLS != nil && dcClients.TLS.ClientCA != ""
+}
+
+// serverTLSConfig
+//
+// The TLS settings of the web server: the certificate (created first when
+// missing) and, with client_ca, the client certificate check
+func serverTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	certFile, keyFile := config.certFiles()
+	if err := ensureCertificate(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if config.ClientCA == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(config.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in client_ca %s", config.ClientCA)
+	}
+	switch config.ClientAuth {
+	case "", "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("client_auth %q is neither require nor optional", config.ClientAuth)
+	}
+	return tlsConfig, nil
+}
+
+// ensureCertificate creates a self-signed certificate and key when neither file exists
+func ensureCertificate(certFile string, keyFile string) error {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return nil
+	}
+	if !errors.Is(certErr, fs.ErrNotExist) || !errors.Is(keyErr, fs.ErrNotExist) {
+		return fmt.Errorf("need both or none of %s and %s", certFile, keyFile)
+	}
+
+	certPEM, keyPEM, err := selfSignedCertificate(certificateHosts(), time.Now())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	slog.Info("created self-signed certificate", "cert", certFile, "key", keyFile)
+	return nil
+}
+
+// certificateHosts are the names and addresses the collector can be reached by
+func certificateHosts() []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// selfSignedCertificate returns a PEM certificate and key for the host names and addresses
+func selfSignedCertificate(hosts []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"cvDCollect"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true, // a leaf, no CA which could sign for other hosts
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// redirectHandler sends plain HTTP requests to the same URL on the HTTPS port
+func redirectHandler(httpsPort int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+// serve
+//
+// Run the web server with the registered handlers, HTTPS when configured
+func serve() error {
+	addr := fmt.Sprintf(":%d", dcClients.ServerPort)
+	if dcClients.TLS == nil {
+		return http.ListenAndServe(addr, nil)
+	}
+
+	tlsConfig, err := serverTLSConfig(dcClients.TLS)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if port := dcClients.TLS.RedirectPort; port != 0 {
+		go func() {
+			redirectAddr := fmt.Sprintf(":%d", port)
+			if err := http.ListenAndServe(redirectAddr, redirectHandler(dcClients.ServerPort)); err != nil {
+				slog.Error("redirect to HTTPS", "address", redirectAddr, "error", err)
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: addr, TLSConfig: tlsConfig}
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cvDC.crt")
+	keyFile := filepath.Join(dir, "cvDC.key")
+
+	tlsConfig, err := serverTLSConfig(&TLSConfig{Cert: certFile, Key: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign != 0 || cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 || len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("no leaf certificate: CA %v, usage %v %v", cert.IsCA, cert.KeyUsage, cert.ExtKeyUsage)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file %v, %v", info, err)
+	}
+
+	// the certificate of the first start stays
+	if _, err := serverTLSConfig(&TLSConfig{Cert: certFile, Key: keyFile}); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := tls.LoadX509KeyPair(certFile, keyFile)
+	if string(again.Certificate[0]) != string(tlsConfig.Certificates[0].Certificate[0]) {
+		t.Error("certificate created again")
+	}
+
+	// half a pair is an error, not replaced
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serverTLSConfig(&TLSConfig{Cert: certFile, Key: keyFile}); err == nil {
+		t.Error("certificate without key accepted")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"pi.local:8080", 8443, "https://pi.local:8443/boinc/all?sort=deadline"},
+		{"pi.local", 443, "https://pi.local/boinc/all?sort=deadline"},
+		{"[fe80::1]:8080", 8443, "https://[fe80::1]:8443/boinc/all?sort=deadline"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "http://"+test.host+"/boinc/all?sort=deadline", nil)
+		recorder := httptest.NewRecorder()
+		redirectHandler(test.port)(recorder, request)
+		if recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != test.want {
+			t.Errorf("%s: %d to %s", test.host, recorder.Code, recorder.Header().Get("Location"))
+		}
+	}
+}
+
+// testCertificate signs a certificate for name with the CA (self-signed without one)
+func testCertificate(t *testing.T, name string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca == nil,
+	}
+	parent, signer := template, interface{}(key)
+	if ca != nil {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := testCertificate(t, "farm CA", nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &TLSConfig{Cert: filepath.Join(dir, "cvDC.crt"), Key: filepath.Join(dir, "cvDC.key"), ClientCA: caFile}
+	dcClients.TLS = config
+	defer func() { dcClients.TLS = nil }()
+	withAuth(t, AuthConfig{Users: []AuthUser{{Name: "anna", Role: RoleOperator}}})
+
+	tlsConfig, err := serverTLSConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(authorize(RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		user := requestUser(r)
+		_, _ = w.Write([]byte(user.Name + " " + user.Role.String()))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(cert *tls.Certificate) (string, error) {
+		clientConfig := &tls.Config{InsecureSkipVerify: true}
+		if cert != nil {
+			clientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		response, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+		body := make([]byte, 100)
+		n, _ := response.Body.Read(body)
+		return string(body[:n]), nil
+	}
+
+	anna := testCertificate(t, "anna", &ca)
+	if body, err := get(&anna); err != nil || body != "anna operator" {
+		t.Errorf("anna: %q, %v", body, err)
+	}
+	ben := testCertificate(t, "ben", &ca)
+	if body, err := get(&ben); err != nil || body != "ben viewer" {
+		t.Errorf("ben: %q, %v", body, err)
+	}
+	if _, err := get(nil); err == nil {
+		t.Error("no certificate accepted")
+	}
+	stranger := testCertificate(t, "anna", nil)
+	if _, err := get(&stranger); err == nil {
+		t.Error("certificate of another CA accepted")
+	}
+}
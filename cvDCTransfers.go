@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+//
+// File transfers
+//
+// The uploads and downloads of the BOINC hosts. A transfer which failed waits
+// for its next retry, further and further out, and a project which failed
+// too often holds back all its transfers; uploads stuck like that behind a
+// flaky router lose the credit once the deadline passes. /boinc/transfers
+// lists them farm wide, stuck ones first, and operators can retry them all at
+// once.
+//
+
+// BoincTransfer
+//
+// One upload or download of a host, prepared for display
+type BoincTransfer struct {
+	FileTransfer
+	Client    string
+	IsUpload  bool
+	Active    bool // transferring right now
+	Stuck     bool // waiting for a retry or held back by the project
+	Done      float64
+	Progress  float64
+	NextRetry time.Time // zero unless waiting for a retry
+	Error     string
+
+	DirectionAsString string
+	ProgressAsString  string
+	BytesAsString     string // done of all, e.g. "1.2 MiB of 3.4 MiB"
+	SpeedAsString     string
+	NextRetryAsString string // e.g. "in 1h:12m:5s"
+	BackoffAsString   string
+}
+
+// boincTransfer prepares a transfer of a client for display
+func boincTransfer(client string, transfer FileTransfer, now time.Time) BoincTransfer {
+	persistent := transfer.PersistentFileXfer
+	view := BoincTransfer{
+		FileTransfer: transfer,
+		Client:       client,
+		IsUpload:     persistent.IsUpload != 0,
+		Active:       transfer.FileXfer != nil,
+		Done:         persistent.LastBytesXferred,
+	}
+	if view.ProjectName == "" {
+		view.ProjectName = transfer.ProjectUrl
+	}
+	view.DirectionAsString = "download"
+	if view.IsUpload {
+		view.DirectionAsString = "upload"
+	}
+
+	if view.Active {
+		view.Done = transfer.FileXfer.BytesXferred + transfer.FileXfer.FileOffset
+		view.SpeedAsString = formatBytes(transfer.FileXfer.XferSpeed) + "/s"
+	} else if next := time.Unix(int64(persistent.NextRequestTime), 0); persistent.NextRequestTime > 0 && next.After(now) {
+		view.NextRetry = next
+		view.NextRetryAsString = "in " + formatDHMS(next.Sub(now).Round(time.Second).Seconds())
+	}
+	if transfer.ProjectBackoff > 0 {
+		view.BackoffAsString = formatDHMS(transfer.ProjectBackoff)
+	}
+	if transfer.Status < 0 {
+		view.Error = fmt.Sprintf("error %d", transfer.Status)
+	}
+	view.Stuck = !view.Active && (persistent.NumRetries > 0 || transfer.ProjectBackoff > 0 || transfer.Status < 0)
+
+	if transfer.NBytes > 0 {
+		view.Progress = view.Done / transfer.NBytes
+		view.ProgressAsString = formatPercent(view.Progress)
+	}
+	view.BytesAsString = formatBytes(view.Done) + " of " + formatBytes(transfer.NBytes)
+	return view
+}
+
+// farmTransfers
+//
+// All transfers of the farm, stuck ones first, the longest retried first
+func farmTransfers(views []BoincClientView) []BoincTransfer {
+	var transfers []BoincTransfer
+	for _, view := range views {
+		transfers = append(transfers, view.Transfers...)
+	}
+	sort.SliceStable(transfers, func(i, j int) bool {
+		if transfers[i].Stuck != transfers[j].Stuck {
+			return transfers[i].Stuck
+		}
+		return transfers[i].PersistentFileXfer.NumRetries > transfers[j].PersistentFileXfer.NumRetries
+	})
+	return transfers
+}
+
+// transfersHandler shows the transfers of the farm
+func transfersHandler(w http.ResponseWriter, r *http.Request) {
+	transfers := farmTransfers(boincViews())
+	stuck := 0
+	for _, transfer := range transfers {
+		if transfer.Stuck {
+			stuck++
+		}
+	}
+
+	data := struct {
+		Transfers []BoincTransfer
+		Stuck     int
+	}{
+		Transfers: transfers,
+		Stuck:     stuck,
+	}
+	renderPage(w, r, "cvDCollector_transfers.html", data)
+}
+
+// transfersAPIHandler returns the transfers of the farm as JSON
+func transfersAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	transfers := farmTransfers(boincViews())
+	if transfers == nil {
+		transfers = []BoincTransfer{}
+	}
+	outputJSON(w, transfers)
+}
+
+// retryTransferHandler
+//
+// Retry the transfer "file" of "project" on the client of the path; without
+// a file all stuck transfers of the client, or of the farm for "all"
+func retryTransferHandler(w http.ResponseWriter, r *http.Request) {
+	transferAction(w, r, "retry-transfer")
+}
+
+// abortTransferHandler gives up the transfer "file" of "project" on the client of the path
+func abortTransferHandler(w http.ResponseWriter, r *http.Request) {
+	transferAction(w, r, "abort-transfer")
+}
+
+// transferAction runs retry-transfer or abort-transfer and answers what came of it
+func transferAction(w http.ResponseWriter, r *http.Request, action string) {
+	clientName := r.URL.Path[len("/"+action+"/"):]
+	project, file := r.FormValue("project"), r.FormValue("file")
+
+	var clients []*BoincClient
+	if clientName == "all" && file == "" {
+		for idx := range dcClients.BOINCConfig.Clients {
+			clients = append(clients, &dcClients.BOINCConfig.Clients[idx])
+		}
+	} else if client := findBoincClient(clientName); client != nil {
+		clients = append(clients, client)
+	} else {
+		http.Error(w, "no BOINC client "+clientName, http.StatusNotFound)
+		return
+	}
+	if file == "" && action != "retry-transfer" {
+		http.Error(w, "which file?", http.StatusBadRequest)
+		return
+	}
+
+	done, failed := 0, 0
+	var messages []string
+	for _, client := range clients {
+		// the given transfer, or the stuck ones
+		var targets []FileTransfer
+		if file != "" {
+			targets = append(targets, FileTransfer{ProjectUrl: project, Name: file})
+		} else {
+			for _, transfer := range client.view().Transfers {
+				if transfer.Stuck {
+					targets = append(targets, transfer.FileTransfer)
+				}
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		for _, target := range targets {
+			var err error
+			command := "retry_file_transfer"
+			if action == "abort-transfer" {
+				command = "abort_file_transfer"
+				err = client.abortFileTransfer(target.ProjectUrl, target.Name)
+			} else {
+				err = client.retryFileTransfer(target.ProjectUrl, target.Name)
+			}
+			audit(r, client.Name, action, command+" "+target.ProjectUrl+" "+target.Name, "", err)
+			if err != nil {
+				client.logger().Warn(command+" failed", "file", target.Name, "error", err)
+				messages = append(messages, client.Name+": "+target.Name+": "+err.Error())
+				failed++
+			} else {
+				done++
+			}
+		}
+		// show the new state right away
+		if err := client.pollFileTransfers(); err != nil {
+			client.logger().Warn("get_file_transfers failed", "error", err)
+		}
+		publishBoinc(client)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if failed > 0 {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	_, _ = fmt.Fprintf(w, "%s: %d done, %d failed\n", action, done, failed)
+	if len(messages) > 0 {
+		_, _ = fmt.Fprintln(w, strings.Join(messages, "\n"))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoincFileTransfers(t *testing.T) {
+	server, client := polledTestBoinc(t)
+	if len(client.FileTransfers) != 2 {
+		t.Fatalf("transfers %+v", client.FileTransfers)
+	}
+
+	transfers := client.view().Transfers
+	upload, download := transfers[0], transfers[1]
+	if !upload.IsUpload || !upload.Stuck || upload.Active || upload.NextRetry.IsZero() || upload.BackoffAsString != "30m:0s" {
+		t.Errorf("upload %+v", upload)
+	}
+	if upload.ProgressAsString != "25.0%" || upload.DirectionAsString != "upload" || !strings.HasPrefix(upload.NextRetryAsString, "in ") {
+		t.Errorf("upload %q %q %q", upload.ProgressAsString, upload.DirectionAsString, upload.NextRetryAsString)
+	}
+	if download.IsUpload || download.Stuck || !download.Active || download.ProgressAsString != "50.0%" || download.SpeedAsString != "256.0 KiB/s" {
+		t.Errorf("download %+v", download)
+	}
+
+	// an error reply keeps the transfers known and the client polled
+	server.setReply("get_file_transfers", func(string) string { return boincReply("<error>unauthorized</error>") })
+	client.lastTransfers = time.Time{}
+	if err := client.poll(); err != nil || !client.isConnected() || len(client.FileTransfers) != 2 {
+		t.Errorf("error reply: %v, %+v", err, client.FileTransfers)
+	}
+
+	failed := boincTransfer("pi", FileTransfer{Name: "x", NBytes: 10, Status: -161}, time.Now())
+	if !failed.Stuck || failed.Error != "error -161" || failed.ProgressAsString != "0.0%" {
+		t.Errorf("failed %+v", failed)
+	}
+}
+
+func TestRetryTransfers(t *testing.T) {
+	withAuth(t, AuthConfig{})
+	server := startFakeBoinc(t, "")
+	saved := dcClients.BOINCConfig.Clients
+	defer func() { dcClients.BOINCConfig.Clients = saved }()
+	ip, port := server.Addr()
+	dcClients.BOINCConfig.Clients = []BoincClient{{DCClient: DCClient{Name: "pi", Ip: ip, Port: port}}}
+	client := &dcClients.BOINCConfig.Clients[0]
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.disconnect(nil)
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	var retried []string
+	server.setReply("retry_file_transfer", func(request string) string {
+		retried = append(retried, request)
+		return boincReply("<success/>")
+	})
+	post := func(path string, form url.Values) (int, string) {
+		form.Set("csrf", csrfToken(User{}))
+		request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = "127.0.0.1:4711"
+		recorder := httptest.NewRecorder()
+		handler := retryTransferHandler
+		if strings.HasPrefix(path, "/abort-transfer/") {
+			handler = abortTransferHandler
+		}
+		authorize(RoleOperator, handler)(recorder, request)
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// only the stuck upload is retried
+	if code, body := post("/retry-transfer/all", url.Values{}); code != 200 || !strings.HasPrefix(body, "retry-transfer: 1 done, 0 failed") {
+		t.Errorf("retry all: %d %q", code, body)
+	}
+	if len(retried) != 1 || !strings.Contains(retried[0], "<filename>MCM1_0193412_7722_1_r1783641128_0</filename>") {
+		t.Errorf("retried %q", retried)
+	}
+
+	if code, _ := post("/abort-transfer/pi", url.Values{}); code != 400 {
+		t.Errorf("abort without a file: %d", code)
+	}
+	if code, _ := post("/retry-transfer/nas", url.Values{}); code != 404 {
+		t.Errorf("unknown client: %d", code)
+	}
+	// the fake client knows no abort_file_transfer
+	code, body := post("/abort-transfer/pi", url.Values{"project": {"http://www.worldcommunitygrid.org/"}, "file": {"OPN1_0036754_03211.zip"}})
+	if code != 502 || !strings.Contains(body, "unrecognized op") {
+		t.Errorf("abort: %d %q", code, body)
+	}
+
+	entries, err := readAudit(auditFile(), "pi", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "abort-transfer" || entries[0].Outcome != AuditFailed || entries[1].Outcome != AuditOK {
+		t.Errorf("audit %+v", entries)
+	}
+
+	recorder := httptest.NewRecorder()
+	transfersAPIHandler(recorder, httptest.NewRequest("GET", "/api/boinc/transfers", nil))
+	var answer []BoincTransfer
+	if err := json.Unmarshal(recorder.Body.Bytes(), &answer); err != nil || len(answer) != 2 || !answer[0].Stuck {
+		t.Errorf("api %s, %v", recorder.Body.String(), err)
+	}
+	recorder = httptest.NewRecorder()
+	transfersHandler(recorder, httptest.NewRequest("GET", "/boinc/transfers", nil))
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), "1 stuck") {
+		t.Errorf("page %d %s", recorder.Code, recorder.Body.String())
+	}
+}
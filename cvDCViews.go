@@ -0,0 +1,476 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Views
+//
+// What the HTML pages and the JSON API show: the polled client state joined
+// and prepared for display, built under the client lock so the pollers can
+// keep updating while a page renders.
+//
+
+// BoincTask
+//
+// One result joined with its workunit, application, app version and project
+type BoincTask struct {
+	Result
+	Client      string
+	AppName     string // user friendly application name, the short name if unknown
+	ProjectName string
+	Ncpus       float64 // average number of CPUs used
+	Coprocs     []AppVersionCoproc
+	FpopsEst    float64 // estimated floating point operations of the workunit
+	Flops       float64 // estimated speed of the app version on this host
+
+	Status        TaskStatus
+	SuspendReason SuspendReason
+
+	Deadline        time.Time
+	ProjectedFinish time.Time
+	Slack           time.Duration // time between projected finish and deadline
+	Risk            DeadlineRisk
+
+	DeadlineAsString string
+	SlackAsString    string
+
+	ReceivedAsString string
+	ElapsedAsString  string // run time so far, the final one when finished
+	CPUTimeAsString  string
+
+	ResourcesAsString string
+	FpopsEstAsString  string
+}
+
+// BoincClientView
+//
+// One BOINC client with its joined tasks
+type BoincClientView struct {
+	Name            string
+	Ip              string
+	ConnectionError string
+	HostInfo        HostInfo
+	NetStats        NetStats
+	TimeStats       TimeStats
+	CCStatus        CCStatus
+	Projects        Projects
+	Tasks           []BoincTask
+	AtRisk          int // tasks projected to miss their deadline
+	Missed          int // tasks past their deadline
+	ClientVersion   string
+	Platforms       []string // the primary platform first
+	Disk            HostDisk
+	Transfers       []BoincTransfer
+	Prefs           HostPrefs
+}
+
+// BoincHostView
+//
+// Everything known about one BOINC host, for its own page
+type BoincHostView struct {
+	BoincClientView
+	MemoryAsString      string
+	SwapAsString        string
+	DiskAsString        string // free of total
+	ClientStartAsString string
+	UptimeAsString      string // since the client started
+	OnAsString          string // share of the time the client runs
+	ConnectedAsString   string
+	AvailableAsString   string // CPU and network available
+	ActiveAsString      string // computing allowed
+	GpuActiveAsString   string
+	UploadAsString      string // average transfer rates
+	DownloadAsString    string
+	GPUs                []GPU
+	HostProjects        []HostProject
+}
+
+// GPU
+//
+// One kind of GPU of a host, as the client groups them
+type GPU struct {
+	Type              string // as the app versions name it: NVIDIA, ATI, intel_gpu or the OpenCL type
+	Name              string // of the best device
+	Count             int
+	Devices           []OpenCLDevice // as OpenCL sees them, one per device
+	MemoryAsString    string
+	PeakFlopsAsString string
+	VersionsAsString  string // CUDA, CAL, OpenCL and driver versions as known
+}
+
+// HostProject
+//
+// A project attached to a host with its share of the host
+type HostProject struct {
+	Project
+	Suspended     bool
+	NoNewWork     bool    // dont_request_more_work
+	Share         float64 // fraction of the resource shares of all projects on the host
+	ShareAsString string
+}
+
+// FAHClientView
+//
+// One FAH client with its slots and units
+type FAHClientView struct {
+	Name            string
+	Ip              string
+	ConnectionError string
+	Slots           []Slot
+	Units           []Unit
+	Options         FAHHostOptions
+}
+
+// view
+//
+// Snapshot of a BOINC client for display
+func (client *BoincClient) view() BoincClientView {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	state := client.ClientStateReply.ClientState
+	view := BoincClientView{
+		Name:      client.Name,
+		Ip:        client.Ip,
+		HostInfo:  state.HostInfo,
+		NetStats:  state.NetStats,
+		TimeStats: state.TimeStats,
+		CCStatus:  client.CCStatus,
+		Projects:  state.Projects,
+		Platforms: state.Platforms,
+	}
+	if state.CoreClientMajorVersion > 0 {
+		view.ClientVersion = fmt.Sprintf("%d.%d.%d", state.CoreClientMajorVersion, state.CoreClientMinorVersion, state.CoreClientRelease)
+	}
+	if len(view.Platforms) == 0 && state.PlatformName != "" {
+		view.Platforms = []string{state.PlatformName}
+	}
+	view.Disk = hostDisk(client.DiskUsage, state.HostInfo, state.Projects)
+	for _, transfer := range client.FileTransfers {
+		view.Transfers = append(view.Transfers, boincTransfer(client.Name, transfer, time.Now()))
+	}
+	view.Prefs = hostPrefs(client.GlobalPrefs, client.PrefsOverride, int(state.HostInfo.PnCPUs))
+	if client.ConnectionError != nil {
+		view.ConnectionError = client.ConnectionError.Error()
+	}
+
+	apps := make(map[string]App, len(state.Apps))
+	for _, app := range state.Apps {
+		apps[app.Name] = app
+	}
+	workUnits := make(map[string]WorkUnit, len(state.WorkUnits))
+	for _, workUnit := range state.WorkUnits {
+		workUnits[workUnit.Name] = workUnit
+	}
+
+	for _, result := range state.Results {
+		task := BoincTask{Result: result, Client: client.Name}
+		task.Status, task.SuspendReason = taskStatus(result, client.CCStatus)
+
+		if idx := state.Projects.index(result.ProjectUrl); idx >= 0 {
+			task.ProjectName = state.Projects[idx].ProjectName
+		} else {
+			task.ProjectName = result.ProjectUrl
+		}
+
+		workUnit := workUnits[result.WUName]
+		task.FpopsEst = workUnit.RscFpopsEst
+		task.AppName = workUnit.AppName
+		if app, ok := apps[workUnit.AppName]; ok && app.UserFriendlyName != "" {
+			task.AppName = app.UserFriendlyName
+		}
+
+		if appVersion, ok := findAppVersion(state.AppVersions, workUnit.AppName, result); ok {
+			task.Ncpus = appVersion.AvgNcpus
+			task.Coprocs = appVersion.Coprocs
+			task.Flops = appVersion.Flops
+		}
+
+		task.ResourcesAsString = formatResources(task.Ncpus, task.Coprocs)
+		task.FpopsEstAsString = formatFpops(task.FpopsEst)
+		task.ReceivedAsString = formatTimestamp(result.ReceivedTime)
+		if result.FinalElapsedTime > 0 {
+			task.ElapsedAsString = formatDHMS(math.Round(result.FinalElapsedTime))
+			task.CPUTimeAsString = formatDHMS(math.Round(result.FinalCPUTime))
+		} else {
+			task.ElapsedAsString = formatDHMS(math.Round(result.Activetask.ElapsedTime))
+			task.CPUTimeAsString = formatDHMS(math.Round(result.Activetask.CurrentCPUTime))
+		}
+		view.Tasks = append(view.Tasks, task)
+	}
+
+	assessDeadlines(view.Tasks, int(state.HostInfo.PnCPUs), hostGPUs(state.HostInfo.Coprocs), state.TimeStats, time.Now())
+	for _, task := range view.Tasks {
+		switch task.Risk {
+		case DeadlineAtRisk:
+			view.AtRisk++
+		case DeadlineMissed:
+			view.Missed++
+		}
+	}
+
+	return view
+}
+
+// hostView
+//
+// Extend the view of a BOINC host with the details shown on its own page
+func (view BoincClientView) hostView() BoincHostView {
+	host := BoincHostView{BoincClientView: view}
+	info := view.HostInfo
+	host.MemoryAsString = formatBytes(info.MNBytes)
+	host.SwapAsString = formatBytes(info.MSwap)
+	host.DiskAsString = formatBytes(info.DFree) + " free of " + formatBytes(info.DTotal)
+	if view.TimeStats.ClientStartTime > 0 {
+		host.ClientStartAsString = formatTimestamp(view.TimeStats.ClientStartTime)
+		if view.TimeStats.Now > view.TimeStats.ClientStartTime {
+			host.UptimeAsString = formatDHMS(math.Round(view.TimeStats.Now - view.TimeStats.ClientStartTime))
+		}
+	}
+	host.OnAsString = formatPercent(view.TimeStats.OnFrac)
+	host.ConnectedAsString = formatPercent(view.TimeStats.ConnectedFrac)
+	host.AvailableAsString = formatPercent(view.TimeStats.CpuNetworkAvailableFrac)
+	host.ActiveAsString = formatPercent(view.TimeStats.ActiveFrac)
+	host.GpuActiveAsString = formatPercent(view.TimeStats.GpuActiveFrac)
+	host.UploadAsString = formatBytes(view.NetStats.AvgUp) + "/s"
+	host.DownloadAsString = formatBytes(view.NetStats.AvgDown) + "/s"
+	host.GPUs = hostGPUs(info.Coprocs)
+	host.HostProjects = hostProjects(view.Projects)
+	return host
+}
+
+// hostGPUs lists the GPUs of a host, NVIDIA, AMD and Intel first
+func hostGPUs(coprocs Coprocs) []GPU {
+	var gpus []GPU
+	add := func(gpuType string, coproc Coproc, devices []OpenCLDevice) {
+		gpu := GPU{Type: gpuType, Name: coproc.Name, Count: coproc.Count, Devices: devices}
+		if gpu.Name == "" && len(devices) > 0 {
+			gpu.Name = devices[0].Name
+		}
+		if coproc.AvailableRam > 0 {
+			gpu.MemoryAsString = formatBytes(coproc.AvailableRam)
+		}
+		if coproc.PeakFlops > 0 {
+			gpu.PeakFlopsAsString = formatFpops(coproc.PeakFlops) + "/s"
+		}
+		gpu.VersionsAsString = coprocVersions(coproc, devices)
+		gpus = append(gpus, gpu)
+	}
+
+	for _, coproc := range coprocs.Cuda {
+		add("NVIDIA", coproc, coproc.NvidiaOpenCL)
+	}
+	for _, coproc := range coprocs.Ati {
+		add("ATI", coproc, coproc.AtiOpenCL)
+	}
+	for _, coproc := range coprocs.IntelGpu {
+		add("intel_gpu", coproc, coproc.IntelOpenCL)
+	}
+	for _, coproc := range coprocs.Other {
+		add(coproc.Type, coproc, coproc.OtherOpenCL)
+	}
+	return gpus
+}
+
+// coprocVersions describes the drivers of a GPU, e.g. "CUDA 11.4, driver 470.86, OpenCL 3.0 CUDA"
+func coprocVersions(coproc Coproc, devices []OpenCLDevice) string {
+	var versions []string
+	if coproc.CudaVersion > 0 {
+		versions = append(versions, fmt.Sprintf("CUDA %d.%d", coproc.CudaVersion/1000, coproc.CudaVersion%1000/10))
+	}
+	if coproc.DriverVersion > 0 {
+		versions = append(versions, fmt.Sprintf("driver %d.%02d", coproc.DriverVersion/100, coproc.DriverVersion%100))
+	}
+	if coproc.CALVersion != "" {
+		versions = append(versions, "CAL "+coproc.CALVersion)
+	}
+	if coproc.Version != "" {
+		versions = append(versions, "driver "+coproc.Version)
+	}
+	if len(devices) > 0 && devices[0].DeviceVersion != "" {
+		versions = append(versions, devices[0].DeviceVersion)
+	}
+	return strings.Join(versions, ", ")
+}
+
+// hostProjects adds the share of the host and the state flags to the projects
+func hostProjects(projects Projects) []HostProject {
+	total := 0.0
+	for _, project := range projects {
+		total += project.ResourceShare
+	}
+
+	hostProjects := make([]HostProject, 0, len(projects))
+	for _, project := range projects {
+		hostProject := HostProject{
+			Project:   project,
+			Suspended: project.SuspendedViaGui != nil,
+			NoNewWork: project.DontRequestMoreWork != nil,
+		}
+		if total > 0 {
+			hostProject.Share = project.ResourceShare / total
+			hostProject.ShareAsString = formatPercent(hostProject.Share)
+		}
+		hostProjects = append(hostProjects, hostProject)
+	}
+	return hostProjects
+}
+
+// findAppVersion returns the app version a result runs with
+func findAppVersion(appVersions []AppVersion, appName string, result Result) (AppVersion, bool) {
+	versionNum, _ := strconv.Atoi(result.VersionNum)
+	for _, appVersion := range appVersions {
+		if appVersion.AppName == appName && appVersion.VersionNum == versionNum &&
+			appVersion.PlanClass == result.PlanClass &&
+			(result.Platform == "" || appVersion.Platform == result.Platform) {
+			return appVersion, true
+		}
+	}
+	return AppVersion{}, false
+}
+
+// view
+//
+// Snapshot of a FAH client for display
+func (client *FAHClient) view() FAHClientView {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	view := FAHClientView{
+		Name:  client.Name,
+		Ip:    client.Ip,
+		Slots: client.Slots.Slots,
+		Units: client.Units.Units,
+	}
+	view.Options = hostOptions(client.Options, view.Slots, client.SlotOptions)
+	if client.ConnectionError != nil {
+		view.ConnectionError = client.ConnectionError.Error()
+	}
+	return view
+}
+
+// findBoincClient returns the configured BOINC client of that name, nil if unknown
+func findBoincClient(name string) *BoincClient {
+	for idx := range dcClients.BOINCConfig.Clients {
+		if dcClients.BOINCConfig.Clients[idx].Name == name {
+			return &dcClients.BOINCConfig.Clients[idx]
+		}
+	}
+	return nil
+}
+
+// findBoincClients returns the configured BOINC clients of a list like "pi,nas", all of them for "all"
+func findBoincClients(names string) ([]*BoincClient, error) {
+	var clients []*BoincClient
+	if names == "all" {
+		for idx := range dcClients.BOINCConfig.Clients {
+			clients = append(clients, &dcClients.BOINCConfig.Clients[idx])
+		}
+		return clients, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		client := findBoincClient(name)
+		if client == nil {
+			return nil, fmt.Errorf("no BOINC client %s", name)
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// findFAHClient returns the configured FAH client of that name, nil if unknown
+func findFAHClient(name string) *FAHClient {
+	for idx := range dcClients.FAHConfig.Clients {
+		if dcClients.FAHConfig.Clients[idx].Name == name {
+			return &dcClients.FAHConfig.Clients[idx]
+		}
+	}
+	return nil
+}
+
+// findFAHClients returns the configured FAH clients of a list like "pi,nas", all of them for "all"
+func findFAHClients(names string) ([]*FAHClient, error) {
+	var clients []*FAHClient
+	if names == "all" {
+		for idx := range dcClients.FAHConfig.Clients {
+			clients = append(clients, &dcClients.FAHConfig.Clients[idx])
+		}
+		return clients, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		client := findFAHClient(name)
+		if client == nil {
+			return nil, fmt.Errorf("no FAH client %s", name)
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// boincViews returns the views of all configured BOINC clients
+func boincViews() []BoincClientView {
+	views := make([]BoincClientView, 0, len(dcClients.BOINCConfig.Clients))
+	for idx := range dcClients.BOINCConfig.Clients {
+		views = append(views, dcClients.BOINCConfig.Clients[idx].view())
+	}
+	return views
+}
+
+// fahViews returns the views of all configured FAH clients
+func fahViews() []FAHClientView {
+	views := make([]FAHClientView, 0, len(dcClients.FAHConfig.Clients))
+	for idx := range dcClients.FAHConfig.Clients {
+		views = append(views, dcClients.FAHConfig.Clients[idx].view())
+	}
+	return views
+}
+
+// formatResources describes the CPU and GPU usage of a task, e.g. "1 CPU + 1 NVIDIA GPU"
+func formatResources(ncpus float64, coprocs []AppVersionCoproc) string {
+	text := strconv.FormatFloat(ncpus, 'g', 3, 64) + " CPU"
+	for _, coproc := range coprocs {
+		text += " + " + strconv.FormatFloat(coproc.Count, 'g', 3, 64) + " " + coproc.Type + " GPU"
+	}
+	return text
+}
+
+// formatBytes scales a number of bytes, e.g. "15.6 GiB"
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	idx := 0
+	for bytes >= 1024 && idx < len(units)-1 {
+		bytes /= 1024
+		idx++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[idx])
+}
+
+// formatPercent shows a fraction as percentage, e.g. "99.5%"
+func formatPercent(fraction float64) string {
+	return strconv.FormatFloat(fraction*100, 'f', 1, 64) + "%"
+}
+
+// formatTimestamp shows a BOINC timestamp (seconds since 1970), empty when unset
+func formatTimestamp(timestamp float64) string {
+	if timestamp <= 0 {
+		return ""
+	}
+	return time.Unix(int64(timestamp), 0).Format("2006-01-02 15:04")
+}
+
+// formatFpops scales a number of floating point operations, e.g. "17.7 TFLOP"
+func formatFpops(fpops float64) string {
+	units := []string{"", "k", "M", "G", "T", "P", "E"}
+	idx := 0
+	for fpops >= 1000 && idx < len(units)-1 {
+		fpops /= 1000
+		idx++
+	}
+	return fmt.Sprintf("%.1f %sFLOP", fpops, units[idx])
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoincViewJoinsTasks(t *testing.T) {
+	_, client := polledTestBoinc(t)
+
+	view := client.view()
+	if view.Name != "pi" || view.ConnectionError != "" || len(view.Tasks) != 3 {
+		t.Fatalf("view = %+v", view)
+	}
+	for _, task := range view.Tasks {
+		if task.ProjectName != "World Community Grid" {
+			t.Errorf("%s project = %q", task.Name, task.ProjectName)
+		}
+		if task.Ncpus != 1 || task.ResourcesAsString != "1 CPU" {
+			t.Errorf("%s resources = %v %q", task.Name, task.Ncpus, task.ResourcesAsString)
+		}
+		switch task.WUName {
+		case "MCM1_0169427_1745":
+			if task.AppName != "Mapping Cancer Markers" || task.FpopsEstAsString != "27.1 TFLOP" {
+				t.Errorf("%s = %q / %q", task.Name, task.AppName, task.FpopsEstAsString)
+			}
+		default:
+			if task.AppName != "OpenPandemics - COVID-19" || task.FpopsEst != 17712338813658 {
+				t.Errorf("%s = %q / %v", task.Name, task.AppName, task.FpopsEst)
+			}
+		}
+	}
+}
+
+func TestFormatResources(t *testing.T) {
+	got := formatResources(0.5, []AppVersionCoproc{{Type: "NVIDIA", Count: 1}})
+	if got != "0.5 CPU + 1 NVIDIA GPU" {
+		t.Errorf("formatResources = %q", got)
+	}
+}
+
+func TestTaskStatus(t *testing.T) {
+	downloaded := Result{State: ResultFilesDownloaded}
+	running := downloaded
+	running.Activetask = ActiveTask{TaskState: TaskExecuting, SchedulerState: SchedulerScheduled, FractionDone: 0.5}
+	preempted := downloaded
+	preempted.Activetask = ActiveTask{TaskState: TaskSuspended, SchedulerState: SchedulerPreempted, FractionDone: 0.5}
+	suspended := running
+	suspended.SuspendedViaGui = &struct{}{}
+	reported := Result{State: ResultFilesUploaded, ReadyToReport: &struct{}{}}
+
+	tests := []struct {
+		name     string
+		result   Result
+		ccStatus CCStatus
+		status   TaskStatus
+		reason   SuspendReason
+	}{
+		{"ready", downloaded, CCStatus{}, StatusReadyToStart, SuspendNone},
+		{"running", running, CCStatus{}, StatusRunning, SuspendNone},
+		{"throttled", running, CCStatus{TaskSuspendReason: SuspendCPUThrottle}, StatusRunning, SuspendNone},
+		{"waiting", preempted, CCStatus{}, StatusWaiting, SuspendNone},
+		{"by user", suspended, CCStatus{}, StatusSuspended, SuspendUserRequest},
+		{"in use", running, CCStatus{TaskSuspendReason: SuspendUserActive}, StatusSuspended, SuspendUserActive},
+		{"report", reported, CCStatus{}, StatusReadyToReport, SuspendNone},
+		{"error", Result{State: ResultComputeError}, CCStatus{}, StatusError, SuspendNone},
+		{"uploading", Result{State: ResultFilesUploading}, CCStatus{}, StatusUploading, SuspendNone},
+	}
+	for _, test := range tests {
+		status, reason := taskStatus(test.result, test.ccStatus)
+		if status != test.status || reason != test.reason {
+			t.Errorf("%s: got %s (%s), want %s (%s)", test.name, status, reason, test.status, test.reason)
+		}
+	}
+}
+
+func TestStateLabels(t *testing.T) {
+	if ResultFilesUploaded.String() != "Uploaded" || TaskAbortPending.String() != "Abort pending" || StatusRunning.Key() != "running" {
+		t.Error("unexpected labels")
+	}
+	if SuspendReason(SuspendUserActive|SuspendTimeOfDay).String() != "computer is in use, time of day" {
+		t.Errorf("combined reason = %q", SuspendReason(SuspendUserActive|SuspendTimeOfDay))
+	}
+	if TaskState(42).String() != "Unknown (42)" {
+		t.Errorf("unknown state = %q", TaskState(42))
+	}
+	if status, ok := parseTaskStatus("report"); !ok || status != StatusReadyToReport {
+		t.Error("parseTaskStatus(report) failed")
+	}
+}
+
+func TestHostView(t *testing.T) {
+	view := BoincClientView{
+		Name:      "pi",
+		HostInfo:  HostInfo{MNBytes: 4 * 1024 * 1024 * 1024, DTotal: 32e9, DFree: 8e9},
+		TimeStats: TimeStats{OnFrac: 0.995, ActiveFrac: 1, ClientStartTime: 1700000000, Now: 1700000000 + 90000},
+		NetStats:  NetStats{AvgUp: 2048},
+	}
+	host := view.hostView()
+
+	tests := map[string][2]string{
+		"memory": {host.MemoryAsString, "4.0 GiB"},
+		"disk":   {host.DiskAsString, "7.5 GiB free of 29.8 GiB"},
+		"uptime": {host.UptimeAsString, "1d 1h:0m:0s"},
+		"on":     {host.OnAsString, "99.5%"},
+		"active": {host.ActiveAsString, "100.0%"},
+		"upload": {host.UploadAsString, "2.0 KiB/s"},
+	}
+	for name, test := range tests {
+		if test[0] != test[1] {
+			t.Errorf("%s %q, want %q", name, test[0], test[1])
+		}
+	}
+
+	if host := (BoincClientView{}).hostView(); host.ClientStartAsString != "" || host.UptimeAsString != "" {
+		t.Errorf("client start %q, uptime %q without time stats", host.ClientStartAsString, host.UptimeAsString)
+	}
+}
+
+func TestHostGPUsAndProjects(t *testing.T) {
+	// the host got GPUs since
+	server, client := polledTestBoinc(t)
+	server.setRecordedReply("get_state", fixture(t, "boinc/get_state_gpu.xml"))
+	client.lastState = time.Time{}
+	if err := client.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	host := client.view().hostView()
+	if host.ClientVersion != "7.18.1" || len(host.Platforms) != 2 {
+		t.Errorf("client %q on %v", host.ClientVersion, host.Platforms)
+	}
+	if len(host.GPUs) != 2 {
+		t.Fatalf("gpus %+v", host.GPUs)
+	}
+	nvidia, intel := host.GPUs[0], host.GPUs[1]
+	if nvidia.Type != "NVIDIA" || nvidia.Count != 1 || nvidia.MemoryAsString != "7.8 GiB" || nvidia.PeakFlopsAsString != "21.0 TFLOP/s" {
+		t.Errorf("nvidia %+v", nvidia)
+	}
+	if nvidia.VersionsAsString != "CUDA 11.4, driver 470.86, OpenCL 3.0 CUDA" {
+		t.Errorf("nvidia versions %q", nvidia.VersionsAsString)
+	}
+	if intel.Type != "intel_gpu" || intel.VersionsAsString != "driver 21.38.21026, OpenCL 3.0 NEO" || len(intel.Devices) != 1 {
+		t.Errorf("intel %+v", intel)
+	}
+
+	if len(host.HostProjects) != 2 {
+		t.Fatalf("projects %+v", host.HostProjects)
+	}
+	einstein, wcg := host.HostProjects[0], host.HostProjects[1]
+	if einstein.ShareAsString != "75.0%" || !einstein.NoNewWork || einstein.Suspended {
+		t.Errorf("einstein %+v", einstein)
+	}
+	if wcg.ShareAsString != "25.0%" || wcg.NoNewWork || !wcg.Suspended {
+		t.Errorf("wcg %+v", wcg)
+	}
+
+	// nothing to show before the first get_state
+	if view := (BoincClientView{}); len(view.hostView().GPUs) != 0 || len(hostProjects(nil)) != 0 {
+		t.Error("GPUs or projects without state")
+	}
+}
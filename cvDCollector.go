@@ -1,17 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
-	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,8 +29,13 @@ type DCClients struct {
 	ServerPort  int         `json:"port"`
 	BOINCConfig BOINCConfig `json:"boinc"`
 	FAHConfig   FAHConfig   `json:"fah"`
-	// internal updated attributes
-	BoincWUList []BoincWUReference
+	AssetDir    string      `json:"asset_dir"`    // load templates, CSS and JS from here instead of the built in ones
+	TemplateDir string      `json:"template_dir"` // pages found here replace the built in ones
+	Theme       string      `json:"theme"`        // light (default), dark or wall
+	Auth        AuthConfig  `json:"auth"`
+	TLS         *TLSConfig  `json:"tls"`       // serve HTTPS when set
+	AuditLog    string      `json:"audit_log"` // file of the actions on the clients, default cvDC_audit.log
+	Log         LogConfig   `json:"log"`
 }
 
 //
@@ -70,11 +79,81 @@ type DCClient struct {
 	Ip      string `json:"ip"`
 	Port    int    `json:"port"`
 	Pwd     string `json:"pwd"`
-	Debug   bool   `json:"debug"`
+	Debug   bool   `json:"debug"` // log the raw requests and replies of this client
 	Refresh int8   `json:"refresh"`
 
 	connection      net.Conn
+	reader          *bufio.Reader
 	ConnectionError error
+
+	mu    sync.RWMutex // guards the polled state and the connection against concurrent readers
+	stats pollStats    // counters of the poller, see cvDCStats.go
+
+	polling atomic.Bool // a loadState runs for the client
+}
+
+// rpcTimeout limits how long a single request/reply exchange with a client may take
+const rpcTimeout = 30 * time.Second
+
+// conn returns the connection and its reader, nil while not connected
+func (client *DCClient) conn() (net.Conn, *bufio.Reader) {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.connection, client.reader
+}
+
+// setConnection keeps a new connection, nil to drop it, and returns the one before
+func (client *DCClient) setConnection(conn net.Conn) net.Conn {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	old := client.connection
+	client.connection, client.reader = conn, nil
+	if conn != nil {
+		client.reader = bufio.NewReader(conn)
+	}
+	return old
+}
+
+// startPolling runs load in the background unless it runs already; one poller per
+// client, also when the connection was renewed in between
+func (client *DCClient) startPolling(load func()) {
+	if !client.polling.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer client.polling.Store(false)
+		load()
+	}()
+}
+
+// isConnected tells whether the client has a connection
+func (client *DCClient) isConnected() bool {
+	conn, _ := client.conn()
+	return conn != nil
+}
+
+// errNotConnected is the error of an exchange with a client which has no connection
+var errNotConnected = errors.New("not connected")
+
+// isConnectionError tells whether an exchange failed on the connection itself, not on the reply
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.As(err, &netErr) || errors.Is(err, errNotConnected)
+}
+
+// connectionError tells why the client is not connected, nil while it is
+func (client *DCClient) connectionError() error {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.ConnectionError
+}
+
+// setConnectionError records why the client is not connected, nil once it is
+func (client *DCClient) setConnectionError(err error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.ConnectionError = err
 }
 
 //
@@ -83,13 +162,28 @@ type DCClient struct {
 // Structure to store the values relevant to manage one BOINC client
 //
 type BoincClient struct {
-	DCClient         // "fake" inheritance
+	DCClient             // "fake" inheritance
+	SimpleRefresh    int `json:"simple_refresh"` // seconds between get_simple_gui_info polls
+	StateRefresh     int `json:"state_refresh"`  // seconds between full get_state polls
+	DiskRefresh      int `json:"disk_refresh"`   // seconds between get_disk_usage polls
 	ClientStateReply ClientStateReply
-}
+	CCStatus         CCStatus
+	DiskUsage        DiskUsage
+	FileTransfers    []FileTransfer
+
+	GlobalPrefs   GlobalPrefs    // the working computing preferences
+	PrefsOverride *GlobalPrefs   // the local override, nil without one
+	overrideFile  *PrefsOverride // the same as the host has it, for changes
+
+	lastState     time.Time // last full get_state
+	lastSimple    time.Time // last get_simple_gui_info (or get_state)
+	lastTransfers time.Time // last get_file_transfers
+	lastDisk      time.Time // last get_disk_usage
+	lastPrefs     time.Time // last get_global_prefs_working
 
-type BoincWUReference struct {
-	Client string
-	WUName string
+	renewed atomic.Bool // a new connection was opened, the next poll starts with the full state
+
+	rpc sync.Mutex // one request/reply exchange at a time, the poller and the actions share the connection
 }
 
 //
@@ -101,6 +195,14 @@ type FAHClient struct {
 	DCClient // "fake" inheritance
 	Slots    Slots
 	Units    Units
+
+	Options     FAHOptions            // options -a, all options of the client
+	SlotOptions map[string]FAHOptions // slot-options -a by slot ID
+
+	lastOptions time.Time   // last options -a
+	renewed     atomic.Bool // a new connection was opened, the next poll fetches the options
+
+	rpc sync.Mutex // one command/answer exchange at a time, the poller and the option changes share the connection
 }
 
 //
@@ -117,8 +219,9 @@ func loadStats(clients Client) {
 			// if we have no connection yet
 			if client.isConnected() == false {
 				// then open the connection
-				client.connect()
-				fmt.Printf("%s client %s (%s)\n", client.flavor(), client.Name, client.Ip)
+				if err := client.connect(); err != nil {
+					client.logger().Warn("connect failed", "error", err)
+				}
 
 				// and if successful start loading the data in background
 				if client.isConnected() == true {
@@ -134,75 +237,213 @@ func loadStats(clients Client) {
 }
 
 //
-// boincHandler URL handler
+// overviewHandler URL handler
 //
-func boincHandler(w http.ResponseWriter, _ *http.Request) {
-	//	clientName := r.URL.Path[len("/boinc/"):]
+func overviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
 
-	outputDefaultHeader(w)
+	renderPage(w, r, "cvDCollector_overview.html", farmOverview(boincViews(), fahViews()))
+}
 
-	clienttemplate, err := template.ParseFiles("html/cvDCollector_boinc.html")
+//
+// boincHandler URL handler
+//
+func boincHandler(w http.ResponseWriter, r *http.Request) {
+	if clientName := r.URL.Path[len("/boinc/"):]; clientName != "" && clientName != "all" {
+		boincHostHandler(w, r, clientName)
+		return
+	}
+
+	filter, err := parseUnitFilter(r, "/boinc/")
+	if err == nil {
+		err = filter.checkTaskStates()
+	}
 	if err != nil {
-		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	dcClients.BoincWUList = nil
-	for _, client := range dcClients.BOINCConfig.Clients {
-		for _, result := range client.ClientStateReply.ClientState.Results {
-			dcClients.BoincWUList = append(dcClients.BoincWUList, BoincWUReference{Client: client.Name, WUName: result.WUName})
-		}
+	sortKey := r.FormValue("sort")
+	if sortKey == "" {
+		sortKey = defaultTaskSort
+	}
+	groupKey := r.FormValue("group")
+	if groupKey == "" {
+		groupKey = "client"
 	}
 
-	sort.Slice(dcClients.BoincWUList, func(i, j int) bool {
-		return dcClients.BoincWUList[i].WUName < dcClients.BoincWUList[j].WUName
-	})
+	views := filterBoincViews(boincViews(), filter, time.Now())
+	groups, err := groupTasks(views, groupKey, sortKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	WUmin := "?"
 	WUmax := "?"
-	lenList := len(dcClients.BoincWUList)
-	if lenList > 0 {
-		WUmin = dcClients.BoincWUList[0].WUName
-		WUmax = dcClients.BoincWUList[lenList-1].WUName
+	for _, view := range views {
+		for _, task := range view.Tasks {
+			if WUmin == "?" || task.WUName < WUmin {
+				WUmin = task.WUName
+			}
+			if WUmax == "?" || task.WUName > WUmax {
+				WUmax = task.WUName
+			}
+		}
 	}
 	data := struct {
 		WUMin        string
 		WUMax        string
-		BoincClients []BoincClient
+		Sort         string
+		Group        string
+		SortOptions  []sortOption
+		GroupOptions []sortOption
+		StateOptions []TaskStatus
+		Filter       UnitFilter
+		Groups       []BoincTaskGroup
 	}{
 		WUMin:        WUmin,
 		WUMax:        WUmax,
-		BoincClients: dcClients.BOINCConfig.Clients,
+		Sort:         sortKey,
+		Group:        groupKey,
+		SortOptions:  taskSortOptions,
+		GroupOptions: taskGroupOptions,
+		StateOptions: taskStatusOrder(),
+		Filter:       filter,
+		Groups:       groups,
 	}
 
-	err = clienttemplate.Execute(w, data)
-	if err != nil {
-		_, _ = fmt.Printf("error %s", err)
+	renderPage(w, r, "cvDCollector_boinc.html", data)
+}
+
+//
+// boincHostHandler shows everything known about one BOINC host
+//
+func boincHostHandler(w http.ResponseWriter, r *http.Request, clientName string) {
+	client := findBoincClient(clientName)
+	if client == nil {
+		http.NotFound(w, r)
+		return
 	}
+
+	view := client.view()
+	_ = sortTasks(view.Tasks, defaultTaskSort)
+
+	renderPage(w, r, "cvDCollector_boinc_host.html", view.hostView())
 }
 
 //
-// fahHandler URL handler
+// deadlinesHandler URL handler
 //
-func fahHandler(w http.ResponseWriter, _ *http.Request) {
-	//	clientName := r.URL.Path[len("/fah/"):]
+func deadlinesHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Tasks []BoincTask
+	}{
+		Tasks: deadlineTasks(boincViews()),
+	}
 
-	outputDefaultHeader(w)
+	renderPage(w, r, "cvDCollector_deadlines.html", data)
+}
+
+//
+// fahHandler URL handler
+//
+func fahHandler(w http.ResponseWriter, r *http.Request) {
+	if clientName := r.URL.Path[len("/fah/"):]; clientName != "" && clientName != "all" {
+		fahHostHandler(w, r, clientName)
+		return
+	}
 
-	clienttmp, err := template.ParseFiles("html/cvDCollector_fah.html")
+	filter, err := parseUnitFilter(r, "/fah/")
 	if err != nil {
-		log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	data := struct {
-		FAHClients []FAHClient
+		Filter     UnitFilter
+		FAHClients []FAHClientView
 	}{
-		FAHClients: dcClients.FAHConfig.Clients,
+		Filter:     filter,
+		FAHClients: filterFAHViews(fahViews(), filter, time.Now()),
+	}
+
+	renderPage(w, r, "cvDCollector_fah.html", data)
+}
+
+//
+// fahHostHandler shows everything known about one FAH host
+//
+func fahHostHandler(w http.ResponseWriter, r *http.Request, clientName string) {
+	client := findFAHClient(clientName)
+	if client == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	renderPage(w, r, "cvDCollector_fah_host.html", client.view())
+}
+
+//
+// boincAPIHandler URL handler
+//
+func boincAPIHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUnitFilter(r, "/api/boinc/")
+	if err == nil {
+		err = filter.checkTaskStates()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	err = clienttmp.Execute(w, data)
+	views := filterBoincViews(boincViews(), filter, time.Now())
+	if groupKey := r.FormValue("group"); groupKey != "" {
+		groups, err := groupTasks(views, groupKey, r.FormValue("sort"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		outputJSON(w, groups)
+		return
+	}
+
+	for idx := range views {
+		if err := sortTasks(views[idx].Tasks, r.FormValue("sort")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	outputJSON(w, views)
+}
+
+//
+// overviewAPIHandler URL handler
+//
+func overviewAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	outputJSON(w, farmOverview(boincViews(), fahViews()))
+}
+
+//
+// deadlinesAPIHandler URL handler
+//
+func deadlinesAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	outputJSON(w, deadlineTasks(boincViews()))
+}
+
+//
+// fahAPIHandler URL handler
+//
+func fahAPIHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUnitFilter(r, "/api/fah/")
 	if err != nil {
-		_, _ = fmt.Printf("error %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	outputJSON(w, filterFAHViews(fahViews(), filter, time.Now()))
 }
 
 //
@@ -212,13 +453,13 @@ func updateHandler(w http.ResponseWriter, r *http.Request) {
 	// clientName := r.URL.Path[len("/update/"):]
 
 	if err := r.ParseForm(); err != nil {
-		fmt.Printf("%s\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	clientName, err := url.QueryUnescape(r.Form.Get("client"))
 	if err != nil {
-		fmt.Printf("%s\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -228,18 +469,19 @@ func updateHandler(w http.ResponseWriter, r *http.Request) {
 			var client = &dcClients.BOINCConfig.Clients[idx]
 			if clientName == client.Name || clientName == "all" {
 
-				fmt.Printf("trigger update for %s (%s)\n", client.Name, client.Ip)
-				reqBody, err := ioutil.ReadAll(r.Body)
-				if err != nil {
-					log.Fatal(err)
-				}
+				client.logger().Info("trigger project update", "user", requestUser(r).Name)
 
-				cmd := exec.Command("boinccmd", "--host", client.Ip, "--passwd", client.Pwd, "--project", "http://www.worldcommunitygrid.org", "update")
-				if err := cmd.Run(); err != nil {
-					fmt.Println("Error: ", err)
+				project := "http://www.worldcommunitygrid.org"
+				cmd := exec.Command("boinccmd", "--host", client.Ip, "--passwd", client.Pwd, "--project", project, "update")
+				output, err := cmd.CombinedOutput()
+				if err != nil {
+					client.logger().Warn("project update failed", "error", err, "output", string(output))
+					if text := strings.TrimSpace(string(output)); text != "" {
+						err = fmt.Errorf("%s: %s", err, text)
+					}
 				}
+				audit(r, client.Name, "update", "boinccmd --host "+client.Ip+" --project "+project+" update", "", err)
 
-				fmt.Printf("%s\n", reqBody)
 				_, _ = fmt.Fprintf(w, "Received a POST request to update %s\n", client.Name)
 			}
 		}
@@ -261,23 +503,33 @@ func reloadHandler(w http.ResponseWriter, r *http.Request) {
 		for idx := range dcClients.BOINCConfig.Clients {
 			var client = &dcClients.BOINCConfig.Clients[idx]
 
-			if client.connection != nil {
-				if err := client.connection.Close(); err != nil {
-					fmt.Printf("client %s (%s): %s\n", client.Name, client.Ip, err)
-				}
-			}
-
-			if err := client.connect(); err != nil {
-				fmt.Printf("reload client %s (%s), error: %s\n", client.Name, client.Ip, err)
+			err := client.reconnect()
+			if err != nil {
+				client.logger().Warn("reconnect failed", "error", err)
 			}
+			audit(r, client.Name, "reload", "reconnect BOINC client", "", err)
+		}
+	} else if client := findBoincClient(title); client != nil {
+		// reconnect a single host, e.g. from its page
+		err := client.reconnect()
+		if err != nil {
+			client.logger().Warn("reconnect failed", "error", err)
+		}
+		audit(r, client.Name, "reload", "reconnect BOINC client", "", err)
+	} else if client := findFAHClient(title); client != nil {
+		err := client.reconnect()
+		if err != nil {
+			client.logger().Warn("reconnect failed", "error", err)
 		}
+		audit(r, client.Name, "reload", "reconnect FAH client", "", err)
 	}
 
-	for _, client := range dcClients.BOINCConfig.Clients {
+	for idx := range dcClients.BOINCConfig.Clients {
+		var client = &dcClients.BOINCConfig.Clients[idx]
 		_, _ = fmt.Fprintf(w, "<h2>%s</h2>", client.Name)
 
-		if client.ConnectionError != nil {
-			_, _ = fmt.Fprintf(w, "error=%s<br>", client.ConnectionError)
+		if err := client.connectionError(); err != nil {
+			_, _ = fmt.Fprintf(w, "error=%s<br>", err)
 		}
 	}
 }
@@ -301,26 +553,52 @@ func outputDefaultHeader(w http.ResponseWriter) {
 	//	_, _ = fmt.Fprintf(w, "")
 }
 
+//
+// outputJSON writes data as the JSON answer of an API call
+//
+func outputJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("cache-control", "no-cache, must-revalidate, max-age=0")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		slog.Warn("writing JSON answer", "error", err)
+	}
+}
+
 //
 // load the config file for the remote clients
 //
-func loadConfig() {
+func loadConfig() error {
 	//
 	// load the JSON file with clients and password
 	//
 	jsonFile, err := os.Open("clients.json")
 	if err != nil {
-		// os.Open has an error ?
-		fmt.Println(err)
-		os.Exit(-1)
+		return err
 	}
 
 	defer jsonFile.Close() // whenever, close the file
 
 	// process the content of the config file
-	byteValue, _ := ioutil.ReadAll(jsonFile)
+	byteValue, err := ioutil.ReadAll(jsonFile)
+	if err != nil {
+		return err
+	}
 	if err := json.Unmarshal(byteValue, &dcClients); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
+		return fmt.Errorf("clients.json: %w", err)
+	}
+	return nil
+}
+
+//
+// exitOnError ends the collector when it can't start
+//
+func exitOnError(message string, err error) {
+	if err != nil {
+		slog.Error(message, "error", err)
+		os.Exit(-1)
 	}
 }
 
@@ -329,41 +607,89 @@ func loadConfig() {
 //
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		hashPassword()
+		return
+	}
+
+	//
+	// either simulate a farm of clients or load the config file with the real ones
+	//
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		startSimulation(os.Args[2:])
+	} else {
+		exitOnError("loading the config", loadConfig())
+	}
+
+	exitOnError("log config", setupLogging(dcClients.Log, os.Stderr))
+	exitOnError("auth config", checkAuthConfig())
+	if !authEnabled() {
+		slog.Warn("no users configured: everybody may look, update and reload only from this host")
+	}
+
 	//
 	// start network connection for each client
 	//
-	loadConfig()
 
-	fmt.Printf("%d FAH clients in list\n", len(dcClients.FAHConfig.Clients))
+	slog.Info("FAH clients in list", "count", len(dcClients.FAHConfig.Clients))
 	go func() {
 		loadFahStats()
 	}()
 	//go loadStats(&dcClients.FAHConfig.Clients[0])
 	//	loadClientsState(&dcClients.FAHConfig.Clients)
 
-	fmt.Printf("%d BOINC clients in list\n", len(dcClients.BOINCConfig.Clients))
+	slog.Info("BOINC clients in list", "count", len(dcClients.BOINCConfig.Clients))
 	go func() {
 		loadBoincStats()
 	}()
 
 	//	loadClientsState(&dcClients.BOINCConfig.Clients)
 
-	fscss := http.FileServer(http.Dir("css"))
-	http.Handle("/css/", http.StripPrefix("/css/", fscss))
-	fshtml := http.FileServer(http.Dir("html"))
-	http.Handle("/html/", http.StripPrefix("/html/", fshtml))
-	fsjs := http.FileServer(http.Dir("js"))
-	http.Handle("/js/", http.StripPrefix("/js/", fsjs))
-	fsimg := http.FileServer(http.Dir("image"))
-	http.Handle("/image/", http.StripPrefix("/image/", fsimg))
-
-	// establish the various handlers
-	http.HandleFunc("/boinc/", boincHandler)   // refresh clients
-	http.HandleFunc("/fah/", fahHandler)       // refresh clients
-	http.HandleFunc("/update", updateHandler)  // update API via POST
-	http.HandleFunc("/reload/", reloadHandler) // reload overall config and restart communication
-
-	// start the web server
-	addr := fmt.Sprintf(":%d", dcClients.ServerPort)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	// static files, built in unless asset_dir is set
+	http.HandleFunc("/css/", assetHandler)
+	http.HandleFunc("/js/", assetHandler)
+
+	// establish the various handlers; looking needs a viewer, acting an operator
+	http.HandleFunc("/", authorize(RoleViewer, overviewHandler))                        // all hosts of the farm
+	http.HandleFunc("/boinc/", authorize(RoleViewer, boincHandler))                     // refresh clients
+	http.HandleFunc("/boinc/deadlines", authorize(RoleViewer, deadlinesHandler))        // farm wide deadline risk
+	http.HandleFunc("/boinc/disk", authorize(RoleViewer, diskHandler))                  // farm wide disk usage
+	http.HandleFunc("/boinc/transfers", authorize(RoleViewer, transfersHandler))        // farm wide uploads and downloads
+	http.HandleFunc("/boinc/prefs", authorize(RoleViewer, prefsHandler))                // computing preferences of all hosts
+	http.HandleFunc("/boinc/projects", authorize(RoleViewer, attachHandler))            // attach hosts to projects
+	http.HandleFunc("/fah/", authorize(RoleViewer, fahHandler))                         // refresh clients
+	http.HandleFunc("/fah/options", authorize(RoleViewer, fahOptionsHandler))           // options of all FAH clients
+	http.HandleFunc("/api/overview", authorize(RoleViewer, overviewAPIHandler))         // farm overview as JSON
+	http.HandleFunc("/api/boinc/", authorize(RoleViewer, boincAPIHandler))              // client state as JSON
+	http.HandleFunc("/api/boinc/deadlines", authorize(RoleViewer, deadlinesAPIHandler)) // deadline risk as JSON
+	http.HandleFunc("/api/boinc/disk", authorize(RoleViewer, diskAPIHandler))           // disk usage as JSON
+	http.HandleFunc("/api/boinc/transfers", authorize(RoleViewer, transfersAPIHandler)) // transfers as JSON
+	http.HandleFunc("/api/boinc/prefs", authorize(RoleViewer, prefsAPIHandler))         // computing preferences as JSON
+	http.HandleFunc("/api/boinc/projects", authorize(RoleViewer, attachAPIHandler))     // projects of the farm as JSON
+	http.HandleFunc("/api/fah/", authorize(RoleViewer, fahAPIHandler))                  // client state as JSON
+	http.HandleFunc("/api/fah/options", authorize(RoleViewer, fahOptionsAPIHandler))    // FAH options as JSON
+	http.HandleFunc("/api/csrf", authorize(RoleViewer, csrfAPIHandler))                 // token for the posts of scripts
+	http.HandleFunc("/audit", authorize(RoleViewer, auditHandler))                      // who did what on which client
+	http.HandleFunc("/api/audit", authorize(RoleViewer, auditAPIHandler))               // the same as JSON
+	http.HandleFunc("/events", authorize(RoleViewer, eventsHandler))                    // live updates (Server-Sent Events)
+	http.HandleFunc("/stats", authorize(RoleViewer, statsHandler))                      // counters of the pollers
+	http.HandleFunc("/jobs", authorize(RoleViewer, jobsHandler))                        // maintenance jobs and their progress
+	http.HandleFunc("/api/jobs", authorize(RoleViewer, jobsAPIHandler))                 // the same as JSON
+	http.HandleFunc("/api/stats", authorize(RoleViewer, statsAPIHandler))               // the same as JSON
+	http.HandleFunc("/healthz", healthzHandler)                                         // the collector answers (no login)
+	http.HandleFunc("/readyz", readyzHandler)                                           // the pollers work (no login)
+	http.HandleFunc("/update", authorize(RoleOperator, updateHandler))                  // update API via POST
+	http.HandleFunc("/reload/", authorize(RoleOperator, reloadHandler))                 // reload overall config and restart communication
+	http.HandleFunc("/retry-transfer/", authorize(RoleOperator, retryTransferHandler))  // retry BOINC file transfers
+	http.HandleFunc("/abort-transfer/", authorize(RoleOperator, abortTransferHandler))  // give up a BOINC file transfer
+	http.HandleFunc("/set-prefs/", authorize(RoleOperator, setPrefsHandler))            // push a preferences override
+	http.HandleFunc("/attach-project/", authorize(RoleOperator, attachProjectHandler))  // attach BOINC clients to a project
+	http.HandleFunc("/detach-project/", authorize(RoleOperator, detachProjectHandler))  // detach BOINC clients from a project
+	http.HandleFunc("/set-fah-options/", authorize(RoleOperator, setFahOptionsHandler)) // change user, team, power or cause of FAH clients
+	for action := range maintenanceActions {
+		http.HandleFunc("/"+action+"/", authorize(RoleOperator, maintenanceHandler)) // BOINC maintenance as background job
+	}
+
+	// start the web server, HTTPS when configured
+	exitOnError("web server", serve())
 }
@@ -0,0 +1,5 @@
+module github.com/ChristianVirtual/cvDCollect
+
+go 1.22
+
+require golang.org/x/crypto v0.11.0
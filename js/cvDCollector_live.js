@@ -0,0 +1,83 @@
+//
+// Live updates of the BOINC and FAH pages
+//
+// Listens to the collector's /events stream and applies the changes in place:
+// rows are found by data-row="<boinc|fah>/<client>/<task or unit>", their cells by
+// data-field. New rows only raise a notice (the page may be filtered or
+// sorted), after a lost connection the page reloads to catch up.
+//
+(function () {
+    if (!window.EventSource) {
+        return;
+    }
+
+    function find(attribute, value) {
+        return document.querySelector('[' + attribute + '="' + CSS.escape(value) + '"]');
+    }
+
+    function setField(row, field, text) {
+        var cell = row.querySelector('[data-field="' + field + '"]');
+        if (cell) {
+            cell.textContent = text;
+        }
+        return cell;
+    }
+
+    function applyRow(row, update) {
+        if (update.class) {
+            row.className = row.className.replace(/\btable-\S+/, '').trim() + ' table-' + update.class;
+        }
+        setField(row, 'status', update.status);
+        setField(row, 'remaining', update.remaining);
+        setField(row, 'progress-text', update.finished ? 'finished' : update.progress);
+
+        var bar = row.querySelector('[data-field="progress"]');
+        if (bar) {
+            bar.style.width = update.finished ? '100%' : update.progress;
+            bar.textContent = update.finished ? 'finished' : update.remaining;
+        }
+    }
+
+    function apply(event) {
+        var change = JSON.parse(event.data);
+        var client = find('data-client', change.kind + '/' + change.client);
+        if (client) {
+            var error = client.querySelector('[data-field="error"]');
+            if (error) {
+                error.textContent = change.connection_error;
+                if (error.tagName !== 'TD') {
+                    error.hidden = !change.connection_error;
+                }
+            }
+        }
+
+        (change.rows || []).forEach(function (update) {
+            var row = find('data-row', change.kind + '/' + update.id);
+            if (row) {
+                applyRow(row, update);
+            }
+        });
+        var notice = document.getElementById('live-notice');
+        if (notice && (change.added || []).some(function (id) { return !find('data-row', change.kind + '/' + id); })) {
+            notice.hidden = false;
+        }
+        (change.removed || []).forEach(function (id) {
+            var row = find('data-row', change.kind + '/' + id);
+            if (row) {
+                row.remove();
+            }
+        });
+    }
+
+    var lost = false;
+    var source = new EventSource('/events');
+    source.onmessage = apply;
+    source.onerror = function () {
+        lost = true;
+    };
+    source.onopen = function () {
+        if (lost) {
+            document.location.reload();
+        }
+    };
+})();